@@ -2,10 +2,15 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"sort"
+	"time"
 
 	"github.com/rafalb8/go-maps/types"
 	"github.com/rafalb8/go-storage/encoding"
 	"github.com/rafalb8/go-storage/internal/iter"
+	"github.com/rafalb8/go-storage/internal/keypath"
+	"github.com/rafalb8/go-storage/options"
 )
 
 var _ Bucketer = (*Bucket)(nil)
@@ -84,6 +89,34 @@ func (b Bucket) Delete(k string) error {
 	return b.conn.Delete(b.conn.Encoding().EncodeKey(b.Prefix(), k))
 }
 
+// Clear deletes all keys of bucket and its nested buckets
+func (b Bucket) Clear() error {
+	c := b.conn.Encoding()
+	keys := []string{}
+	for item := range b.conn.Iter(context.Background(), keypath.Prefix(c, keypath.Join(b.buckets, ""))) {
+		buckets, _ := keypath.Parse(c, item.Key)
+		if keypath.HasBucket(buckets, b.buckets) {
+			keys = append(keys, item.Key)
+		}
+	}
+
+	for _, k := range keys {
+		err := b.conn.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b Bucket) Incr(k string, delta int64, op ...Option) (int64, error) {
+	return b.conn.Incr(b.conn.Encoding().EncodeKey(b.Prefix(), k), delta, op...)
+}
+
+func (b Bucket) IncrFloat(k string, delta float64, op ...Option) (float64, error) {
+	return b.conn.IncrFloat(b.conn.Encoding().EncodeKey(b.Prefix(), k), delta, op...)
+}
+
 func (b Bucket) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
 	out := make(chan types.Item[string, []byte])
 	go func() {
@@ -102,11 +135,116 @@ func (b Bucket) Iter(ctx context.Context, pfx string) types.Iterator[string, []b
 	return out
 }
 
+// KeepAlive sets key with ttl and keeps it alive until ctx is done, returned channel is closed
+// when key stops being kept alive. It is pushed down to engines implementing KeepAliver,
+// on other engines key is set again every third of ttl and channel is closed when it fails.
+func (b Bucket) KeepAlive(ctx context.Context, k string, v any, ttl time.Duration) (<-chan struct{}, error) {
+	if ttl <= 0 {
+		return nil, errors.New("keep alive: TTL must be positive")
+	}
+	if ka, ok := b.conn.(KeepAliver); ok {
+		return ka.KeepAlive(ctx, b.conn.Encoding().EncodeKey(b.Prefix(), k), v, ttl)
+	}
+
+	err := b.Set(k, v, options.TTL(ttl))
+	if err != nil {
+		return nil, err
+	}
+
+	lost := make(chan struct{})
+	go func() {
+		defer close(lost)
+
+		interval := ttl / 3
+		if interval <= 0 {
+			interval = ttl
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if b.Set(k, v, options.TTL(ttl)) != nil {
+					return
+				}
+			}
+		}
+	}()
+	return lost, nil
+}
+
+// IterRange iterates keys of bucket in range [from, to) in order of keys, empty to is end of bucket.
+// Range is pushed down to engines implementing Ranger, other engines are scanned and sorted.
+func (b Bucket) IterRange(ctx context.Context, from, to string) types.Iterator[string, []byte] {
+	pfx := b.conn.Encoding().EncodeKey(b.Prefix(), "")
+	start, end := pfx+from, pfx+to
+	if to == "" {
+		end = prefixEnd(pfx)
+	}
+
+	out := make(chan types.Item[string, []byte])
+	go func() {
+		defer close(out)
+
+		if r, ok := b.conn.(Ranger); ok {
+			for item := range r.IterRange(ctx, start, end) {
+				b.emit(ctx, out, item)
+			}
+			return
+		}
+
+		items := []types.Item[string, []byte]{}
+		for item := range b.conn.Iter(ctx, pfx) {
+			if item.Key < start || (end != "" && item.Key >= end) {
+				continue
+			}
+			items = append(items, item)
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+		for _, item := range items {
+			b.emit(ctx, out, item)
+		}
+	}()
+	return out
+}
+
+// emit sends item with key relative to bucket, item is dropped when ctx is done
+func (b Bucket) emit(ctx context.Context, out chan<- types.Item[string, []byte], item types.Item[string, []byte]) {
+	keys := b.conn.Encoding().DecodeKey(item.Key)
+	if len(keys) == 0 {
+		item.Key = ""
+	} else {
+		item.Key = keys[len(keys)-1]
+	}
+
+	select {
+	case out <- item:
+	case <-ctx.Done():
+	}
+}
+
+// prefixEnd returns smallest key greater than all keys starting with pfx, empty if there is none
+func prefixEnd(pfx string) string {
+	end := []byte(pfx)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
+
 func (b Bucket) Watch(ctx context.Context, k string) types.Watcher[string, []byte] {
 	out := make(chan types.WatchMsg[string, []byte])
+	// watch before returning, so changes made after Watch returns are not missed
+	items := b.conn.Watch(ctx, b.conn.Encoding().EncodeKey(b.Prefix(), k))
 	go func() {
 		defer close(out)
-		for item := range b.conn.Watch(ctx, b.conn.Encoding().EncodeKey(b.Prefix(), k)) {
+		for item := range items {
 			keys := b.conn.Encoding().DecodeKey(item.Key)
 			if len(keys) == 0 {
 				item.Key = ""
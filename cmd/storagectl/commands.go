@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/keypath"
+	"github.com/rafalb8/go-storage/options"
+)
+
+type cli struct {
+	conn   storage.Connection
+	in     io.Reader
+	out    io.Writer
+	format string // output format
+}
+
+func (c *cli) run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("command not set")
+	}
+
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "get":
+		return c.get(args)
+	case "set":
+		return c.set(args)
+	case "del":
+		return c.del(args)
+	case "ls":
+		return c.ls(args)
+	case "watch":
+		return c.watch(ctx, args)
+	case "dump":
+		return c.dump(ctx, args)
+	case "load":
+		return c.load(args)
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+func (c *cli) get(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: get <path>")
+	}
+
+	var val any
+	err := c.conn.Get(keypath.Encode(c.conn.Encoding(), args[0]), &val)
+	if err != nil {
+		return err
+	}
+	return c.render(val)
+}
+
+func (c *cli) set(args []string) error {
+	fs := flag.NewFlagSet("set", flag.ContinueOnError)
+	ttl := fs.Duration("ttl", 0, "delete key after duration")
+	str := fs.Bool("string", false, "store value as string")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		return errors.New("usage: set [-ttl d] [-string] <path> <value>")
+	}
+
+	var val any = fs.Arg(1)
+	if !*str {
+		val = internal.ParseValue(fs.Arg(1))
+	}
+
+	op := []storage.Option{}
+	if *ttl > 0 {
+		op = append(op, options.TTL(*ttl))
+	}
+	return c.conn.Set(keypath.Encode(c.conn.Encoding(), fs.Arg(0)), val, op...)
+}
+
+func (c *cli) del(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: del <path>...")
+	}
+
+	for _, path := range args {
+		err := c.conn.Delete(keypath.Encode(c.conn.Encoding(), path))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cli) ls(args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	recursive := fs.Bool("r", false, "list keys of sub buckets")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	parent := keypath.Buckets(fs.Arg(0))
+	keys, err := c.conn.Keys(keypath.Prefix(c.conn.Encoding(), fs.Arg(0)))
+	if err != nil {
+		return err
+	}
+
+	found := map[string]struct{}{}
+	for _, raw := range keys {
+		buckets, key := keypath.Parse(c.conn.Encoding(), raw)
+		if !keypath.HasBucket(buckets, parent) {
+			continue
+		}
+
+		switch {
+		case len(buckets) == len(parent):
+			found[keypath.Escape(key)] = struct{}{}
+		case *recursive:
+			found[keypath.Join(buckets[len(parent):], key)] = struct{}{}
+		default:
+			found[keypath.Escape(buckets[len(parent)])+keypath.Separator] = struct{}{}
+		}
+	}
+
+	out := make([]string, 0, len(found))
+	for name := range found {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+
+	for _, name := range out {
+		fmt.Fprintln(c.out, name)
+	}
+	return nil
+}
+
+func (c *cli) watch(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: watch [bucket]")
+	}
+
+	parent := keypath.Buckets(firstArg(args))
+	for event := range c.conn.Watch(ctx, keypath.Prefix(c.conn.Encoding(), firstArg(args))) {
+		buckets, key := keypath.Parse(c.conn.Encoding(), event.Key)
+		if !keypath.HasBucket(buckets, parent) {
+			continue
+		}
+
+		var val any
+		if len(event.Value) > 0 {
+			err := c.conn.Encoding().DecodeValue(event.Value, &val)
+			if err != nil {
+				val = string(event.Value)
+			}
+		}
+
+		err := c.renderEvent(map[string]any{
+			"event": event.Event,
+			"key":   keypath.Join(buckets, key),
+			"value": val,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cli) dump(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: dump [bucket]")
+	}
+
+	parent := keypath.Buckets(firstArg(args))
+	out := map[string]any{}
+	for item := range c.conn.Iter(ctx, keypath.Prefix(c.conn.Encoding(), firstArg(args))) {
+		buckets, key := keypath.Parse(c.conn.Encoding(), item.Key)
+		if !keypath.HasBucket(buckets, parent) {
+			continue
+		}
+
+		var val any
+		err := c.conn.Encoding().DecodeValue(item.Value, &val)
+		if err != nil {
+			return fmt.Errorf("decode %s: %w", keypath.Join(buckets, key), err)
+		}
+		out[keypath.Join(buckets, key)] = val
+	}
+	return c.render(out)
+}
+
+func (c *cli) load(args []string) error {
+	fs := flag.NewFlagSet("load", flag.ContinueOnError)
+	format := fs.String("i", "", "input format: json or yaml (default detected from file extension)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: load [-i json|yaml] <file|->")
+	}
+
+	in := c.in
+	if fs.Arg(0) != "-" {
+		file, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+
+		if *format == "" {
+			switch filepath.Ext(fs.Arg(0)) {
+			case ".yaml", ".yml":
+				*format = "yaml"
+			}
+		}
+	}
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	values, err := parseDocument(data, *format)
+	if err != nil {
+		return err
+	}
+
+	for path, val := range values {
+		err = c.conn.Set(keypath.Encode(c.conn.Encoding(), path), val)
+		if err != nil {
+			return fmt.Errorf("set %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func (c *cli) renderEvent(event map[string]any) error {
+	if c.format == "yaml" {
+		fmt.Fprintln(c.out, "---")
+		return c.render(event)
+	}
+	return json.NewEncoder(c.out).Encode(fixValue(event))
+}
+
+func firstArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+)
+
+func newCLI(format string) (*cli, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return &cli{
+		conn:   internal.Must(memory.New(memory.Logger(&stderrLogger{}))),
+		out:    out,
+		format: format,
+	}, out
+}
+
+func TestSetGet(t *testing.T) {
+	c, out := newCLI("json")
+	defer c.conn.Close()
+
+	err := c.run(context.Background(), []string{"set", "env/123/one", `{"a": 1}`})
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[map[string]int](c.conn.Bucket("env", "123"), "one")
+	if err != nil {
+		t.Error(err)
+	}
+	if val["a"] != 1 {
+		t.Error("Value not 1")
+	}
+
+	err = c.run(context.Background(), []string{"get", "env/123/one"})
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(strings.Fields(out.String()), "") != `{"a":1}` {
+		t.Error("Unexpected output:", out.String())
+	}
+
+	err = c.run(context.Background(), []string{"del", "env/123/one"})
+	if err != nil {
+		t.Error(err)
+	}
+	if c.conn.Bucket("env", "123").Exists("one") {
+		t.Error("Value not deleted")
+	}
+}
+
+func TestLs(t *testing.T) {
+	c, out := newCLI("json")
+	defer c.conn.Close()
+
+	c.conn.Set("root", 1)
+	c.conn.Bucket("env", "123").Set("one", 1)
+	c.conn.Bucket("env", "123", "element").Set("two", 2)
+	c.conn.Bucket("env", "1234").Set("three", 3)
+
+	err := c.run(context.Background(), []string{"ls"})
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != "env/\nroot\n" {
+		t.Error("Unexpected root listing:", out.String())
+	}
+
+	out.Reset()
+	err = c.run(context.Background(), []string{"ls", "env/123"})
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != "element/\none\n" {
+		t.Error("Unexpected bucket listing:", out.String())
+	}
+
+	out.Reset()
+	err = c.run(context.Background(), []string{"ls", "-r", "env/123"})
+	if err != nil {
+		t.Error(err)
+	}
+	if out.String() != "element/two\none\n" {
+		t.Error("Unexpected recursive listing:", out.String())
+	}
+}
+
+func TestDumpLoad(t *testing.T) {
+	for _, format := range []string{"json", "yaml"} {
+		src, out := newCLI(format)
+
+		src.conn.Bucket("env", "123").Set("one", 1)
+		src.conn.Bucket("env", "123").Set("list", []string{"a", "b"})
+		src.conn.Bucket("env", "123").Set("map", map[string]any{"a": map[string]int{"b": 2}})
+
+		err := src.run(context.Background(), []string{"dump", "env"})
+		if err != nil {
+			t.Error(format, err)
+		}
+		src.conn.Close()
+
+		dst, _ := newCLI(format)
+		dst.in = out
+
+		err = dst.run(context.Background(), []string{"load", "-i", format, "-"})
+		if err != nil {
+			t.Error(format, err)
+		}
+
+		one, err := helpers.Get[int](dst.conn.Bucket("env", "123"), "one")
+		if err != nil {
+			t.Error(format, err)
+		}
+		if one != 1 {
+			t.Error(format, "Value not 1")
+		}
+
+		list, err := helpers.Get[[]string](dst.conn.Bucket("env", "123"), "list")
+		if err != nil {
+			t.Error(format, err)
+		}
+		if len(list) != 2 || list[1] != "b" {
+			t.Error(format, "Unexpected list", list)
+		}
+
+		m, err := helpers.Get[map[string]map[string]int](dst.conn.Bucket("env", "123"), "map")
+		if err != nil {
+			t.Error(format, err)
+		}
+		if m["a"]["b"] != 2 {
+			t.Error(format, "Unexpected map", m)
+		}
+		dst.conn.Close()
+	}
+}
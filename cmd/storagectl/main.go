@@ -0,0 +1,91 @@
+// Command storagectl inspects and edits go-storage databases.
+//
+//	storagectl -engine jsondb -file db.json ls env/123
+//	storagectl -engine etcd -endpoints http://127.0.0.1:2379 -o yaml get env/123/element/one
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const usage = `Usage: storagectl [flags] <command> [args]
+
+Commands:
+  get <path>                    print value of key
+  set [-ttl d] [-string] <path> <value>
+                                set key, value is parsed as JSON unless -string is used
+  del <path>...                 delete keys
+  ls [-r] [bucket]              list keys and sub buckets
+  watch [bucket]                print changes of keys in bucket
+  dump [bucket]                 print all keys in bucket as single document
+  load [-i json|yaml] <file|->  set all keys from document created by dump
+
+Paths are bucket names and key separated by "/", eg. env/123/element/one.
+
+Flags:
+`
+
+type config struct {
+	engine    string
+	file      string
+	endpoints string
+	dir       string
+	token     string
+	lb        string
+	keys      string
+	values    string
+	output    string
+	verbose   bool
+}
+
+func main() {
+	cfg := config{}
+	flag.StringVar(&cfg.engine, "engine", "jsondb", "storage engine: jsondb, etcd or embed")
+	flag.StringVar(&cfg.file, "file", "db.json", "jsondb file")
+	flag.StringVar(&cfg.endpoints, "endpoints", "http://127.0.0.1:2379", "comma separated etcd endpoints")
+	flag.StringVar(&cfg.dir, "dir", "default.etcd", "embedded etcd data dir")
+	flag.StringVar(&cfg.token, "token", "", "embedded etcd cluster token")
+	flag.StringVar(&cfg.lb, "lb", "", "embedded etcd load balancer used for peer discovery")
+	flag.StringVar(&cfg.keys, "keys", "", "etcd key coder: binary or simple (default engine coder)")
+	flag.StringVar(&cfg.values, "values", "", "etcd value coder: cbor or json (default engine coder)")
+	flag.StringVar(&cfg.output, "o", "json", "output format: json or yaml")
+	flag.BoolVar(&cfg.verbose, "v", false, "print engine debug logs to stderr")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	conn, err := open(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "storagectl:", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	c := &cli{
+		conn:   conn,
+		in:     os.Stdin,
+		out:    os.Stdout,
+		format: cfg.output,
+	}
+	err = c.run(ctx, flag.Args())
+
+	cancel()
+	conn.Close()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "storagectl:", err)
+		os.Exit(1)
+	}
+}
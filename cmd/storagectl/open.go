@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/encoding/key"
+	"github.com/rafalb8/go-storage/encoding/value"
+	"github.com/rafalb8/go-storage/engine/etcd"
+	"github.com/rafalb8/go-storage/engine/jsondb"
+)
+
+func open(cfg config) (storage.Connection, error) {
+	lg := &stderrLogger{verbose: cfg.verbose}
+
+	switch cfg.engine {
+	case "jsondb":
+		return jsondb.New(jsondb.File(cfg.file), jsondb.Logger(lg))
+
+	case "etcd", "embed":
+		opts := []etcd.EtcdOpts{etcd.Logger(lg)}
+
+		if cfg.keys != "" || cfg.values != "" {
+			coder, err := coder(cfg.keys, cfg.values)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, etcd.Coder(coder))
+		}
+
+		if cfg.engine == "embed" {
+			opts = append(opts, etcd.Embed(cfg.lb, cfg.token, cfg.dir, !cfg.verbose))
+		} else {
+			opts = append(opts, etcd.Endpoints(strings.Split(cfg.endpoints, ",")...))
+		}
+		return etcd.New(opts...)
+
+	default:
+		return nil, fmt.Errorf("unknown engine %q", cfg.engine)
+	}
+}
+
+// coder returns etcd default coder with overridden key/value coders
+func coder(keys, values string) (encoding.Coder, error) {
+	kc, vc := key.Binary, value.CBOR
+
+	switch keys {
+	case "", "binary":
+	case "simple":
+		kc = key.Simple
+	default:
+		return nil, fmt.Errorf("unknown key coder %q", keys)
+	}
+
+	switch values {
+	case "", "cbor":
+	case "json":
+		vc = value.JSON
+	default:
+		return nil, fmt.Errorf("unknown value coder %q", values)
+	}
+
+	return encoding.NewCoder(kc, vc), nil
+}
+
+// stderrLogger keeps stdout clean for command output
+type stderrLogger struct {
+	verbose bool
+}
+
+func (s *stderrLogger) Debug(args ...any) {
+	if s.verbose {
+		fmt.Fprintln(os.Stderr, args...)
+	}
+}
+
+func (s *stderrLogger) Warn(args ...any) {
+	fmt.Fprintln(os.Stderr, args...)
+}
+
+func (s *stderrLogger) Info(args ...any) {
+	if s.verbose {
+		fmt.Fprintln(os.Stderr, args...)
+	}
+}
+
+func (s *stderrLogger) Error(args ...any) {
+	fmt.Fprintln(os.Stderr, args...)
+}
+
+func (s *stderrLogger) Fatal(args ...any) {
+	panic(fmt.Sprintln(args...))
+}
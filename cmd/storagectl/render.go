@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rafalb8/go-storage/internal"
+	"gopkg.in/yaml.v2"
+)
+
+func (c *cli) render(v any) error {
+	v = fixValue(v)
+
+	switch c.format {
+	case "json", "":
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+
+	case "yaml":
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = c.out.Write(data)
+		return err
+
+	default:
+		return fmt.Errorf("unknown output format %q", c.format)
+	}
+}
+
+// fixValue converts decoded value so it can be marshaled to json
+func fixValue(v any) any {
+	v = internal.FixValue(v)
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// parseDocument parses dump output, map of paths to values
+func parseDocument(data []byte, format string) (map[string]any, error) {
+	out := map[string]any{}
+
+	switch format {
+	case "json", "":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&out); err != nil {
+			return nil, err
+		}
+		for k, v := range out {
+			out[k] = internal.FixNumbers(v)
+		}
+
+	case "yaml":
+		if err := yaml.Unmarshal(data, &out); err != nil {
+			return nil, err
+		}
+		for k, v := range out {
+			out[k] = internal.FixValue(v)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown input format %q", format)
+	}
+
+	return out, nil
+}
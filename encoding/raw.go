@@ -0,0 +1,14 @@
+package encoding
+
+// Raw is already encoded value, it's written and read as is.
+// Works only with coders created by NewCoder.
+type Raw []byte
+
+func (r Raw) EncodeValue(_ ValueCoder) ([]byte, error) {
+	return r, nil
+}
+
+func (r *Raw) DecodeValue(_ ValueCoder, data []byte) error {
+	*r = append((*r)[:0], data...)
+	return nil
+}
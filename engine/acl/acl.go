@@ -0,0 +1,336 @@
+// Package acl restricts access to connection with permissions granted to principals.
+//
+// Policy holds rules granting permissions on bucket path patterns, handles returned by Policy.As
+// are bound to principal and check every operation. Everything not granted is denied.
+// Iterations, listings and watches skip keys principal can't read or watch.
+package acl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/keypath"
+)
+
+var (
+	_ storage.Connection = (*ACL)(nil)
+)
+
+// AnyPrincipal matches every principal in Allow
+const AnyPrincipal = "*"
+
+type Permission uint8
+
+const (
+	Read   Permission = 1 << iota // Get, Exists, Iter, Keys, Values, Len
+	Write                         // Set
+	Delete                        // Delete
+	Watch                         // Watch
+
+	ReadWrite = Read | Write | Delete
+	All       = Read | Write | Delete | Watch
+)
+
+func (p Permission) String() string {
+	names := []string{}
+	for i, name := range []string{"read", "write", "delete", "watch"} {
+		if p&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// PermissionError is returned for denied operations, errors.Is(err, storage.ErrPermissionDenied) reports true
+type PermissionError struct {
+	Principal  string
+	Key        string
+	Permission Permission
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("permission denied: %q can't %s %s", e.Principal, e.Permission, e.Key)
+}
+
+func (e *PermissionError) Is(target error) bool {
+	return target == storage.ErrPermissionDenied
+}
+
+type rule struct {
+	principal string
+	pattern   []string
+	perm      Permission
+}
+
+// Policy of access to connection
+type Policy struct {
+	conn  storage.Connection
+	rules []rule
+
+	// Logger
+	lg storage.Logger
+}
+
+// New creates policy of access to conn. Closing policy closes conn.
+func New(conn storage.Connection, opts ...PolicyOpts) (*Policy, error) {
+	p := &Policy{
+		conn: conn,
+		lg:   &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+func (p *Policy) Close() {
+	p.conn.Close()
+}
+
+// As returns connection bound to principal
+func (p *Policy) As(principal string) *ACL {
+	return &ACL{policy: p, principal: principal}
+}
+
+// Allowed reports whether principal has all permissions on key
+func (p *Policy) Allowed(principal, k string, perm Permission) bool {
+	buckets, _ := keypath.Parse(p.conn.Encoding(), k)
+
+	granted := Permission(0)
+	for _, r := range p.rules {
+		if r.principal != AnyPrincipal && r.principal != principal {
+			continue
+		}
+		if _, ok := keypath.Match(r.pattern, buckets); ok {
+			granted |= r.perm
+		}
+	}
+	return granted&perm == perm
+}
+
+// ACL is connection bound to principal
+type ACL struct {
+	policy    *Policy
+	principal string
+}
+
+// Principal returns principal of connection
+func (a *ACL) Principal() string {
+	return a.principal
+}
+
+// check returns error when principal doesn't have permission on key
+func (a *ACL) check(k string, perm Permission) error {
+	if a.policy.Allowed(a.principal, k, perm) {
+		return nil
+	}
+	a.policy.lg.Debug("DENIED", a.principal, perm, k)
+	return &PermissionError{Principal: a.principal, Key: k, Permission: perm}
+}
+
+// Close doesn't close underlying connection, use Policy.Close
+func (a *ACL) Close() {}
+
+func (a *ACL) Encoding() encoding.Coder {
+	return a.policy.conn.Encoding()
+}
+
+func (a *ACL) Bucket(bucket ...string) *storage.Bucket {
+	return storage.NewBucket(a, a.Encoding().DecodeBucket(bucket...)...)
+}
+
+func (a *ACL) Set(k string, v any, op ...storage.Option) error {
+	if err := a.check(k, Write); err != nil {
+		return err
+	}
+	return a.policy.conn.Set(k, v, op...)
+}
+
+func (a *ACL) Get(k string, v any) error {
+	if err := a.check(k, Read); err != nil {
+		return err
+	}
+	return a.policy.conn.Get(k, v)
+}
+
+func (a *ACL) Exists(k string) bool {
+	if err := a.check(k, Read); err != nil {
+		return false
+	}
+	return a.policy.conn.Exists(k)
+}
+
+func (a *ACL) Delete(k string) error {
+	if err := a.check(k, Delete); err != nil {
+		return err
+	}
+	return a.policy.conn.Delete(k)
+}
+
+// Incr requires Read and Write permission, as it returns value of key
+func (a *ACL) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	if err := a.check(k, Read|Write); err != nil {
+		return 0, err
+	}
+	return a.policy.conn.Incr(k, delta, op...)
+}
+
+// IncrFloat requires Read and Write permission, as it returns value of key
+func (a *ACL) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	if err := a.check(k, Read|Write); err != nil {
+		return 0, err
+	}
+	return a.policy.conn.IncrFloat(k, delta, op...)
+}
+
+func (a *ACL) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
+	return a.iter(ctx, a.policy.conn, "", pfx)
+}
+
+// iter filters items of it readable by principal, keys of it are relative to bucket prefix
+func (a *ACL) iter(ctx context.Context, it storage.Iterator, bucket, pfx string) types.Iterator[string, []byte] {
+	out := make(chan types.Item[string, []byte])
+	go func() {
+		defer close(out)
+		for item := range it.Iter(ctx, pfx) {
+			if a.check(bucket+item.Key, Read) != nil {
+				continue
+			}
+
+			select {
+			case out <- item:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+func (a *ACL) Watch(ctx context.Context, pfx string) types.Watcher[string, []byte] {
+	out := make(chan types.WatchMsg[string, []byte])
+	msgs := a.policy.conn.Watch(ctx, pfx)
+	go func() {
+		defer close(out)
+		for msg := range msgs {
+			if a.check(msg.Key, Watch) != nil {
+				continue
+			}
+
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+func (a *ACL) Keys(pfx string) ([]string, error) {
+	keys, err := a.policy.conn.Keys(pfx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []string{}
+	for _, k := range keys {
+		if a.check(k, Read) == nil {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+func (a *ACL) Len(pfx string) (int, error) {
+	keys, err := a.Keys(pfx)
+	return len(keys), err
+}
+
+func (a *ACL) Values(pfx string) ([][]byte, error) {
+	out := [][]byte{}
+	for item := range a.Iter(context.Background(), pfx) {
+		out = append(out, item.Value)
+	}
+	return out, nil
+}
+
+func (a *ACL) PrintDebug(pfx string) error {
+	out := map[string]any{}
+	for item := range a.Iter(context.Background(), pfx) {
+		var val any
+		err := a.Encoding().DecodeValue(item.Value, &val)
+		if err != nil {
+			return err
+		}
+		out[item.Key] = internal.FixValue(val)
+	}
+	internal.PrintJSON(out)
+	return nil
+}
+
+// Tx runs fn in transaction of connection, principal needs Read permission on pfx to start it,
+// so transactions can't lock prefixes principal can't access. Operations in transaction are checked too.
+func (a *ACL) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
+	txPfx := a.Encoding().EncodeKey(pfx, "")
+	if txPfx != "" {
+		if err := a.check(txPfx, Read); err != nil {
+			return err
+		}
+	}
+
+	return a.policy.conn.Tx(pfx, func(inner storage.Transactioner) error {
+		return fn(&tx{Transactioner: inner, acl: a, pfx: txPfx})
+	})
+}
+
+// tx checks operations of transaction
+type tx struct {
+	storage.Transactioner
+	acl *ACL
+	pfx string
+}
+
+func (t *tx) Set(k string, v any, op ...storage.Option) error {
+	if err := t.acl.check(t.pfx+k, Write); err != nil {
+		return err
+	}
+	return t.Transactioner.Set(k, v, op...)
+}
+
+func (t *tx) Get(k string, v any) error {
+	if err := t.acl.check(t.pfx+k, Read); err != nil {
+		return err
+	}
+	return t.Transactioner.Get(k, v)
+}
+
+func (t *tx) Exists(k string) bool {
+	if err := t.acl.check(t.pfx+k, Read); err != nil {
+		return false
+	}
+	return t.Transactioner.Exists(k)
+}
+
+func (t *tx) Delete(k string) error {
+	if err := t.acl.check(t.pfx+k, Delete); err != nil {
+		return err
+	}
+	return t.Transactioner.Delete(k)
+}
+
+func (t *tx) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
+	return t.acl.iter(ctx, t.Transactioner, t.pfx, pfx)
+}
@@ -0,0 +1,395 @@
+package acl_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/engine/acl"
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+)
+
+var (
+	policy = internal.Must(acl.New(internal.Must(memory.New()), acl.Allow(acl.AnyPrincipal, "", acl.All)))
+	db     = policy.As("test")
+)
+
+func TestGetSet(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test2", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value not 1")
+	}
+
+	var two int
+	err = db.Get("test2", &two)
+	if err != nil {
+		t.Error(err)
+	}
+	if two != 2 {
+		t.Error("Value not 2")
+	}
+}
+
+func TestDeleteExists(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !db.Exists("test1") {
+		t.Log("Value not created")
+	}
+
+	err = db.Delete("test1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if db.Exists("test1") {
+		t.Log("Value not deleted")
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err == nil {
+		t.Error("Got value, expected error")
+	}
+	if val != 0 {
+		t.Error("Expected zero value")
+	}
+}
+
+func TestIter(t *testing.T) {
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	i := 0
+	for item := range helpers.Iter[rune](context.Background(), db) {
+		i++
+		switch item.Key {
+		case "one":
+			if item.Value != '1' {
+				t.Error("Value not 1")
+			}
+		case "two":
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+		default:
+			i--
+		}
+	}
+
+	if i < 2 {
+		t.Error("Not full iteration")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hit := make(chan struct{})
+
+	go func() {
+		for item := range helpers.Watch[rune](ctx, db, "two") {
+			if item.Event != types.PutEvent {
+				t.Error("Not Put Event")
+			}
+			if item.Key != "two" {
+				t.Error("Key not two")
+			}
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+			hit <- struct{}{}
+		}
+	}()
+
+	// Magic sleep
+	time.Sleep(1 * time.Second)
+
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts := time.NewTimer(3 * time.Second)
+	defer ts.Stop()
+
+	select {
+	case <-hit:
+	case <-ts.C:
+		t.Error("Change not found")
+	}
+}
+
+func TestLenKeyVals(t *testing.T) {
+	err := db.Set("test/one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test/two", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	length, err := db.Len("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if length < 2 {
+		t.Error("Len < 2")
+	}
+
+	keys, err := db.Keys("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(keys) < 2 {
+		t.Error("Keys Len < 2")
+	}
+
+	vals, err := db.Values("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(vals) < 2 {
+		t.Error("Vals Len < 2")
+	}
+}
+
+func TestTx(t *testing.T) {
+	const workers = 5
+	bucket := db.Bucket("tx")
+
+	err := bucket.Set("counter", 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := bucket.Tx(func(tx storage.Transactioner) error {
+				val, err := helpers.Get[int](tx, "counter")
+				if err != nil {
+					return err
+				}
+				return tx.Set("counter", val+1)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	val, err := helpers.Get[int](bucket, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != workers {
+		t.Error("Counter not", workers, "got", val)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	policy := internal.Must(acl.New(internal.Must(memory.New()),
+		acl.Allow("admin", "", acl.All),
+		acl.Allow(acl.AnyPrincipal, "tenant/*/config", acl.Read),
+		acl.Allow("user", "tenant/1", acl.ReadWrite),
+	))
+	defer policy.Close()
+
+	admin := policy.As("admin")
+	user := policy.As("user")
+	guest := policy.As("guest")
+
+	err := admin.Bucket("tenant", "2", "config").Set("name", "two")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = user.Bucket("tenant", "1").Set("name", "one")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = user.Bucket("tenant", "2", "config").Set("name", "2")
+	if !errors.Is(err, storage.ErrPermissionDenied) {
+		t.Error("Expected permission denied, got", err)
+	}
+
+	err = guest.Set("root", 0)
+	if !errors.Is(err, storage.ErrPermissionDenied) {
+		t.Error("Expected permission denied, got", err)
+	}
+
+	val, err := helpers.Get[string](guest.Bucket("tenant", "2", "config"), "name")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != "two" {
+		t.Error("Value not two")
+	}
+
+	_, err = helpers.Get[string](guest.Bucket("tenant", "1"), "name")
+	if !errors.Is(err, storage.ErrPermissionDenied) {
+		t.Error("Expected permission denied, got", err)
+	}
+
+	if guest.Exists(guest.Encoding().EncodeKey(guest.Encoding().EncodeBucket("tenant", "1"), "name")) {
+		t.Error("Unreadable key reported")
+	}
+
+	keys, err := guest.Keys("")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(keys) != 1 {
+		t.Error("Expected 1 readable key, got", keys)
+	}
+
+	n := 0
+	for range user.Iter(context.Background(), "") {
+		n++
+	}
+	if n != 2 {
+		t.Error("Expected 2 readable items, got", n)
+	}
+}
+
+func TestWatchPermission(t *testing.T) {
+	policy := internal.Must(acl.New(internal.Must(memory.New()),
+		acl.Allow("admin", "", acl.All),
+		acl.Allow("user", "public", acl.Read|acl.Watch),
+	))
+	defer policy.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := policy.As("user").Watch(ctx, "")
+
+	// Magic sleep
+	time.Sleep(100 * time.Millisecond)
+
+	admin := policy.As("admin")
+	err := admin.Bucket("private").Set("one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = admin.Bucket("public").Set("two", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	select {
+	case msg := <-events:
+		if msg.Key != admin.Encoding().EncodeKey(admin.Encoding().EncodeBucket("public"), "two") {
+			t.Error("Unexpected event", msg)
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("Change not found")
+	}
+}
+
+func TestTxPermission(t *testing.T) {
+	policy := internal.Must(acl.New(internal.Must(memory.New()),
+		acl.Allow("user", "tx", acl.Read),
+	))
+	defer policy.Close()
+
+	user := policy.As("user")
+	err := user.Bucket("tx").Tx(func(tx storage.Transactioner) error {
+		return tx.Set("counter", 1)
+	})
+	if !errors.Is(err, storage.ErrPermissionDenied) {
+		t.Error("Expected permission denied, got", err)
+	}
+	if user.Principal() != "user" {
+		t.Error("Unexpected principal", user.Principal())
+	}
+
+	// transaction isn't started on prefix principal can't read
+	called := false
+	err = user.Bucket("other").Tx(func(tx storage.Transactioner) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, storage.ErrPermissionDenied) || called {
+		t.Error("Expected permission denied before transaction, got", err, called)
+	}
+}
+
+func TestIncrPermission(t *testing.T) {
+	policy := internal.Must(acl.New(internal.Must(memory.New()),
+		acl.Allow("user", "counters", acl.ReadWrite),
+		acl.Allow("writer", "counters", acl.Write),
+	))
+	defer policy.Close()
+
+	n, err := policy.As("user").Bucket("counters").Incr("hits", 1)
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 1 {
+		t.Error("Expected 1, got", n)
+	}
+
+	// incremented value is returned, so write permission is not enough
+	_, err = policy.As("writer").Bucket("counters").Incr("hits", 1)
+	if !errors.Is(err, storage.ErrPermissionDenied) {
+		t.Error("Expected permission denied, got", err)
+	}
+
+	_, err = policy.As("user").IncrFloat("hits", 1)
+	if !errors.Is(err, storage.ErrPermissionDenied) {
+		t.Error("Expected permission denied, got", err)
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	policy.Close()
+	os.Exit(code)
+}
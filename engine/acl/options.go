@@ -0,0 +1,25 @@
+package acl
+
+import (
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/internal/keypath"
+)
+
+type PolicyOpts func(*Policy) error
+
+// Allow grants permissions to principal on buckets matching pattern, eg. "tenant/*/config".
+// "*" matches any bucket name, empty pattern grants permissions on whole database.
+// Principal "*" matches any principal.
+func Allow(principal, pattern string, perm Permission) PolicyOpts {
+	return func(p *Policy) error {
+		p.rules = append(p.rules, rule{principal: principal, pattern: keypath.Buckets(pattern), perm: perm})
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) PolicyOpts {
+	return func(p *Policy) error {
+		p.lg = lg
+		return nil
+	}
+}
@@ -0,0 +1,297 @@
+// Package audit wraps connection and records every mutation to sinks.
+//
+// Record contains key, actor, time, hashes of old and new value and options of write.
+// Actor is taken from context set with WithContext, principal of wrapped connection
+// (eg. acl connection) or Actor option. Writes in transaction are recorded after commit.
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/options"
+)
+
+var (
+	_ storage.Connection = (*Audit)(nil)
+
+	// ErrNotRecorded is returned when change was applied, but sink failed to record it
+	ErrNotRecorded = errors.New("audit: change not recorded")
+)
+
+const (
+	SetOp    = "set"
+	DeleteOp = "delete"
+	IncrOp   = "incr" // Old is hash of number before increment, missing key is counted as zero
+)
+
+// Record of single mutation
+type Record struct {
+	Time  time.Time `json:"time"`
+	Actor string    `json:"actor,omitempty"`
+	Op    string    `json:"op"`
+	Key   string    `json:"key"`
+	Old   string    `json:"old,omitempty"` // sha256 of old encoded value, empty when key didn't exist
+	New   string    `json:"new,omitempty"` // sha256 of new encoded value, empty for delete
+	TTL   string    `json:"ttl,omitempty"`
+	Tx    string    `json:"tx,omitempty"`    // id of transaction
+	Error string    `json:"error,omitempty"` // error of failed transaction, operation may be applied on engines without rollback
+}
+
+type actorKey struct{}
+
+// WithActor returns context with actor of changes
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns actor of context
+func ActorFrom(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return actor, ok
+}
+
+type Audit struct {
+	storage.Connection
+
+	sinks []Sink
+	actor string
+	ctx   context.Context
+
+	// Logger
+	lg storage.Logger
+}
+
+// New wraps conn and records mutations to sinks. Closing connection closes conn.
+func New(conn storage.Connection, opts ...AuditOpts) (*Audit, error) {
+	a := &Audit{
+		Connection: conn,
+		ctx:        context.Background(),
+		lg:         &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(a)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(a.sinks) == 0 {
+		return nil, errors.New("audit: sink not set. Use To option")
+	}
+
+	return a, nil
+}
+
+// WithContext returns connection recording actor of ctx, closing it closes underlying connection
+func (a *Audit) WithContext(ctx context.Context) *Audit {
+	c := *a
+	c.ctx = ctx
+	return &c
+}
+
+func (a *Audit) Bucket(bucket ...string) *storage.Bucket {
+	return storage.NewBucket(a, a.Encoding().DecodeBucket(bucket...)...)
+}
+
+// actorOf returns actor of changes
+func (a *Audit) actorOf() string {
+	if actor, ok := ActorFrom(a.ctx); ok {
+		return actor
+	}
+	if p, ok := a.Connection.(interface{ Principal() string }); ok {
+		return p.Principal()
+	}
+	return a.actor
+}
+
+// record returns record of change, old is encoded value before change
+func (a *Audit) record(op, k string, old, data []byte, opts []storage.Option) Record {
+	r := Record{
+		Time:  time.Now(),
+		Actor: a.actorOf(),
+		Op:    op,
+		Key:   k,
+		Old:   hash(old),
+		New:   hash(data),
+	}
+
+	for _, opt := range opts {
+		if ttl, ok := opt.(*options.TTLOption); ok {
+			r.TTL = ttl.Value.String()
+		}
+	}
+	return r
+}
+
+// write records to all sinks, change is already applied, so failure is reported as ErrNotRecorded
+func (a *Audit) write(records ...Record) error {
+	errs := []error{}
+	for _, sink := range a.sinks {
+		for _, r := range records {
+			err := sink.Write(r)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		a.lg.Error("audit", err)
+		return fmt.Errorf("%w: %w", ErrNotRecorded, err)
+	}
+	return nil
+}
+
+func hash(data []byte) string {
+	if data == nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// current returns encoded value of key, nil when key doesn't exist
+func current(g storage.Getter, k string) []byte {
+	var raw encoding.Raw
+	if g.Get(k, &raw) != nil {
+		return nil
+	}
+	return raw
+}
+
+func (a *Audit) Set(k string, v any, op ...storage.Option) error {
+	a.lg.Debug("SET", k, v)
+	data, err := a.Encoding().EncodeValue(v)
+	if err != nil {
+		return fmt.Errorf("encoder: %w", err)
+	}
+
+	old := current(a.Connection, k)
+	err = a.Connection.Set(k, encoding.Raw(data), op...)
+	if err != nil {
+		return err
+	}
+	return a.write(a.record(SetOp, k, old, data, op))
+}
+
+func (a *Audit) Delete(k string) error {
+	a.lg.Debug("DELETE", k)
+	old := current(a.Connection, k)
+	err := a.Connection.Delete(k)
+	if err != nil {
+		return err
+	}
+	return a.write(a.record(DeleteOp, k, old, nil, nil))
+}
+
+func (a *Audit) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	a.lg.Debug("INCR", k, delta)
+	return incr(a, k, delta, op, func() (int64, error) {
+		return a.Connection.Incr(k, delta, op...)
+	})
+}
+
+func (a *Audit) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	a.lg.Debug("INCRFLOAT", k, delta)
+	return incr(a, k, delta, op, func() (float64, error) {
+		return a.Connection.IncrFloat(k, delta, op...)
+	})
+}
+
+// incr records increment, values before and after increment are encoded from result
+func incr[T internal.Number](a *Audit, k string, delta T, op []storage.Option, fn func() (T, error)) (T, error) {
+	n, err := fn()
+	if err != nil {
+		return n, err
+	}
+
+	old, err := a.Encoding().EncodeValue(n - delta)
+	if err != nil {
+		return n, fmt.Errorf("encoder: %w", err)
+	}
+	data, err := a.Encoding().EncodeValue(n)
+	if err != nil {
+		return n, fmt.Errorf("encoder: %w", err)
+	}
+	return n, a.write(a.record(IncrOp, k, old, data, op))
+}
+
+// Tx runs fn in transaction of connection, writes are recorded after commit with id of transaction
+func (a *Audit) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
+	a.lg.Debug("TX", pfx)
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	var t *tx
+	err := a.Connection.Tx(pfx, func(inner storage.Transactioner) error {
+		t = &tx{
+			Transactioner: inner,
+			audit:         a,
+			pfx:           a.Encoding().EncodeKey(pfx, ""),
+			id:            hex.EncodeToString(id),
+		}
+		return fn(t)
+	})
+	if err != nil {
+		// engines without rollback keep operations applied before failure, so they are recorded too
+		if t == nil || len(t.records) == 0 {
+			return err
+		}
+		for i := range t.records {
+			t.records[i].Error = err.Error()
+		}
+		return errors.Join(err, a.write(t.records...))
+	}
+	return a.write(t.records...)
+}
+
+// tx collects records of transaction
+type tx struct {
+	storage.Transactioner
+	audit   *Audit
+	pfx     string
+	id      string
+	records []Record
+}
+
+func (t *tx) Set(k string, v any, op ...storage.Option) error {
+	data, err := t.Encoding().EncodeValue(v)
+	if err != nil {
+		return fmt.Errorf("encoder: %w", err)
+	}
+
+	old := current(t.Transactioner, k)
+	err = t.Transactioner.Set(k, encoding.Raw(data), op...)
+	if err != nil {
+		return err
+	}
+
+	r := t.audit.record(SetOp, t.pfx+k, old, data, op)
+	r.Tx = t.id
+	t.records = append(t.records, r)
+	return nil
+}
+
+func (t *tx) Delete(k string) error {
+	old := current(t.Transactioner, k)
+	err := t.Transactioner.Delete(k)
+	if err != nil {
+		return err
+	}
+
+	r := t.audit.record(DeleteOp, t.pfx+k, old, nil, nil)
+	r.Tx = t.id
+	t.records = append(t.records, r)
+	return nil
+}
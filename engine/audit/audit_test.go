@@ -0,0 +1,468 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/engine/acl"
+	"github.com/rafalb8/go-storage/engine/audit"
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/options"
+)
+
+var (
+	db = internal.Must(audit.New(internal.Must(memory.New()), audit.To(audit.SinkFunc(func(r audit.Record) error { return nil }))))
+)
+
+func TestGetSet(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test2", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value not 1")
+	}
+
+	var two int
+	err = db.Get("test2", &two)
+	if err != nil {
+		t.Error(err)
+	}
+	if two != 2 {
+		t.Error("Value not 2")
+	}
+}
+
+func TestDeleteExists(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !db.Exists("test1") {
+		t.Log("Value not created")
+	}
+
+	err = db.Delete("test1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if db.Exists("test1") {
+		t.Log("Value not deleted")
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err == nil {
+		t.Error("Got value, expected error")
+	}
+	if val != 0 {
+		t.Error("Expected zero value")
+	}
+}
+
+func TestIter(t *testing.T) {
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	i := 0
+	for item := range helpers.Iter[rune](context.Background(), db) {
+		i++
+		switch item.Key {
+		case "one":
+			if item.Value != '1' {
+				t.Error("Value not 1")
+			}
+		case "two":
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+		default:
+			i--
+		}
+	}
+
+	if i < 2 {
+		t.Error("Not full iteration")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hit := make(chan struct{})
+
+	go func() {
+		for item := range helpers.Watch[rune](ctx, db, "two") {
+			if item.Event != types.PutEvent {
+				t.Error("Not Put Event")
+			}
+			if item.Key != "two" {
+				t.Error("Key not two")
+			}
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+			hit <- struct{}{}
+		}
+	}()
+
+	// Magic sleep
+	time.Sleep(1 * time.Second)
+
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts := time.NewTimer(3 * time.Second)
+	defer ts.Stop()
+
+	select {
+	case <-hit:
+	case <-ts.C:
+		t.Error("Change not found")
+	}
+}
+
+func TestLenKeyVals(t *testing.T) {
+	err := db.Set("test/one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test/two", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	length, err := db.Len("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if length < 2 {
+		t.Error("Len < 2")
+	}
+
+	keys, err := db.Keys("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(keys) < 2 {
+		t.Error("Keys Len < 2")
+	}
+
+	vals, err := db.Values("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(vals) < 2 {
+		t.Error("Vals Len < 2")
+	}
+}
+
+func TestTx(t *testing.T) {
+	const workers = 5
+	bucket := db.Bucket("tx")
+
+	err := bucket.Set("counter", 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := bucket.Tx(func(tx storage.Transactioner) error {
+				val, err := helpers.Get[int](tx, "counter")
+				if err != nil {
+					return err
+				}
+				return tx.Set("counter", val+1)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	val, err := helpers.Get[int](bucket, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != workers {
+		t.Error("Counter not", workers, "got", val)
+	}
+}
+
+// recorder collects records
+type recorder struct {
+	mtx     sync.Mutex
+	records []audit.Record
+}
+
+func (r *recorder) Write(record audit.Record) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.records = append(r.records, record)
+	return nil
+}
+
+func TestRecords(t *testing.T) {
+	rec := &recorder{}
+	a := internal.Must(audit.New(internal.Must(memory.New()), audit.To(rec), audit.Actor("system")))
+	defer a.Close()
+
+	err := a.Set("one", 1, options.TTL(time.Minute))
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = a.WithContext(audit.WithActor(context.Background(), "alice")).Set("one", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = a.Delete("one")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(rec.records) != 3 {
+		t.Fatal("Expected 3 records, got", len(rec.records))
+	}
+
+	first, second, third := rec.records[0], rec.records[1], rec.records[2]
+	if first.Op != audit.SetOp || first.Actor != "system" || first.Key != "one" || first.TTL != "1m0s" {
+		t.Error("Unexpected record", first)
+	}
+	if first.Old != "" || first.New == "" {
+		t.Error("Unexpected hashes", first)
+	}
+	if second.Actor != "alice" || second.Old != first.New || second.New == first.New {
+		t.Error("Unexpected record", second)
+	}
+	if third.Op != audit.DeleteOp || third.Old != second.New || third.New != "" {
+		t.Error("Unexpected record", third)
+	}
+}
+
+func TestTxRecords(t *testing.T) {
+	rec := &recorder{}
+	a := internal.Must(audit.New(internal.Must(memory.New()), audit.To(rec)))
+	defer a.Close()
+
+	err := a.Bucket("tx").Tx(func(tx storage.Transactioner) error {
+		err := tx.Set("one", 1)
+		if err != nil {
+			return err
+		}
+		return tx.Set("two", 2)
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// memory doesn't roll back, so applied operation of failed transaction is recorded with error
+	failed := errors.New("failed")
+	err = a.Bucket("tx").Tx(func(tx storage.Transactioner) error {
+		tx.Set("three", 3)
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Error("Expected failed, got", err)
+	}
+
+	if len(rec.records) != 3 {
+		t.Fatal("Expected 3 records, got", len(rec.records))
+	}
+	if rec.records[0].Tx == "" || rec.records[0].Tx != rec.records[1].Tx {
+		t.Error("Records not grouped by transaction", rec.records)
+	}
+	if rec.records[1].Key != a.Encoding().EncodeKey(a.Encoding().EncodeBucket("tx"), "two") {
+		t.Error("Unexpected key", rec.records[1].Key)
+	}
+	if rec.records[1].Error != "" {
+		t.Error("Unexpected error of committed record", rec.records[1].Error)
+	}
+	if rec.records[2].Error != failed.Error() || rec.records[2].Tx == rec.records[1].Tx {
+		t.Error("Unexpected record of failed transaction", rec.records[2])
+	}
+}
+
+func TestPrincipal(t *testing.T) {
+	rec := &recorder{}
+	policy := internal.Must(acl.New(internal.Must(memory.New()), acl.Allow(acl.AnyPrincipal, "", acl.All)))
+	defer policy.Close()
+
+	a := internal.Must(audit.New(policy.As("bob"), audit.To(rec)))
+	err := a.Set("one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(rec.records) != 1 || rec.records[0].Actor != "bob" {
+		t.Error("Principal not recorded", rec.records)
+	}
+}
+
+func TestSinks(t *testing.T) {
+	conn := internal.Must(memory.New())
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	file := internal.Must(audit.NewFileSink(path))
+
+	a := internal.Must(audit.New(conn, audit.To(file), audit.To(audit.NewBucketSink(conn.Bucket(".audit")))))
+	defer a.Close()
+
+	for i := 0; i < 3; i++ {
+		err := a.Set("key", i)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	err := file.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Error("Expected 3 lines, got", len(lines))
+	}
+
+	record := audit.Record{}
+	err = json.Unmarshal([]byte(lines[0]), &record)
+	if err != nil {
+		t.Error(err)
+	}
+	if record.Key != "key" || record.Op != audit.SetOp {
+		t.Error("Unexpected record", record)
+	}
+
+	records, err := helpers.Values[audit.Record](conn.Bucket(".audit"))
+	if err != nil {
+		t.Error(err)
+	}
+	if len(records) != 3 {
+		t.Error("Expected 3 stored records, got", len(records))
+	}
+}
+
+func TestSharedBucketSink(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+
+	// sinks of two processes write records of the same time
+	r := audit.Record{Time: time.Now(), Op: audit.SetOp, Key: "key"}
+	for _, sink := range []*audit.BucketSink{audit.NewBucketSink(conn.Bucket(".audit")), audit.NewBucketSink(conn.Bucket(".audit"))} {
+		err := sink.Write(r)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	n, err := conn.Bucket(".audit").Len()
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 2 {
+		t.Error("Expected 2 stored records, got", n)
+	}
+}
+
+func TestSinkError(t *testing.T) {
+	conn := internal.Must(memory.New())
+	a := internal.Must(audit.New(conn, audit.To(audit.SinkFunc(func(r audit.Record) error {
+		return errors.New("sink down")
+	}))))
+	defer a.Close()
+
+	// change is applied, failure of sink is distinguishable
+	err := a.Set("key", 1)
+	if !errors.Is(err, audit.ErrNotRecorded) {
+		t.Error("Expected ErrNotRecorded, got", err)
+	}
+	if !conn.Exists("key") {
+		t.Error("Change not applied")
+	}
+}
+
+func TestIncrRecords(t *testing.T) {
+	rec := &recorder{}
+	a := internal.Must(audit.New(internal.Must(memory.New()), audit.To(rec)))
+	defer a.Close()
+
+	err := a.Set("counter", 5)
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = a.Incr("counter", 2, options.TTL(time.Minute))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(rec.records) != 2 {
+		t.Fatal("Expected 2 records, got", len(rec.records))
+	}
+
+	set, incr := rec.records[0], rec.records[1]
+	if incr.Op != audit.IncrOp || incr.Key != "counter" || incr.TTL != "1m0s" {
+		t.Error("Unexpected record", incr)
+	}
+	if incr.Old != set.New || incr.New == set.New {
+		t.Error("Unexpected hashes", incr)
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	db.Close()
+	os.Exit(code)
+}
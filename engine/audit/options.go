@@ -0,0 +1,35 @@
+package audit
+
+import (
+	"errors"
+
+	"github.com/rafalb8/go-storage"
+)
+
+type AuditOpts func(*Audit) error
+
+// To adds sink of records, records are written to every sink
+func To(sink Sink) AuditOpts {
+	return func(a *Audit) error {
+		if sink == nil {
+			return errors.New("audit: nil sink")
+		}
+		a.sinks = append(a.sinks, sink)
+		return nil
+	}
+}
+
+// Actor used when context has no actor and connection has no principal
+func Actor(actor string) AuditOpts {
+	return func(a *Audit) error {
+		a.actor = actor
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) AuditOpts {
+	return func(a *Audit) error {
+		a.lg = lg
+		return nil
+	}
+}
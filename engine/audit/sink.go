@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/rafalb8/go-storage"
+)
+
+// Sink stores audit records
+type Sink interface {
+	Write(r Record) error
+}
+
+// SinkFunc calls function with every record
+type SinkFunc func(r Record) error
+
+func (fn SinkFunc) Write(r Record) error {
+	return fn(r)
+}
+
+// BucketSink stores records in bucket, keys are ordered by time of change.
+// Keys contain random id of sink, so sinks of multiple processes can share bucket.
+// Bucket should be created from unaudited connection, eg. conn.Bucket(".audit").
+type BucketSink struct {
+	bucket *storage.Bucket
+	id     string
+
+	mtx  sync.Mutex
+	last int64
+	seq  int
+}
+
+func NewBucketSink(bucket *storage.Bucket) *BucketSink {
+	id := make([]byte, 4)
+	rand.Read(id)
+	return &BucketSink{bucket: bucket, id: hex.EncodeToString(id)}
+}
+
+func (s *BucketSink) Write(r Record) error {
+	s.mtx.Lock()
+	ts := r.Time.UnixNano()
+	if ts == s.last {
+		s.seq++
+	} else {
+		s.last, s.seq = ts, 0
+	}
+	key := fmt.Sprintf("%020d-%s-%04d", ts, s.id, s.seq)
+	s.mtx.Unlock()
+
+	return s.bucket.Set(key, r)
+}
+
+// FileSink appends records to file as JSON lines
+type FileSink struct {
+	mtx  sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	return &FileSink{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (s *FileSink) Write(r Record) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.enc.Encode(r)
+}
+
+func (s *FileSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,319 @@
+// Package buffered wraps connection with write-behind buffer.
+//
+// Set and Delete are stored in local buffer and written to the connection on interval or when
+// buffer is full. Repeated writes of the same key are coalesced, so only the last one is written.
+// Get and Exists see buffered writes, Iter, Keys, Values, Len and Tx flush buffer first.
+// Incr is not buffered, buffer is flushed first when key has buffered write.
+// TTL of buffered write is counted from Set, not from flush.
+// Watch reports changes after they are flushed.
+package buffered
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/options"
+)
+
+var (
+	_ storage.Connection = (*Buffered)(nil)
+
+	// ErrClosed is returned by writes after connection was closed
+	ErrClosed = errors.New("buffered: connection closed")
+)
+
+// buffered write
+type write struct {
+	data    []byte
+	ops     []storage.Option
+	expires time.Time // deadline of TTL given to Set
+	delete  bool
+}
+
+// expired reports whether TTL of write passed before it was flushed
+func (w write) expired() bool {
+	return !w.expires.IsZero() && !time.Now().Before(w.expires)
+}
+
+// options of write with TTL remaining until its deadline
+func (w write) options() []storage.Option {
+	if w.expires.IsZero() {
+		return w.ops
+	}
+	return append(w.ops[:len(w.ops):len(w.ops)], options.TTL(time.Until(w.expires)))
+}
+
+type Buffered struct {
+	storage.Connection
+
+	interval   time.Duration
+	maxPending int
+
+	mtx      sync.Mutex
+	pending  map[string]write
+	flushing map[string]write // writes of running flush
+	closed   bool
+
+	flushMtx sync.Mutex
+
+	// flush loop
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Logger
+	lg storage.Logger
+}
+
+// New wraps conn with write buffer. Closing connection flushes buffer and closes conn.
+func New(conn storage.Connection, opts ...BufferedOpts) (*Buffered, error) {
+	b := &Buffered{
+		Connection: conn,
+		interval:   time.Second,
+		maxPending: 1000,
+		pending:    map[string]write{},
+		flushing:   map[string]write{},
+		done:       make(chan struct{}),
+		lg:         &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ctx context.Context
+	ctx, b.cancel = context.WithCancel(context.Background())
+	go b.loop(ctx)
+
+	return b, nil
+}
+
+func (b *Buffered) loop(ctx context.Context) {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := b.Flush()
+		if err != nil {
+			b.lg.Error("flush", err)
+		}
+	}
+}
+
+// Close flushes pending writes and closes connection, later writes return ErrClosed
+func (b *Buffered) Close() {
+	b.cancel()
+	<-b.done
+
+	b.mtx.Lock()
+	b.closed = true
+	b.mtx.Unlock()
+
+	err := b.Flush()
+	if err != nil {
+		b.lg.Error("flush", err)
+	}
+	b.Connection.Close()
+}
+
+// Flush writes pending writes to connection. Failed writes are kept and retried with next flush.
+func (b *Buffered) Flush() error {
+	b.flushMtx.Lock()
+	defer b.flushMtx.Unlock()
+
+	b.mtx.Lock()
+	pending := b.pending
+	b.pending = map[string]write{}
+	b.flushing = pending
+	b.mtx.Unlock()
+
+	errs := []error{}
+	for k, w := range pending {
+		var err error
+		if w.delete || w.expired() {
+			err = b.Connection.Delete(k)
+		} else {
+			err = b.Connection.Set(k, encoding.Raw(w.data), w.options()...)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", k, err))
+
+			b.mtx.Lock()
+			// newer write replaces failed one
+			if _, exists := b.pending[k]; !exists {
+				b.pending[k] = w
+			}
+			b.mtx.Unlock()
+		}
+	}
+
+	b.mtx.Lock()
+	b.flushing = map[string]write{}
+	b.mtx.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// Pending returns number of buffered writes
+func (b *Buffered) Pending() int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return len(b.pending)
+}
+
+// buffer write, buffer is flushed when full
+func (b *Buffered) buffer(k string, w write) error {
+	b.mtx.Lock()
+	if b.closed {
+		b.mtx.Unlock()
+		return fmt.Errorf("write %s: %w", k, ErrClosed)
+	}
+	b.pending[k] = w
+	full := len(b.pending) >= b.maxPending
+	b.mtx.Unlock()
+
+	if !full {
+		return nil
+	}
+
+	err := b.Flush()
+	if err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+	return nil
+}
+
+// buffered returns buffered write of key
+func (b *Buffered) buffered(k string) (write, bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if w, exists := b.pending[k]; exists {
+		return w, true
+	}
+	w, exists := b.flushing[k]
+	return w, exists
+}
+
+// flush before reading from connection
+func (b *Buffered) flush() {
+	err := b.Flush()
+	if err != nil {
+		b.lg.Error("flush", err)
+	}
+}
+
+func (b *Buffered) Bucket(bucket ...string) *storage.Bucket {
+	return storage.NewBucket(b, b.Encoding().DecodeBucket(bucket...)...)
+}
+
+func (b *Buffered) Set(k string, v any, op ...storage.Option) error {
+	b.lg.Debug("SET", k, v)
+	data, err := b.Encoding().EncodeValue(v)
+	if err != nil {
+		return fmt.Errorf("encoder: %w", err)
+	}
+
+	w := write{data: data}
+	for _, opt := range op {
+		if ttl, ok := opt.(*options.TTLOption); ok && ttl.Value > 0 {
+			w.expires = time.Now().Add(ttl.Value)
+			continue
+		}
+		w.ops = append(w.ops, opt)
+	}
+	return b.buffer(k, w)
+}
+
+func (b *Buffered) Get(k string, v any) error {
+	b.lg.Debug("GET", k)
+	w, exists := b.buffered(k)
+	if !exists {
+		return b.Connection.Get(k, v)
+	}
+
+	if w.delete || w.expired() {
+		return fmt.Errorf("get %s: %w", k, storage.ErrNotFound)
+	}
+	return b.Encoding().DecodeValue(w.data, v)
+}
+
+func (b *Buffered) Exists(k string) bool {
+	b.lg.Debug("EXISTS", k)
+	w, exists := b.buffered(k)
+	if !exists {
+		return b.Connection.Exists(k)
+	}
+	return !w.delete && !w.expired()
+}
+
+func (b *Buffered) Delete(k string) error {
+	b.lg.Debug("DELETE", k)
+	return b.buffer(k, write{delete: true})
+}
+
+func (b *Buffered) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	b.lg.Debug("INCR", k, delta)
+	if _, exists := b.buffered(k); exists {
+		b.flush()
+	}
+	return b.Connection.Incr(k, delta, op...)
+}
+
+func (b *Buffered) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	b.lg.Debug("INCRFLOAT", k, delta)
+	if _, exists := b.buffered(k); exists {
+		b.flush()
+	}
+	return b.Connection.IncrFloat(k, delta, op...)
+}
+
+func (b *Buffered) Len(pfx string) (int, error) {
+	b.flush()
+	return b.Connection.Len(pfx)
+}
+
+func (b *Buffered) Keys(pfx string) ([]string, error) {
+	b.flush()
+	return b.Connection.Keys(pfx)
+}
+
+func (b *Buffered) Values(pfx string) ([][]byte, error) {
+	b.flush()
+	return b.Connection.Values(pfx)
+}
+
+func (b *Buffered) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
+	b.flush()
+	return b.Connection.Iter(ctx, pfx)
+}
+
+func (b *Buffered) PrintDebug(pfx string) error {
+	b.flush()
+	return b.Connection.PrintDebug(pfx)
+}
+
+// Tx flushes buffer and runs fn in transaction of connection, writes in transaction are not buffered
+func (b *Buffered) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
+	b.flush()
+	return b.Connection.Tx(pfx, fn)
+}
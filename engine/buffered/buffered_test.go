@@ -0,0 +1,474 @@
+package buffered_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/engine/buffered"
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/options"
+)
+
+var (
+	db = internal.Must(buffered.New(internal.Must(memory.New()), buffered.Interval(100*time.Millisecond)))
+)
+
+func TestGetSet(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test2", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value not 1")
+	}
+
+	var two int
+	err = db.Get("test2", &two)
+	if err != nil {
+		t.Error(err)
+	}
+	if two != 2 {
+		t.Error("Value not 2")
+	}
+}
+
+func TestDeleteExists(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !db.Exists("test1") {
+		t.Log("Value not created")
+	}
+
+	err = db.Delete("test1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if db.Exists("test1") {
+		t.Log("Value not deleted")
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err == nil {
+		t.Error("Got value, expected error")
+	}
+	if val != 0 {
+		t.Error("Expected zero value")
+	}
+}
+
+func TestIter(t *testing.T) {
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	i := 0
+	for item := range helpers.Iter[rune](context.Background(), db) {
+		i++
+		switch item.Key {
+		case "one":
+			if item.Value != '1' {
+				t.Error("Value not 1")
+			}
+		case "two":
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+		default:
+			i--
+		}
+	}
+
+	if i < 2 {
+		t.Error("Not full iteration")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hit := make(chan struct{})
+
+	go func() {
+		for item := range helpers.Watch[rune](ctx, db, "two") {
+			if item.Event != types.PutEvent {
+				t.Error("Not Put Event")
+			}
+			if item.Key != "two" {
+				t.Error("Key not two")
+			}
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+			hit <- struct{}{}
+		}
+	}()
+
+	// Magic sleep
+	time.Sleep(1 * time.Second)
+
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts := time.NewTimer(3 * time.Second)
+	defer ts.Stop()
+
+	select {
+	case <-hit:
+	case <-ts.C:
+		t.Error("Change not found")
+	}
+}
+
+func TestLenKeyVals(t *testing.T) {
+	err := db.Set("test/one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test/two", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	length, err := db.Len("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if length < 2 {
+		t.Error("Len < 2")
+	}
+
+	keys, err := db.Keys("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(keys) < 2 {
+		t.Error("Keys Len < 2")
+	}
+
+	vals, err := db.Values("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(vals) < 2 {
+		t.Error("Vals Len < 2")
+	}
+}
+
+func TestTx(t *testing.T) {
+	const workers = 5
+	bucket := db.Bucket("tx")
+
+	err := bucket.Set("counter", 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := bucket.Tx(func(tx storage.Transactioner) error {
+				val, err := helpers.Get[int](tx, "counter")
+				if err != nil {
+					return err
+				}
+				return tx.Set("counter", val+1)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	val, err := helpers.Get[int](bucket, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != workers {
+		t.Error("Counter not", workers, "got", val)
+	}
+}
+
+// counter counts Set calls of connection
+type counter struct {
+	storage.Connection
+
+	mtx  sync.Mutex
+	sets int
+}
+
+func (c *counter) Set(k string, v any, op ...storage.Option) error {
+	c.mtx.Lock()
+	c.sets++
+	c.mtx.Unlock()
+	return c.Connection.Set(k, v, op...)
+}
+
+func (c *counter) count() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.sets
+}
+
+func TestCoalesce(t *testing.T) {
+	conn := &counter{Connection: internal.Must(memory.New())}
+	b := internal.Must(buffered.New(conn, buffered.Interval(time.Hour)))
+	defer b.Close()
+
+	for i := 1; i <= 100; i++ {
+		err := b.Set("status", i)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	val, err := helpers.Get[int](b, "status")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 100 {
+		t.Error("Value not 100")
+	}
+
+	if conn.Exists("status") {
+		t.Error("Value written before flush")
+	}
+
+	err = b.Flush()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if conn.count() != 1 {
+		t.Error("Expected 1 set, got", conn.count())
+	}
+
+	val, err = helpers.Get[int](conn, "status")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 100 {
+		t.Error("Value not 100")
+	}
+
+	err = b.Delete("status")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if b.Exists("status") {
+		t.Error("Value not deleted")
+	}
+
+	_, err = helpers.Get[int](b, "status")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Error("Expected not found, got", err)
+	}
+
+	err = b.Flush()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if conn.Exists("status") {
+		t.Error("Delete not flushed")
+	}
+}
+
+func TestMaxPending(t *testing.T) {
+	conn := &counter{Connection: internal.Must(memory.New())}
+	b := internal.Must(buffered.New(conn, buffered.Interval(time.Hour), buffered.MaxPending(2)))
+	defer b.Close()
+
+	err := b.Set("one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if b.Pending() != 1 {
+		t.Error("Expected 1 pending, got", b.Pending())
+	}
+
+	err = b.Set("two", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if b.Pending() != 0 || conn.count() != 2 {
+		t.Error("Buffer not flushed")
+	}
+}
+
+func TestClose(t *testing.T) {
+	conn := internal.Must(memory.New())
+	b := internal.Must(buffered.New(conn, buffered.Interval(time.Hour)))
+
+	err := b.Set("close", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	b.Close()
+
+	val, err := helpers.Get[int](conn, "close")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value not flushed on close")
+	}
+
+	err = b.Set("close", 2)
+	if !errors.Is(err, buffered.ErrClosed) {
+		t.Error("Expected ErrClosed, got", err)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	conn := internal.Must(memory.New())
+	b := internal.Must(buffered.New(conn, buffered.Interval(time.Hour)))
+	defer b.Close()
+
+	err := b.Set("ttl", 1, options.TTL(200*time.Millisecond))
+	if err != nil {
+		t.Error(err)
+	}
+
+	// TTL is counted from Set, not from flush
+	time.Sleep(100 * time.Millisecond)
+	err = b.Flush()
+	if err != nil {
+		t.Error(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if conn.Exists("ttl") {
+		t.Error("Key not expired")
+	}
+
+	// write expired before flush is not written
+	err = b.Set("expired", 1, options.TTL(50*time.Millisecond))
+	if err != nil {
+		t.Error(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if b.Exists("expired") {
+		t.Error("Buffered write not expired")
+	}
+	err = b.Flush()
+	if err != nil {
+		t.Error(err)
+	}
+	if conn.Exists("expired") {
+		t.Error("Expired write flushed")
+	}
+}
+
+func TestOptions(t *testing.T) {
+	_, err := buffered.New(internal.Must(memory.New()), buffered.Interval(0))
+	if err == nil {
+		t.Error("Expected error of zero interval")
+	}
+}
+
+func TestIncr(t *testing.T) {
+	db.Delete("counter")
+	db.Delete("float")
+
+	for i := int64(1); i <= 3; i++ {
+		n, err := db.Incr("counter", 1)
+		if err != nil {
+			t.Error(err)
+		}
+		if n != i {
+			t.Error("Expected", i, "got", n)
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := db.Incr("counter", 1)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := helpers.Get[int64](db, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 103 {
+		t.Error("Lost increments, expected 103, got", n)
+	}
+
+	_, err = db.IncrFloat("float", 1.5)
+	if err != nil {
+		t.Error(err)
+	}
+	f, err := db.IncrFloat("float", -0.25)
+	if err != nil {
+		t.Error(err)
+	}
+	if f != 1.25 {
+		t.Error("Expected 1.25, got", f)
+	}
+
+	_, err = db.Incr("float", 1)
+	if err == nil {
+		t.Error("Expected error incrementing float by integer")
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	db.Close()
+	os.Exit(code)
+}
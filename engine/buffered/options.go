@@ -0,0 +1,39 @@
+package buffered
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+)
+
+type BufferedOpts func(*Buffered) error
+
+// Interval of flushing pending writes, default 1s
+func Interval(interval time.Duration) BufferedOpts {
+	return func(b *Buffered) error {
+		if interval <= 0 {
+			return errors.New("buffered: interval must be positive")
+		}
+		b.interval = interval
+		return nil
+	}
+}
+
+// Max number of pending keys, writes are flushed when reached, default 1000
+func MaxPending(n int) BufferedOpts {
+	return func(b *Buffered) error {
+		if n <= 0 {
+			return errors.New("buffered: max pending must be positive")
+		}
+		b.maxPending = n
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) BufferedOpts {
+	return func(b *Buffered) error {
+		b.lg = lg
+		return nil
+	}
+}
@@ -0,0 +1,279 @@
+// Package cache wraps connection with local read-through LRU cache of encoded values.
+//
+// Cached prefixes are watched, so values changed by other clients are invalidated as soon as
+// the underlying engine reports the change. Missing keys are cached too.
+// Cache works only with coders created by encoding.NewCoder.
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/internal"
+)
+
+var (
+	_ storage.Connection = (*Cache)(nil)
+)
+
+// delay before watch of prefix is restarted
+const rewatchDelay = time.Second
+
+type Cache struct {
+	storage.Connection
+
+	maxEntries int
+	maxBytes   int
+	prefixes   []string
+
+	mtx  sync.Mutex
+	lru  *lru
+	live map[string]bool // prefixes with running watch
+
+	// invalidation of values fetched concurrently with change
+	seq     uint64            // number of invalidations
+	reset   uint64            // seq of last invalidation of multiple keys
+	changed map[string]uint64 // seq of last invalidation of key, kept while fills are running
+	fills   int
+
+	hits   uint64
+	misses uint64
+
+	// context
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Logger
+	lg storage.Logger
+}
+
+// Cache statistics
+type Stats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+	Bytes   int
+}
+
+// New wraps conn with cache. Closing cache closes conn.
+func New(conn storage.Connection, opts ...CacheOpts) (*Cache, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := &Cache{
+		Connection: conn,
+		maxEntries: 10000,
+		prefixes:   []string{""},
+		live:       map[string]bool{},
+		changed:    map[string]uint64{},
+		ctx:        ctx,
+		cancel:     cancel,
+		lg:         &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(c)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	c.lru = newLRU(c.maxEntries, c.maxBytes)
+	for _, pfx := range c.prefixes {
+		c.live[pfx] = true
+		go c.watch(pfx, conn.Watch(ctx, pfx))
+	}
+
+	return c, nil
+}
+
+// Close stops watches, drops cached entries and closes conn
+func (c *Cache) Close() {
+	c.cancel()
+
+	// entries can't be invalidated anymore
+	c.mtx.Lock()
+	c.lru.clear()
+	c.mtx.Unlock()
+
+	c.Connection.Close()
+}
+
+func (c *Cache) Bucket(bucket ...string) *storage.Bucket {
+	return storage.NewBucket(c, c.Encoding().DecodeBucket(bucket...)...)
+}
+
+// Stats returns cache statistics
+func (c *Cache) Stats() Stats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return Stats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Entries: c.lru.order.Len(),
+		Bytes:   c.lru.bytes,
+	}
+}
+
+// watch invalidates changed keys, watch is restarted when it ends before cache is closed
+func (c *Cache) watch(pfx string, events types.Watcher[string, []byte]) {
+	for {
+		for msg := range events {
+			c.invalidate(msg.Key)
+		}
+
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		// changes can be missed until watch is restarted
+		c.lg.Warn("cache: watch ended", pfx)
+		c.mtx.Lock()
+		c.live[pfx] = false
+		c.invalidatePrefix(pfx)
+		c.mtx.Unlock()
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(rewatchDelay):
+		}
+
+		events = c.Connection.Watch(c.ctx, pfx)
+		c.mtx.Lock()
+		c.live[pfx] = true
+		c.mtx.Unlock()
+	}
+}
+
+// cacheable reports whether key is in watched prefix
+func (c *Cache) cacheable(k string) bool {
+	for pfx, live := range c.live {
+		if live && strings.HasPrefix(k, pfx) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cache) invalidate(k string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.seq++
+	c.lru.remove(k)
+	if c.fills > 0 {
+		c.changed[k] = c.seq
+	}
+}
+
+// invalidatePrefix must be called with mtx locked
+func (c *Cache) invalidatePrefix(pfx string) {
+	c.seq++
+	c.reset = c.seq
+	c.lru.removePrefix(pfx)
+}
+
+// lookup returns cached entry, missing entry is fetched from connection
+func (c *Cache) lookup(k string) (*entry, error) {
+	c.mtx.Lock()
+	if e, exists := c.lru.get(k); exists {
+		c.hits++
+		c.mtx.Unlock()
+		return e, nil
+	}
+
+	c.misses++
+	cacheable := c.cacheable(k)
+	start := c.seq
+	c.fills++
+	c.mtx.Unlock()
+
+	var raw encoding.Raw
+	err := c.Connection.Get(k, &raw)
+	e := &entry{key: k, value: raw, found: err == nil}
+	if errors.Is(err, storage.ErrNotFound) {
+		err = nil
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.fills--
+	// value is stale when key was changed while fetching
+	if err == nil && cacheable && start >= c.reset && c.changed[k] <= start {
+		c.lru.add(e)
+	}
+	if c.fills == 0 {
+		c.changed = map[string]uint64{}
+	}
+
+	return e, err
+}
+
+func (c *Cache) Get(k string, v any) error {
+	c.lg.Debug("GET", k)
+	e, err := c.lookup(k)
+	if err != nil {
+		return err
+	}
+
+	if !e.found {
+		return fmt.Errorf("get %s: %w", k, storage.ErrNotFound)
+	}
+	return c.Encoding().DecodeValue(e.value, v)
+}
+
+func (c *Cache) Exists(k string) bool {
+	c.lg.Debug("EXISTS", k)
+	e, err := c.lookup(k)
+	if err != nil {
+		c.lg.Error(err)
+		return false
+	}
+	return e.found
+}
+
+func (c *Cache) Set(k string, v any, op ...storage.Option) error {
+	c.lg.Debug("SET", k, v)
+	defer c.invalidate(k)
+	return c.Connection.Set(k, v, op...)
+}
+
+func (c *Cache) Delete(k string) error {
+	c.lg.Debug("DELETE", k)
+	defer c.invalidate(k)
+	return c.Connection.Delete(k)
+}
+
+func (c *Cache) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	c.lg.Debug("INCR", k, delta)
+	defer c.invalidate(k)
+	return c.Connection.Incr(k, delta, op...)
+}
+
+func (c *Cache) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	c.lg.Debug("INCRFLOAT", k, delta)
+	defer c.invalidate(k)
+	return c.Connection.IncrFloat(k, delta, op...)
+}
+
+// Tx runs fn in transaction of connection, keys in transaction bucket are invalidated after transaction
+func (c *Cache) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
+	c.lg.Debug("TX", pfx)
+	defer func() {
+		c.mtx.Lock()
+		c.invalidatePrefix(c.Encoding().EncodeKey(pfx, ""))
+		c.mtx.Unlock()
+	}()
+	return c.Connection.Tx(pfx, fn)
+}
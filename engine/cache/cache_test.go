@@ -0,0 +1,429 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/engine/cache"
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+)
+
+var (
+	db = internal.Must(cache.New(internal.Must(memory.New())))
+)
+
+func TestGetSet(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test2", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value not 1")
+	}
+
+	var two int
+	err = db.Get("test2", &two)
+	if err != nil {
+		t.Error(err)
+	}
+	if two != 2 {
+		t.Error("Value not 2")
+	}
+}
+
+func TestDeleteExists(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !db.Exists("test1") {
+		t.Log("Value not created")
+	}
+
+	err = db.Delete("test1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if db.Exists("test1") {
+		t.Log("Value not deleted")
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err == nil {
+		t.Error("Got value, expected error")
+	}
+	if val != 0 {
+		t.Error("Expected zero value")
+	}
+}
+
+func TestIter(t *testing.T) {
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	i := 0
+	for item := range helpers.Iter[rune](context.Background(), db) {
+		i++
+		switch item.Key {
+		case "one":
+			if item.Value != '1' {
+				t.Error("Value not 1")
+			}
+		case "two":
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+		default:
+			i--
+		}
+	}
+
+	if i < 2 {
+		t.Error("Not full iteration")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hit := make(chan struct{})
+
+	go func() {
+		for item := range helpers.Watch[rune](ctx, db, "two") {
+			if item.Event != types.PutEvent {
+				t.Error("Not Put Event")
+			}
+			if item.Key != "two" {
+				t.Error("Key not two")
+			}
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+			hit <- struct{}{}
+		}
+	}()
+
+	// Magic sleep
+	time.Sleep(1 * time.Second)
+
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts := time.NewTimer(3 * time.Second)
+	defer ts.Stop()
+
+	select {
+	case <-hit:
+	case <-ts.C:
+		t.Error("Change not found")
+	}
+}
+
+func TestLenKeyVals(t *testing.T) {
+	err := db.Set("test/one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test/two", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	length, err := db.Len("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if length < 2 {
+		t.Error("Len < 2")
+	}
+
+	keys, err := db.Keys("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(keys) < 2 {
+		t.Error("Keys Len < 2")
+	}
+
+	vals, err := db.Values("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(vals) < 2 {
+		t.Error("Vals Len < 2")
+	}
+}
+
+func TestTx(t *testing.T) {
+	const workers = 5
+	bucket := db.Bucket("tx")
+
+	err := bucket.Set("counter", 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := bucket.Tx(func(tx storage.Transactioner) error {
+				val, err := helpers.Get[int](tx, "counter")
+				if err != nil {
+					return err
+				}
+				return tx.Set("counter", val+1)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	val, err := helpers.Get[int](bucket, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != workers {
+		t.Error("Counter not", workers, "got", val)
+	}
+}
+
+// counter counts Get calls of connection
+type counter struct {
+	storage.Connection
+
+	mtx  sync.Mutex
+	gets int
+}
+
+func (c *counter) Get(k string, v any) error {
+	c.mtx.Lock()
+	c.gets++
+	c.mtx.Unlock()
+	return c.Connection.Get(k, v)
+}
+
+func (c *counter) count() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.gets
+}
+
+func TestHit(t *testing.T) {
+	conn := &counter{Connection: internal.Must(memory.New())}
+	c := internal.Must(cache.New(conn))
+	defer c.Close()
+
+	err := c.Set("hit", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		val, err := helpers.Get[int](c, "hit")
+		if err != nil {
+			t.Error(err)
+		}
+		if val != 1 {
+			t.Error("Value not 1")
+		}
+	}
+
+	if c.Exists("missing") || c.Exists("missing") {
+		t.Error("Value exists")
+	}
+
+	if conn.count() != 2 {
+		t.Error("Expected 2 gets, got", conn.count())
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 3 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Error("Unexpected stats", stats)
+	}
+}
+
+func TestCoherence(t *testing.T) {
+	conn := internal.Must(memory.New())
+	c := internal.Must(cache.New(conn))
+	defer c.Close()
+
+	// Magic sleep
+	time.Sleep(100 * time.Millisecond)
+
+	err := conn.Set("coherent", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[int](c, "coherent")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value not 1")
+	}
+
+	// changed by other client
+	err = conn.Set("coherent", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for val != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		val, err = helpers.Get[int](c, "coherent")
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if val != 2 {
+		t.Error("Value not invalidated")
+	}
+
+	err = conn.Delete("coherent")
+	if err != nil {
+		t.Error(err)
+	}
+
+	deadline = time.Now().Add(3 * time.Second)
+	for c.Exists("coherent") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, err = helpers.Get[int](c, "coherent")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Error("Expected not found, got", err)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	conn := &counter{Connection: internal.Must(memory.New())}
+	c := internal.Must(cache.New(conn, cache.MaxEntries(2)))
+	defer c.Close()
+
+	for _, k := range []string{"one", "two", "three", "one"} {
+		_, err := helpers.Get[int](c, k)
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Error("Expected not found, got", err)
+		}
+	}
+
+	if conn.count() != 4 {
+		t.Error("Expected 4 gets, got", conn.count())
+	}
+
+	if stats := c.Stats(); stats.Entries != 2 {
+		t.Error("Expected 2 entries, got", stats.Entries)
+	}
+
+	// entries are dropped on close
+	c.Close()
+	if stats := c.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Error("Expected no entries after close, got", stats.Entries, stats.Bytes)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	db.Delete("counter")
+	db.Delete("float")
+
+	for i := int64(1); i <= 3; i++ {
+		n, err := db.Incr("counter", 1)
+		if err != nil {
+			t.Error(err)
+		}
+		if n != i {
+			t.Error("Expected", i, "got", n)
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := db.Incr("counter", 1)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := helpers.Get[int64](db, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 103 {
+		t.Error("Lost increments, expected 103, got", n)
+	}
+
+	_, err = db.IncrFloat("float", 1.5)
+	if err != nil {
+		t.Error(err)
+	}
+	f, err := db.IncrFloat("float", -0.25)
+	if err != nil {
+		t.Error(err)
+	}
+	if f != 1.25 {
+		t.Error("Expected 1.25, got", f)
+	}
+
+	_, err = db.Incr("float", 1)
+	if err == nil {
+		t.Error("Expected error incrementing float by integer")
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	db.Close()
+	os.Exit(code)
+}
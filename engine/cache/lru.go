@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"container/list"
+	"strings"
+)
+
+// entry of cached key, missing keys are cached too
+type entry struct {
+	key   string
+	value []byte
+	found bool
+}
+
+func (e *entry) size() int {
+	return len(e.key) + len(e.value)
+}
+
+// lru is not safe for concurrent use
+type lru struct {
+	maxEntries int
+	maxBytes   int
+
+	bytes   int
+	order   *list.List // most recently used first
+	entries map[string]*list.Element
+}
+
+func newLRU(maxEntries, maxBytes int) *lru {
+	return &lru{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+func (c *lru) get(k string) (*entry, bool) {
+	el, exists := c.entries[k]
+	if !exists {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*entry), true
+}
+
+func (c *lru) add(e *entry) {
+	c.remove(e.key)
+
+	// never fits
+	if c.maxBytes > 0 && e.size() > c.maxBytes {
+		return
+	}
+
+	c.entries[e.key] = c.order.PushFront(e)
+	c.bytes += e.size()
+
+	for c.order.Len() > 0 && ((c.maxEntries > 0 && c.order.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)) {
+		c.remove(c.order.Back().Value.(*entry).key)
+	}
+}
+
+func (c *lru) remove(k string) {
+	el, exists := c.entries[k]
+	if !exists {
+		return
+	}
+
+	c.order.Remove(el)
+	delete(c.entries, k)
+	c.bytes -= el.Value.(*entry).size()
+}
+
+// removePrefix removes all keys starting with pfx
+func (c *lru) removePrefix(pfx string) {
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if k := el.Value.(*entry).key; strings.HasPrefix(k, pfx) {
+			c.remove(k)
+		}
+		el = next
+	}
+}
+
+// clear removes all entries
+func (c *lru) clear() {
+	c.bytes = 0
+	c.order.Init()
+	c.entries = map[string]*list.Element{}
+}
@@ -0,0 +1,36 @@
+package cache
+
+import "github.com/rafalb8/go-storage"
+
+type CacheOpts func(*Cache) error
+
+// Max number of cached keys, default 10000, 0 means unlimited
+func MaxEntries(n int) CacheOpts {
+	return func(c *Cache) error {
+		c.maxEntries = n
+		return nil
+	}
+}
+
+// Max size of cached keys and values in bytes, default 0 means unlimited
+func MaxBytes(n int) CacheOpts {
+	return func(c *Cache) error {
+		c.maxBytes = n
+		return nil
+	}
+}
+
+// Cache only keys starting with prefixes, every prefix is watched for changes. Default caches all keys.
+func Prefix(pfx ...string) CacheOpts {
+	return func(c *Cache) error {
+		c.prefixes = pfx
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) CacheOpts {
+	return func(c *Cache) error {
+		c.lg = lg
+		return nil
+	}
+}
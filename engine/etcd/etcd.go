@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rafalb8/go-maps/types"
@@ -38,14 +40,22 @@ type Etcd struct {
 	// Storage driver encoding
 	encoding encoding.Coder
 
+	// max number of versions returned by History
+	historyLimit int
+
+	// lease of published messages
+	leaseMtx sync.Mutex
+	leaseID  clientv3.LeaseID
+
 	// Logger
 	lg storage.Logger
 }
 
 func New(opts ...EtcdOpts) (storage.Connection, error) {
 	etcd := &Etcd{
-		encoding: encoding.NewCoder(key.Binary, value.CBOR),
-		lg: &internal.SimpleLogger{},
+		encoding:     encoding.NewCoder(key.Binary, value.CBOR),
+		historyLimit: historyLimit,
+		lg:           &internal.SimpleLogger{},
 	}
 
 	// Apply options
@@ -82,6 +92,13 @@ func New(opts ...EtcdOpts) (storage.Connection, error) {
 }
 
 func (e *Etcd) Close() {
+	e.leaseMtx.Lock()
+	if e.leaseID != clientv3.NoLease {
+		// remove published messages now, instead of after lease expires
+		e.client.Lease.Revoke(e.ctx, e.leaseID)
+	}
+	e.leaseMtx.Unlock()
+
 	e.cancel()
 	e.client.Close()
 	if e.server != nil {
@@ -89,8 +106,10 @@ func (e *Etcd) Close() {
 	}
 }
 
-func (e *Etcd) applyOptions(ops []storage.Option) []clientv3.OpOption {
+// applyOptions converts options to etcd options, returned lease of TTL should be revoked when put fails
+func (e *Etcd) applyOptions(ops []storage.Option) ([]clientv3.OpOption, clientv3.LeaseID) {
 	out := []clientv3.OpOption{}
+	leaseID := clientv3.NoLease
 
 	for _, opt := range ops {
 		switch opt := opt.(type) {
@@ -102,6 +121,7 @@ func (e *Etcd) applyOptions(ops []storage.Option) []clientv3.OpOption {
 				continue
 			}
 			out = append(out, clientv3.WithLease(lease.ID))
+			leaseID = lease.ID
 
 		default:
 			e.lg.Warn("Unsupported option: %T", opt)
@@ -109,7 +129,18 @@ func (e *Etcd) applyOptions(ops []storage.Option) []clientv3.OpOption {
 
 	}
 
-	return out
+	return out, leaseID
+}
+
+// revoke unused lease
+func (e *Etcd) revoke(lease clientv3.LeaseID) {
+	if lease == clientv3.NoLease {
+		return
+	}
+	_, err := e.client.Lease.Revoke(e.ctx, lease)
+	if err != nil {
+		e.lg.Error("revoke", err)
+	}
 }
 
 func (e *Etcd) Bucket(bucket ...string) *storage.Bucket {
@@ -130,6 +161,9 @@ func (e *Etcd) PrintDebug(pfx string) error {
 	out := map[string]any{}
 	for _, kv := range resp.Kvs {
 		k := string(kv.Key)
+		if e.hidden(k) {
+			continue
+		}
 		out[k], err = helpers.Decode[any](e.encoding, kv.Value)
 		if err != nil {
 			e.lg.Warn("decode", "err", err, "key", k, "value", string(kv.Value))
@@ -155,7 +189,11 @@ func (e *Etcd) Set(k string, v any, op ...storage.Option) error {
 		return fmt.Errorf("encoder: %w", err)
 	}
 
-	_, err = kv.Put(e.ctx, k, string(data), e.applyOptions(op)...)
+	opts, lease := e.applyOptions(op)
+	_, err = kv.Put(e.ctx, k, string(data), opts...)
+	if err != nil {
+		e.revoke(lease)
+	}
 	return err
 }
 
@@ -204,7 +242,28 @@ func (e *Etcd) Len(pfx string) (int, error) {
 
 	}
 
-	return int(resp.Count), nil
+	count := resp.Count
+	if hidden := e.topicKey(""); strings.HasPrefix(hidden, pfx) {
+		// published messages are not counted
+		resp, err := kv.Get(e.ctx, hidden, clientv3.WithPrefix(), clientv3.WithCountOnly(), clientv3.WithRev(resp.Header.Revision))
+		if err != nil {
+			return 0, fmt.Errorf("etcd: %w", err)
+		}
+		count -= resp.Count
+	}
+
+	return int(count), nil
+}
+
+// visible drops keys of published messages
+func (e *Etcd) visible(kvs []*mvccpb.KeyValue) []*mvccpb.KeyValue {
+	out := make([]*mvccpb.KeyValue, 0, len(kvs))
+	for _, kv := range kvs {
+		if !e.hidden(string(kv.Key)) {
+			out = append(out, kv)
+		}
+	}
+	return out
 }
 
 func (e *Etcd) Keys(pfx string) ([]string, error) {
@@ -216,7 +275,7 @@ func (e *Etcd) Keys(pfx string) ([]string, error) {
 		return nil, fmt.Errorf("etcd: %w", err)
 	}
 
-	return iter.MapSlice(resp.Kvs, func(kv *mvccpb.KeyValue) string {
+	return iter.MapSlice(e.visible(resp.Kvs), func(kv *mvccpb.KeyValue) string {
 		return string(kv.Key)
 	}), nil
 }
@@ -230,7 +289,7 @@ func (e *Etcd) Values(pfx string) ([][]byte, error) {
 		return nil, fmt.Errorf("etcd: %w", err)
 	}
 
-	return iter.MapSlice(resp.Kvs, func(kv *mvccpb.KeyValue) []byte {
+	return iter.MapSlice(e.visible(resp.Kvs), func(kv *mvccpb.KeyValue) []byte {
 		return kv.Value
 	}), nil
 }
@@ -249,7 +308,7 @@ func (e *Etcd) Iter(ctx context.Context, pfx string) types.Iterator[string, []by
 			return
 		}
 
-		for _, keyval := range resp.Kvs {
+		for _, keyval := range e.visible(resp.Kvs) {
 			out <- types.Item[string, []byte]{Key: string(keyval.Key), Value: keyval.Value}
 		}
 	}()
@@ -257,6 +316,38 @@ func (e *Etcd) Iter(ctx context.Context, pfx string) types.Iterator[string, []by
 	return out
 }
 
+// IterRange iterates keys in range [from, to), empty to is unbounded
+func (e *Etcd) IterRange(ctx context.Context, from, to string) types.Iterator[string, []byte] {
+	e.lg.Debug("ITERRANGE", from, to)
+	out := make(chan types.Item[string, []byte])
+	kv := e.client.KV
+
+	opt := clientv3.WithFromKey()
+	if to != "" {
+		opt = clientv3.WithRange(to)
+	}
+
+	go func() {
+		defer close(out)
+
+		resp, err := kv.Get(ctx, from, opt)
+		if err != nil {
+			e.lg.Error(err)
+			return
+		}
+
+		for _, keyval := range e.visible(resp.Kvs) {
+			select {
+			case out <- types.Item[string, []byte]{Key: string(keyval.Key), Value: keyval.Value}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
 func (e *Etcd) Watch(ctx context.Context, pfx string) types.Watcher[string, []byte] {
 	e.lg.Debug("WATCH", pfx)
 
@@ -268,6 +359,9 @@ func (e *Etcd) Watch(ctx context.Context, pfx string) types.Watcher[string, []by
 
 		for resp := range watcher {
 			for _, event := range resp.Events {
+				if e.hidden(string(event.Kv.Key)) {
+					continue
+				}
 				out <- types.WatchMsg[string, []byte]{
 					Event: types.EventType(event.Type.String()),
 					Item: types.Item[string, []byte]{
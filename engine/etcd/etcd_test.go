@@ -2,13 +2,21 @@ package etcd_test
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
 	"github.com/rafalb8/go-storage/engine/etcd"
 	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/history"
 	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/queue"
+	"github.com/rafalb8/go-storage/registry"
+	"github.com/rafalb8/go-storage/sequence"
 )
 
 var (
@@ -185,3 +193,344 @@ func TestLenKeyVals(t *testing.T) {
 		t.Error("Vals Len < 2")
 	}
 }
+
+func TestHistory(t *testing.T) {
+	h := db.(history.Historian)
+
+	for i := 1; i <= 3; i++ {
+		err := db.Set("history", i)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	versions, err := h.History("history")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(versions) < 3 {
+		t.Fatal("Expected 3 versions, got", len(versions))
+	}
+
+	var val int
+	err = h.GetAt("history", versions[len(versions)-3].Revision, &val)
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value at revision not 1, got", val)
+	}
+
+	err = db.Delete("history")
+	if err != nil {
+		t.Error(err)
+	}
+
+	// deleted key keeps history
+	deleted, err := h.History("history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) < 2 || !deleted[len(deleted)-1].Deleted || deleted[len(deleted)-2].Revision != versions[len(versions)-1].Revision {
+		t.Error("Delete not recorded", deleted)
+	}
+
+	// history of recreated key starts at its creation
+	err = db.Set("history", 4)
+	if err != nil {
+		t.Error(err)
+	}
+	recreated, err := h.History("history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recreated) != 1 || recreated[0].Deleted || recreated[0].Revision <= deleted[len(deleted)-1].Revision {
+		t.Error("Unexpected history of recreated key", recreated)
+	}
+}
+
+func TestIterRange(t *testing.T) {
+	bucket := db.Bucket("range")
+	for _, k := range []string{"a", "b", "c", "d"} {
+		err := bucket.Set(k, k)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	tests := []struct {
+		from, to string
+		expected string
+	}{
+		{"b", "d", "bc"},
+		{"c", "", "cd"},
+		{"", "b", "a"},
+	}
+
+	for _, test := range tests {
+		keys := ""
+		for item := range bucket.IterRange(context.Background(), test.from, test.to) {
+			keys += item.Key
+		}
+		if keys != test.expected {
+			t.Error("Expected", test.expected, "got", keys)
+		}
+	}
+}
+
+func TestIncr(t *testing.T) {
+	db.Delete("counter")
+	db.Delete("float")
+
+	for i := int64(1); i <= 3; i++ {
+		n, err := db.Incr("counter", 1)
+		if err != nil {
+			t.Error(err)
+		}
+		if n != i {
+			t.Error("Expected", i, "got", n)
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := db.Incr("counter", 1)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := helpers.Get[int64](db, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 103 {
+		t.Error("Lost increments, expected 103, got", n)
+	}
+
+	_, err = db.IncrFloat("float", 1.5)
+	if err != nil {
+		t.Error(err)
+	}
+	f, err := db.IncrFloat("float", -0.25)
+	if err != nil {
+		t.Error(err)
+	}
+	if f != 1.25 {
+		t.Error("Expected 1.25, got", f)
+	}
+
+	_, err = db.Incr("float", 1)
+	if err == nil {
+		t.Error("Expected error incrementing float by integer")
+	}
+}
+
+func TestSequence(t *testing.T) {
+	db.Delete("seq")
+
+	mtx := sync.Mutex{}
+	ids := map[int64]bool{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		// every sequence acts as separate process
+		seq := internal.Must(sequence.New(db, "seq", sequence.Block(10)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				id, err := seq.Next()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				mtx.Lock()
+				if ids[id] {
+					t.Error("Duplicate id", id)
+				}
+				ids[id] = true
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(ids) != 200 {
+		t.Error("Expected 200 ids, got", len(ids))
+	}
+}
+
+func TestQueue(t *testing.T) {
+	jobs := db.Bucket("jobs")
+	q := internal.Must(queue.New(jobs))
+
+	for i := 0; i < 20; i++ {
+		_, err := q.Enqueue(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mtx := sync.Mutex{}
+	seen := map[int]int{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			for {
+				msg, err := q.Dequeue(ctx)
+				if err != nil {
+					return
+				}
+
+				var v int
+				err = msg.Decode(&v)
+				if err != nil {
+					t.Error(err)
+				}
+				mtx.Lock()
+				seen[v]++
+				mtx.Unlock()
+
+				err = q.Ack(msg)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != 20 {
+		t.Error("Expected 20 messages, got", len(seen))
+	}
+	for v, n := range seen {
+		if n != 1 {
+			t.Error("Message", v, "delivered", n, "times")
+		}
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgs := helpers.Subscribe[string](ctx, db.(helpers.SubscribeHelper), "events/")
+
+	// wait for watch to start
+	time.Sleep(100 * time.Millisecond)
+
+	pub := db.(storage.Publisher)
+	err := pub.Publish("other", "skipped")
+	if err != nil {
+		t.Error(err)
+	}
+	err = pub.Publish("events/a", "one")
+	if err != nil {
+		t.Error(err)
+	}
+
+	select {
+	case msg := <-msgs:
+		if msg.Key != "events/a" || msg.Value != "one" {
+			t.Error("Expected events/a one, got", msg.Key, msg.Value)
+		}
+	case <-ctx.Done():
+		t.Fatal("Message not received")
+	}
+
+	// bucket with name of former pubsub bucket is part of data
+	err = db.Bucket(".pubsub").Set("events/a", "data")
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Bucket(".pubsub").Delete("events/a")
+
+	// published messages are not part of data
+	keys, err := db.Keys("")
+	if err != nil {
+		t.Error(err)
+	}
+	found := false
+	for _, k := range keys {
+		if strings.HasSuffix(k, "other") {
+			t.Error("Published message visible in keys", k)
+		}
+		found = found || k == db.Encoding().EncodeKey(db.Encoding().EncodeBucket(".pubsub"), "events/a")
+	}
+	if !found {
+		t.Error("Key of .pubsub bucket hidden", keys)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := internal.Must(registry.New(db.Bucket("services"), registry.TTL(3*time.Second)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	changes := r.Watch(ctx, "api")
+	<-changes
+
+	reg, err := r.Register(ctx, "api", registry.Instance{ID: "a", Address: "10.0.0.1:80"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances := <-changes
+	if len(instances) != 1 || instances[0].ID != "a" {
+		t.Error("Expected instance a, got", instances)
+	}
+
+	err = reg.Deregister()
+	if err != nil {
+		t.Error(err)
+	}
+	instances = <-changes
+	if len(instances) != 0 {
+		t.Error("Expected no instances, got", instances)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lost, err := db.Bucket("alive").KeepAlive(ctx, "key", "value", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// kept alive past TTL
+	time.Sleep(2500 * time.Millisecond)
+	val, err := helpers.Get[string](db.Bucket("alive"), "key")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != "value" {
+		t.Error("Expected value, got", val)
+	}
+
+	// lease is revoked when ctx is done
+	cancel()
+	select {
+	case <-lost:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Keep alive not stopped")
+	}
+	_, err = helpers.Get[string](db.Bucket("alive"), "key")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Error("Expected ErrNotFound, got", err)
+	}
+}
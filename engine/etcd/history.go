@@ -0,0 +1,119 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/history"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var (
+	_ history.Historian = (*Etcd)(nil)
+)
+
+// default number of versions returned by History
+const historyLimit = 100
+
+// History returns versions of key from MVCC revisions kept since compaction, including deletes.
+// Revisions are replayed by single watch from creation of current key, so versions of key deleted
+// before it was created again are returned only while it is deleted. Only newest versions up to HistoryLimit are returned.
+// Etcd doesn't record time of change, so Time of versions is zero.
+func (e *Etcd) History(k string) ([]history.Version, error) {
+	e.lg.Debug("HISTORY", k)
+
+	// history ends at current revision
+	resp, err := e.client.KV.Get(e.ctx, k, clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, fmt.Errorf("etcd: %w", err)
+	}
+	end := resp.Header.Revision
+
+	// replay starts at creation of existing key, deleted key is replayed from first revision
+	start := int64(1)
+	if len(resp.Kvs) > 0 {
+		start = resp.Kvs[0].CreateRevision
+	}
+
+	ctx, cancel := context.WithCancel(e.ctx)
+	defer cancel()
+
+	versions := []history.Version{}
+	for rev, done := start, false; !done; {
+		watcher := e.client.Watch(ctx, k, clientv3.WithRev(rev), clientv3.WithCreatedNotify())
+		rev = 0
+
+		for resp := range watcher {
+			if resp.CompactRevision > 0 {
+				// older revisions compacted, replay from compaction
+				rev = resp.CompactRevision
+				break
+			}
+			if err := resp.Err(); err != nil {
+				return nil, fmt.Errorf("etcd: %w", err)
+			}
+			if resp.Created {
+				// progress is reported after all past revisions were sent
+				err := e.client.RequestProgress(ctx)
+				if err != nil {
+					return nil, fmt.Errorf("etcd: %w", err)
+				}
+				continue
+			}
+
+			done = resp.IsProgressNotify() && resp.Header.Revision >= end
+			for _, event := range resp.Events {
+				if event.Kv.ModRevision > end {
+					done = true
+					break
+				}
+
+				version := history.Version{Revision: event.Kv.ModRevision, Value: event.Kv.Value}
+				if event.Type == mvccpb.DELETE {
+					version = history.Version{Revision: event.Kv.ModRevision, Deleted: true}
+				}
+				versions = append(versions, version)
+				if len(versions) > e.historyLimit {
+					versions = versions[1:]
+				}
+				done = done || event.Kv.ModRevision == end
+			}
+			if done {
+				break
+			}
+		}
+
+		if !done && rev == 0 {
+			err := ctx.Err()
+			if err == nil {
+				err = errors.New("watch closed")
+			}
+			return nil, fmt.Errorf("etcd: history %s: %w", k, err)
+		}
+	}
+
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("history %s: %w", k, storage.ErrNotFound)
+	}
+	return versions, nil
+}
+
+// GetAt decodes value of key at revision, revisions before compaction are not available
+func (e *Etcd) GetAt(k string, rev int64, v any) error {
+	e.lg.Debug("GETAT", k, rev)
+	kv := e.client.KV
+
+	resp, err := kv.Get(e.ctx, k, clientv3.WithRev(rev))
+	if err != nil {
+		return fmt.Errorf("etcd: %w", err)
+	}
+	if len(resp.Kvs) <= 0 {
+		return fmt.Errorf("get %s: %w", k, storage.ErrNotFound)
+	}
+
+	return e.Encoding().DecodeValue(resp.Kvs[0].Value, v)
+}
@@ -0,0 +1,75 @@
+package etcd
+
+import (
+	"fmt"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/internal"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Incr adds delta to integer value of key, write is retried until revision of key is unchanged
+func (e *Etcd) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	e.lg.Debug("INCR", k, delta)
+	return incr(e, k, delta, op)
+}
+
+// IncrFloat adds delta to float value of key, write is retried until revision of key is unchanged
+func (e *Etcd) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	e.lg.Debug("INCRFLOAT", k, delta)
+	return incr(e, k, delta, op)
+}
+
+func incr[T internal.Number](e *Etcd, k string, delta T, op []storage.Option) (T, error) {
+	kv := e.client.KV
+
+	// options of key creation, lease of TTL is granted once and revoked when it wasn't used
+	var created []clientv3.OpOption
+	lease, used := clientv3.NoLease, false
+	defer func() {
+		if !used {
+			e.revoke(lease)
+		}
+	}()
+
+	for {
+		resp, err := kv.Get(e.ctx, k)
+		if err != nil {
+			return 0, fmt.Errorf("etcd: %w", err)
+		}
+
+		// revision of missing key is 0
+		var data []byte
+		var rev int64
+		if len(resp.Kvs) > 0 {
+			data, rev = resp.Kvs[0].Value, resp.Kvs[0].ModRevision
+		}
+
+		n, data, err := internal.Incr(e.encoding, data, delta)
+		if err != nil {
+			return n, fmt.Errorf("incr %s: %w", k, err)
+		}
+
+		// TTL is set when key is created, updates keep lease of key
+		opts := []clientv3.OpOption{clientv3.WithIgnoreLease()}
+		if rev == 0 {
+			if created == nil {
+				created, lease = e.applyOptions(op)
+			}
+			opts = created
+		}
+
+		txn, err := kv.Txn(e.ctx).
+			If(clientv3.Compare(clientv3.ModRevision(k), "=", rev)).
+			Then(clientv3.OpPut(k, string(data), opts...)).
+			Commit()
+		if err != nil {
+			return n, fmt.Errorf("etcd: %w", err)
+		}
+		if txn.Succeeded {
+			used = rev == 0
+			return n, nil
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var _ storage.KeepAliver = (*Etcd)(nil)
+
+// KeepAlive puts key with single lease kept alive until ctx is done, then lease is revoked and key removed.
+// Returned channel is closed when lease is lost. Etcd rounds ttl to seconds, at least one.
+func (e *Etcd) KeepAlive(ctx context.Context, k string, v any, ttl time.Duration) (<-chan struct{}, error) {
+	e.lg.Debug("KEEPALIVE", k, ttl)
+
+	data, err := e.encoding.EncodeValue(v)
+	if err != nil {
+		return nil, fmt.Errorf("encoder: %w", err)
+	}
+
+	seconds := int64(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	lease, err := e.client.Lease.Grant(e.ctx, seconds)
+	if err != nil {
+		return nil, fmt.Errorf("etcd: %w", err)
+	}
+
+	_, err = e.client.KV.Put(e.ctx, k, string(data), clientv3.WithLease(lease.ID))
+	if err != nil {
+		e.revoke(lease.ID)
+		return nil, fmt.Errorf("etcd: %w", err)
+	}
+
+	alive, err := e.client.Lease.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		e.revoke(lease.ID)
+		return nil, fmt.Errorf("etcd: %w", err)
+	}
+
+	lost := make(chan struct{})
+	go func() {
+		defer close(lost)
+		for range alive {
+		}
+		if ctx.Err() != nil {
+			e.revoke(lease.ID)
+		}
+	}()
+	return lost, nil
+}
@@ -2,6 +2,7 @@ package etcd
 
 import (
 	"context"
+	"errors"
 
 	"github.com/rafalb8/go-storage"
 	"github.com/rafalb8/go-storage/encoding"
@@ -51,6 +52,17 @@ func Context(ctx context.Context) EtcdOpts {
 	}
 }
 
+// HistoryLimit sets max number of newest versions returned by History, default 100
+func HistoryLimit(n int) EtcdOpts {
+	return func(e *Etcd) error {
+		if n <= 0 {
+			return errors.New("history limit must be positive")
+		}
+		e.historyLimit = n
+		return nil
+	}
+}
+
 func Logger(lg storage.Logger) EtcdOpts {
 	return func(e *Etcd) error {
 		e.lg = lg
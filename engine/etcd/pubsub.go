@@ -0,0 +1,118 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var _ storage.Publisher = (*Etcd)(nil)
+
+// pubsubTTL is time after which key of published message is removed, when lease isn't kept alive
+const pubsubTTL = 5 * time.Second
+
+// topicKey returns hidden key of topic. Encoded buckets start with leading bucket symbol,
+// so prefix starting with trailing one doesn't clash with keys of any bucket.
+func (e *Etcd) topicKey(topic string) string {
+	sym := e.encoding.Symbols()
+	return sym.BucketKey[1] + "pubsub" + sym.Delimiter + topic
+}
+
+// hidden reports whether key holds published message, these keys are not part of data
+func (e *Etcd) hidden(k string) bool {
+	return strings.HasPrefix(k, e.topicKey(""))
+}
+
+// lease returns lease of published messages, single lease is kept alive while connection is open
+func (e *Etcd) lease() (clientv3.LeaseID, error) {
+	e.leaseMtx.Lock()
+	defer e.leaseMtx.Unlock()
+
+	if e.leaseID != clientv3.NoLease {
+		return e.leaseID, nil
+	}
+
+	lease, err := e.client.Lease.Grant(e.ctx, int64(pubsubTTL/time.Second))
+	if err != nil {
+		return clientv3.NoLease, fmt.Errorf("etcd: %w", err)
+	}
+
+	alive, err := e.client.Lease.KeepAlive(e.ctx, lease.ID)
+	if err != nil {
+		return clientv3.NoLease, fmt.Errorf("etcd: %w", err)
+	}
+
+	go func() {
+		for range alive {
+		}
+		// lease lost, next Publish grants new one
+		e.resetLease(lease.ID)
+	}()
+
+	e.leaseID = lease.ID
+	return lease.ID, nil
+}
+
+// resetLease forgets lease, when it's still current
+func (e *Etcd) resetLease(id clientv3.LeaseID) {
+	e.leaseMtx.Lock()
+	defer e.leaseMtx.Unlock()
+	if e.leaseID == id {
+		e.leaseID = clientv3.NoLease
+	}
+}
+
+// Publish puts message to key of topic with lease kept alive by connection, subscribers watch the key.
+// Key holds only last message of topic until connection is closed and lease expires.
+func (e *Etcd) Publish(topic string, v any) error {
+	e.lg.Debug("PUBLISH", topic, v)
+
+	data, err := e.encoding.EncodeValue(v)
+	if err != nil {
+		return fmt.Errorf("encoder: %w", err)
+	}
+
+	lease, err := e.lease()
+	if err != nil {
+		return err
+	}
+
+	_, err = e.client.KV.Put(e.ctx, e.topicKey(topic), string(data), clientv3.WithLease(lease))
+	if err != nil {
+		e.resetLease(lease)
+		return fmt.Errorf("etcd: %w", err)
+	}
+	return nil
+}
+
+func (e *Etcd) Subscribe(ctx context.Context, topicPfx string) types.Iterator[string, []byte] {
+	e.lg.Debug("SUBSCRIBE", topicPfx)
+	out := make(chan types.Item[string, []byte])
+	base := e.topicKey("")
+
+	go func() {
+		defer close(out)
+		// expired messages are not reported
+		watcher := e.client.Watch(ctx, e.topicKey(topicPfx), clientv3.WithPrefix(), clientv3.WithFilterDelete())
+
+		for resp := range watcher {
+			for _, event := range resp.Events {
+				select {
+				case out <- types.Item[string, []byte]{
+					Key: strings.TrimPrefix(string(event.Kv.Key), base), Value: event.Kv.Value,
+				}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out
+}
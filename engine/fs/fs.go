@@ -0,0 +1,540 @@
+// Package fs stores every key as a file in directory tree mirroring bucket nesting,
+// eg. key "one" in bucket ("env", "123") is stored in <dir>/env%/123%/one.
+// Directories of buckets end with "%", so a key and a bucket can share a name.
+//
+// Files can be edited by hand or mounted from Kubernetes ConfigMap, Watch reports changes
+// made outside of the engine. Files and directories starting with "." are ignored.
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rafalb8/go-maps"
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/encoding/key"
+	"github.com/rafalb8/go-storage/encoding/value"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/hub"
+	"github.com/rafalb8/go-storage/internal/keypath"
+	"github.com/rafalb8/go-storage/options"
+)
+
+var (
+	_ storage.Connection = (*FS)(nil)
+)
+
+type FS struct {
+	root     string         // database directory
+	poll     time.Duration  // forced polling interval
+	encoding encoding.Coder // db key/value encoder
+
+	// prefix mutex map
+	pfxMutex maps.Maper[string, sync.Locker]
+	// key mutexes of Incr
+	keyMutex internal.Stripes
+
+	// TTL timers
+	mtx    sync.Mutex
+	timers map[string]*time.Timer
+
+	// change watcher, started with first Watch
+	watchOnce sync.Once
+	changed   chan struct{}
+	hub       *hub.Hub[types.WatchMsg[string, []byte]]
+
+	// context
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Logger
+	lg storage.Logger
+}
+
+func New(opts ...FSOpts) (storage.Connection, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	f := &FS{
+		encoding: encoding.NewCoder(key.Simple, value.JSON),
+
+		pfxMutex: maps.New[string, sync.Locker](nil).Safe(),
+		timers:   map[string]*time.Timer{},
+		changed:  make(chan struct{}, 1),
+		hub:      hub.New[types.WatchMsg[string, []byte]](),
+		ctx:      ctx,
+		cancel:   cancel,
+		lg:       &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(f)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	if f.root == "" {
+		cancel()
+		return nil, errors.New("directory not set. Use Dir option")
+	}
+
+	err := os.MkdirAll(f.root, 0o755)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *FS) Close() {
+	f.cancel()
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for k, timer := range f.timers {
+		timer.Stop()
+		delete(f.timers, k)
+	}
+}
+
+func (f *FS) Encoding() encoding.Coder {
+	return f.encoding
+}
+
+func (f *FS) PrintDebug(pfx string) error {
+	out := map[string]any{}
+	for item := range f.Iter(f.ctx, pfx) {
+		val, err := helpers.Decode[any](f.encoding, item.Value)
+		if err != nil {
+			return err
+		}
+		out[item.Key] = internal.FixValue(val)
+	}
+	internal.PrintJSON(out)
+	return nil
+}
+
+func (f *FS) Bucket(bucket ...string) *storage.Bucket {
+	return storage.NewBucket(f, f.encoding.DecodeBucket(bucket...)...)
+}
+
+// path returns file path of key
+func (f *FS) path(k string) string {
+	buckets, name := keypath.Parse(f.encoding, k)
+
+	segments := []string{f.root}
+	for _, b := range buckets {
+		segments = append(segments, escapeBucket(b))
+	}
+	return filepath.Join(append(segments, escape(name))...)
+}
+
+// key returns raw key of file path relative to root, false for files in directories not created for buckets
+func (f *FS) key(rel string) (string, bool) {
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	buckets := make([]string, 0, len(segments)-1)
+	for _, s := range segments[:len(segments)-1] {
+		b, ok := unescapeBucket(s)
+		if !ok {
+			return "", false
+		}
+		buckets = append(buckets, b)
+	}
+
+	return keypath.EncodeKey(f.encoding, buckets, unescape(segments[len(segments)-1])), true
+}
+
+// dir returns deepest directory containing all keys starting with pfx
+func (f *FS) dir(pfx string) string {
+	sym := f.encoding.Symbols()
+	if !strings.HasPrefix(pfx, sym.BucketKey[0]) {
+		return f.root
+	}
+
+	inner := pfx[len(sym.BucketKey[0]):]
+	var buckets []string
+	if end := strings.Index(inner, sym.BucketKey[1]); end >= 0 {
+		buckets = strings.Split(inner[:end], sym.Delimiter)
+	} else {
+		// last bucket name can be incomplete
+		buckets = strings.Split(inner, sym.Delimiter)
+		buckets = buckets[:len(buckets)-1]
+	}
+
+	segments := []string{f.root}
+	for _, b := range buckets {
+		segments = append(segments, escapeBucket(b))
+	}
+	return filepath.Join(segments...)
+}
+
+// scan calls fn for every key starting with pfx, in lexical order of paths
+func (f *FS) scan(pfx string, fn func(k, path string, info iofs.FileInfo) error) error {
+	dir := f.dir(pfx)
+	err := filepath.WalkDir(dir, func(path string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, iofs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if strings.HasPrefix(d.Name(), ".") && path != dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		// follows symlinks
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(f.root, path)
+		if err != nil {
+			return err
+		}
+
+		k, ok := f.key(rel)
+		if !ok || !strings.HasPrefix(k, pfx) {
+			return nil
+		}
+		return fn(k, path, info)
+	})
+	if err != nil {
+		return fmt.Errorf("fs: %w", err)
+	}
+	return nil
+}
+
+// notFound reports whether err means that file doesn't exist
+func notFound(err error) bool {
+	return errors.Is(err, iofs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) || errors.Is(err, syscall.EISDIR)
+}
+
+// write file atomically
+func (f *FS) write(path string, data []byte) error {
+	dir, name := filepath.Split(path)
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// expire sets TTL timer of key, zero ttl removes timer
+func (f *FS) expire(k string, ttl time.Duration) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if timer, exists := f.timers[k]; exists {
+		timer.Stop()
+		delete(f.timers, k)
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(ttl, func() {
+		f.mtx.Lock()
+		if f.timers[k] != timer {
+			// replaced meanwhile
+			f.mtx.Unlock()
+			return
+		}
+		delete(f.timers, k)
+		f.mtx.Unlock()
+
+		err := f.remove(k)
+		if err != nil {
+			f.lg.Error("expire", k, err)
+		}
+	})
+	f.timers[k] = timer
+}
+
+// touch triggers rescan of watched directory
+func (f *FS) touch() {
+	select {
+	case f.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (f *FS) Set(k string, v any, op ...storage.Option) error {
+	f.lg.Debug("SET", k, v)
+	data, err := f.encoding.EncodeValue(v)
+	if err != nil {
+		return err
+	}
+
+	err = f.write(f.path(k), data)
+	if err != nil {
+		return fmt.Errorf("fs: %w", err)
+	}
+
+	f.expire(k, f.ttl(op))
+	f.touch()
+	return nil
+}
+
+// ttl returns expiration from options, 0 means no expiration
+func (f *FS) ttl(op []storage.Option) time.Duration {
+	var ttl time.Duration
+	for _, opt := range op {
+		switch opt := opt.(type) {
+		case *options.TTLOption:
+			ttl = opt.Value
+
+		default:
+			f.lg.Warn("Unsupported option: %T", opt)
+		}
+	}
+	return ttl
+}
+
+// Incr adds delta to integer value of key, key is locked in this process only
+func (f *FS) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	f.lg.Debug("INCR", k, delta)
+	return incr(f, k, delta, op)
+}
+
+// IncrFloat adds delta to float value of key, key is locked in this process only
+func (f *FS) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	f.lg.Debug("INCRFLOAT", k, delta)
+	return incr(f, k, delta, op)
+}
+
+func incr[T internal.Number](f *FS, k string, delta T, op []storage.Option) (T, error) {
+	mtx := f.keyMutex.Of(k)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	path := f.path(k)
+	old, err := os.ReadFile(path)
+	if err != nil && !notFound(err) {
+		return 0, fmt.Errorf("fs: %w", err)
+	}
+	created := err != nil
+
+	n, data, err := internal.Incr(f.encoding, old, delta)
+	if err != nil {
+		return n, fmt.Errorf("incr %s: %w", k, err)
+	}
+
+	err = f.write(path, data)
+	if err != nil {
+		return n, fmt.Errorf("fs: %w", err)
+	}
+
+	// TTL is set when key is created
+	if created {
+		f.expire(k, f.ttl(op))
+	}
+	f.touch()
+	return n, nil
+}
+
+func (f *FS) Get(k string, v any) error {
+	f.lg.Debug("GET", k)
+	data, err := os.ReadFile(f.path(k))
+	if notFound(err) {
+		return fmt.Errorf("get %s: %w", k, storage.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("fs: %w", err)
+	}
+	return f.encoding.DecodeValue(data, v)
+}
+
+func (f *FS) Exists(k string) bool {
+	f.lg.Debug("EXISTS", k)
+	info, err := os.Stat(f.path(k))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// remove file of key and empty parent directories
+func (f *FS) remove(k string) error {
+	path := f.path(k)
+	err := os.Remove(path)
+	if err != nil && !notFound(err) {
+		return fmt.Errorf("fs: %w", err)
+	}
+
+	for dir := filepath.Dir(path); dir != filepath.Clean(f.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			// not empty
+			break
+		}
+	}
+
+	f.touch()
+	return nil
+}
+
+func (f *FS) Delete(k string) error {
+	f.lg.Debug("DELETE", k)
+	f.expire(k, 0)
+	return f.remove(k)
+}
+
+func (f *FS) Len(pfx string) (int, error) {
+	f.lg.Debug("LEN", pfx)
+	n := 0
+	err := f.scan(pfx, func(string, string, iofs.FileInfo) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+func (f *FS) Keys(pfx string) ([]string, error) {
+	f.lg.Debug("KEYS", pfx)
+	keys := []string{}
+	err := f.scan(pfx, func(k, _ string, _ iofs.FileInfo) error {
+		keys = append(keys, k)
+		return nil
+	})
+	return keys, err
+}
+
+func (f *FS) Values(pfx string) ([][]byte, error) {
+	f.lg.Debug("VALUES", pfx)
+	values := [][]byte{}
+	err := f.scan(pfx, func(_, path string, _ iofs.FileInfo) error {
+		data, err := os.ReadFile(path)
+		if notFound(err) {
+			// removed meanwhile
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		values = append(values, data)
+		return nil
+	})
+	return values, err
+}
+
+func (f *FS) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
+	f.lg.Debug("ITER", pfx)
+	out := make(chan types.Item[string, []byte])
+	go func() {
+		defer close(out)
+		err := f.scan(pfx, func(k, path string, _ iofs.FileInfo) error {
+			data, err := os.ReadFile(path)
+			if notFound(err) {
+				// removed meanwhile
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			select {
+			case out <- types.Item[string, []byte]{Key: k, Value: data}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			f.lg.Error(err)
+		}
+	}()
+	return out
+}
+
+func (f *FS) Watch(ctx context.Context, pfx string) types.Watcher[string, []byte] {
+	f.lg.Debug("WATCH", pfx)
+	// subscribe before taking baseline snapshot, so no change is lost
+	msgs := f.hub.Subscribe(ctx)
+	f.watchOnce.Do(f.startWatcher)
+
+	out := make(chan types.WatchMsg[string, []byte])
+
+	go func() {
+		defer close(out)
+		for msg := range msgs {
+			if !strings.HasPrefix(msg.Key, pfx) {
+				continue
+			}
+
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Tx locks prefix in this process only, files can still be changed by other processes
+func (f *FS) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
+	f.lg.Debug("TX", pfx)
+
+	mtx := f.lock(pfx)
+	mtx.Lock()
+	defer mtx.Unlock()
+	return fn(f.Bucket(pfx))
+}
+
+// lock returns mutex of prefix or key
+func (f *FS) lock(pfx string) sync.Locker {
+	var mtx sync.Locker
+	f.pfxMutex.Commit(func(data map[string]sync.Locker) {
+		var exists bool
+		mtx, exists = data[pfx]
+		if !exists {
+			mtx = &sync.Mutex{}
+			data[pfx] = mtx
+		}
+	})
+	return mtx
+}
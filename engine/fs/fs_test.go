@@ -0,0 +1,441 @@
+package fs_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/engine/fs"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/options"
+)
+
+var (
+	dir = internal.Must(os.MkdirTemp("", "go-storage-fs"))
+	db  = internal.Must(fs.New(fs.Dir(dir)))
+)
+
+func TestGetSet(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test2", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value not 1")
+	}
+
+	var two int
+	err = db.Get("test2", &two)
+	if err != nil {
+		t.Error(err)
+	}
+	if two != 2 {
+		t.Error("Value not 2")
+	}
+}
+
+func TestDeleteExists(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !db.Exists("test1") {
+		t.Log("Value not created")
+	}
+
+	err = db.Delete("test1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if db.Exists("test1") {
+		t.Log("Value not deleted")
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err == nil {
+		t.Error("Got value, expected error")
+	}
+	if val != 0 {
+		t.Error("Expected zero value")
+	}
+}
+
+func TestIter(t *testing.T) {
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	i := 0
+	for item := range helpers.Iter[rune](context.Background(), db) {
+		i++
+		switch item.Key {
+		case "one":
+			if item.Value != '1' {
+				t.Error("Value not 1")
+			}
+		case "two":
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+		default:
+			i--
+		}
+	}
+
+	if i < 2 {
+		t.Error("Not full iteration")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hit := make(chan struct{})
+
+	go func() {
+		for item := range helpers.Watch[rune](ctx, db, "two") {
+			if item.Event != types.PutEvent {
+				t.Error("Not Put Event")
+			}
+			if item.Key != "two" {
+				t.Error("Key not two")
+			}
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+			hit <- struct{}{}
+		}
+	}()
+
+	// Magic sleep
+	time.Sleep(1 * time.Second)
+
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts := time.NewTimer(3 * time.Second)
+	defer ts.Stop()
+
+	select {
+	case <-hit:
+	case <-ts.C:
+		t.Error("Change not found")
+	}
+}
+
+func TestLenKeyVals(t *testing.T) {
+	err := db.Set("test/one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test/two", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	length, err := db.Len("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if length < 2 {
+		t.Error("Len < 2")
+	}
+
+	keys, err := db.Keys("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(keys) < 2 {
+		t.Error("Keys Len < 2")
+	}
+
+	vals, err := db.Values("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(vals) < 2 {
+		t.Error("Vals Len < 2")
+	}
+}
+
+func TestTx(t *testing.T) {
+	const workers = 5
+	bucket := db.Bucket("tx")
+
+	err := bucket.Set("counter", 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := bucket.Tx(func(tx storage.Transactioner) error {
+				val, err := helpers.Get[int](tx, "counter")
+				if err != nil {
+					return err
+				}
+				return tx.Set("counter", val+1)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	val, err := helpers.Get[int](bucket, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != workers {
+		t.Error("Counter not", workers, "got", val)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watch := helpers.Watch[int](ctx, db, "ttl")
+
+	err := db.Set("ttl", 1, options.TTL(200*time.Millisecond))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !db.Exists("ttl") {
+		t.Error("Value not created")
+	}
+
+	ts := time.NewTimer(3 * time.Second)
+	defer ts.Stop()
+
+	for {
+		select {
+		case item := <-watch:
+			if item.Event != types.DeleteEvent {
+				continue
+			}
+			if db.Exists("ttl") {
+				t.Error("Value not expired")
+			}
+			return
+
+		case <-ts.C:
+			t.Error("Expired value not deleted")
+			return
+		}
+	}
+}
+
+func TestExternalChange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// watch is established when Watch returns
+	watch := helpers.Watch[map[string]string](ctx, db.Bucket("config"), "")
+
+	// edited by hand, directory of bucket ends with %
+	err := os.MkdirAll(filepath.Join(dir, "config%"), 0o755)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "config%", "app"), []byte(`{"name": "app"}`), 0o644)
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts := time.NewTimer(3 * time.Second)
+	defer ts.Stop()
+
+	// file written by hand is truncated first, partial writes can be seen before final content
+	for found := false; !found; {
+		select {
+		case item := <-watch:
+			if item.Event == types.ErrorEvent || (item.Event == types.PutEvent && len(item.Value) == 0) {
+				continue
+			}
+			if item.Event != types.PutEvent || item.Key != "app" || item.Value["name"] != "app" {
+				t.Error("Unexpected event", item)
+			}
+			found = true
+		case <-ts.C:
+			t.Fatal("Change not found")
+		}
+	}
+
+	val, err := helpers.Get[map[string]string](db.Bucket("config"), "app")
+	if err != nil {
+		t.Error(err)
+	}
+	if val["name"] != "app" {
+		t.Error("Value not app")
+	}
+}
+
+func TestPoll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	poll := internal.Must(fs.New(fs.Dir(dir), fs.Poll(100*time.Millisecond)))
+	defer poll.Close()
+
+	watch := helpers.Watch[int](ctx, poll, "poll")
+
+	err := db.Set("poll", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts := time.NewTimer(3 * time.Second)
+	defer ts.Stop()
+
+	select {
+	case item := <-watch:
+		if item.Event != types.PutEvent || item.Value != 1 {
+			t.Error("Unexpected event", item)
+		}
+	case <-ts.C:
+		t.Error("Change not found")
+	}
+}
+
+func TestIncr(t *testing.T) {
+	db.Delete("counter")
+	db.Delete("float")
+
+	for i := int64(1); i <= 3; i++ {
+		n, err := db.Incr("counter", 1)
+		if err != nil {
+			t.Error(err)
+		}
+		if n != i {
+			t.Error("Expected", i, "got", n)
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := db.Incr("counter", 1)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := helpers.Get[int64](db, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 103 {
+		t.Error("Lost increments, expected 103, got", n)
+	}
+
+	_, err = db.IncrFloat("float", 1.5)
+	if err != nil {
+		t.Error(err)
+	}
+	f, err := db.IncrFloat("float", -0.25)
+	if err != nil {
+		t.Error(err)
+	}
+	if f != 1.25 {
+		t.Error("Expected 1.25, got", f)
+	}
+
+	_, err = db.Incr("float", 1)
+	if err == nil {
+		t.Error("Expected error incrementing float by integer")
+	}
+}
+
+func TestKeyAndBucket(t *testing.T) {
+	err := db.Set("shared", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Delete("shared")
+
+	// bucket with the same name as key
+	err = db.Bucket("shared").Set("k", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Bucket("shared").Delete("k")
+
+	val, err := helpers.Get[int](db, "shared")
+	if err != nil || val != 1 {
+		t.Error("Expected 1, got", val, err)
+	}
+	val, err = helpers.Get[int](db.Bucket("shared"), "k")
+	if err != nil || val != 2 {
+		t.Error("Expected 2, got", val, err)
+	}
+
+	keys, err := db.Keys("")
+	if err != nil {
+		t.Error(err)
+	}
+	found := 0
+	for _, k := range keys {
+		if k == "shared" || k == db.Encoding().EncodeKey(db.Encoding().EncodeBucket("shared"), "k") {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Error("Expected key and bucket key, got", keys)
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	db.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
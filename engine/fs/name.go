@@ -0,0 +1,58 @@
+package fs
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// escape bucket name or key into file name.
+// Characters not allowed in file names on common filesystems and leading "." are percent encoded,
+// so files starting with "." (temporary files, Kubernetes ConfigMap internals) never clash with keys.
+func escape(name string) string {
+	if name == "" {
+		return "%"
+	}
+
+	out := strings.Builder{}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 0x20 || strings.IndexByte(`%/\:*?"<>|`, c) >= 0 || (i == 0 && c == '.') {
+			fmt.Fprintf(&out, "%%%02X", c)
+			continue
+		}
+		out.WriteByte(c)
+	}
+	return out.String()
+}
+
+// unescape file name into bucket name or key
+func unescape(name string) string {
+	if name == "%" {
+		return ""
+	}
+
+	out, err := url.PathUnescape(name)
+	if err != nil {
+		return name
+	}
+	return out
+}
+
+// bucketSuffix marks directories of buckets. Escaped names never end with it,
+// so key and bucket with the same name are stored side by side.
+const bucketSuffix = "%"
+
+// escapeBucket escapes bucket name into directory name
+func escapeBucket(name string) string {
+	return escape(name) + bucketSuffix
+}
+
+// unescapeBucket returns bucket name of directory, false for directories not created for buckets
+func unescapeBucket(name string) (string, bool) {
+	name, ok := strings.CutSuffix(name, bucketSuffix)
+	if !ok || name == "" {
+		return "", false
+	}
+	return unescape(name), true
+}
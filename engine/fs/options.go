@@ -0,0 +1,40 @@
+package fs
+
+import (
+	"time"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+)
+
+type FSOpts func(*FS) error
+
+// Root directory of database, created when missing
+func Dir(dir string) FSOpts {
+	return func(f *FS) error {
+		f.root = dir
+		return nil
+	}
+}
+
+// Detect changes for Watch by scanning directory every interval instead of using inotify
+func Poll(interval time.Duration) FSOpts {
+	return func(f *FS) error {
+		f.poll = interval
+		return nil
+	}
+}
+
+func Coder(coder encoding.Coder) FSOpts {
+	return func(f *FS) error {
+		f.encoding = coder
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) FSOpts {
+	return func(f *FS) error {
+		f.lg = lg
+		return nil
+	}
+}
@@ -0,0 +1,153 @@
+package fs
+
+import (
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+)
+
+// interval of polling when inotify is not available
+const pollInterval = time.Second
+
+// notifier signals possible changes in watched directories
+type notifier interface {
+	C() <-chan struct{}
+	// Add directories to watch
+	Add(dirs []string)
+	Close()
+}
+
+// poller signals every interval
+type poller struct {
+	c    chan struct{}
+	done chan struct{}
+}
+
+func newPoller(interval time.Duration) *poller {
+	p := &poller{
+		c:    make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+			}
+
+			select {
+			case p.c <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return p
+}
+
+func (p *poller) C() <-chan struct{} {
+	return p.c
+}
+
+func (p *poller) Add([]string) {}
+
+func (p *poller) Close() {
+	close(p.done)
+}
+
+// snapshot returns stats of all keys and list of directories
+func (f *FS) snapshot() (map[string]iofs.FileInfo, []string) {
+	files := map[string]iofs.FileInfo{}
+	dirs := []string{}
+
+	filepath.WalkDir(f.root, func(path string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if strings.HasPrefix(d.Name(), ".") && path != f.root {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		return nil
+	})
+
+	f.scan("", func(k, _ string, info iofs.FileInfo) error {
+		files[k] = info
+		return nil
+	})
+	return files, dirs
+}
+
+func changed(a, b iofs.FileInfo) bool {
+	return !os.SameFile(a, b) || !a.ModTime().Equal(b.ModTime()) || a.Size() != b.Size()
+}
+
+// startWatcher publishes differences between directory snapshots taken after every change
+func (f *FS) startWatcher() {
+	n := newNotifier(f.poll, f.lg)
+	files, dirs := f.snapshot()
+	n.Add(dirs)
+	notify := n.C()
+
+	go func() {
+		defer n.Close()
+		for {
+			select {
+			case <-f.ctx.Done():
+				return
+			case <-notify:
+			case <-f.changed:
+			}
+
+			next, dirs := f.snapshot()
+			n.Add(dirs)
+
+			for k, info := range next {
+				if old, exists := files[k]; exists && !changed(old, info) {
+					continue
+				}
+
+				data, err := os.ReadFile(f.path(k))
+				if err != nil {
+					// removed meanwhile, next snapshot reports it
+					delete(next, k)
+					continue
+				}
+
+				f.hub.Publish(types.WatchMsg[string, []byte]{
+					Event: types.PutEvent,
+					Item:  types.Item[string, []byte]{Key: k, Value: data},
+				})
+			}
+
+			for k := range files {
+				if _, exists := next[k]; exists {
+					continue
+				}
+
+				f.hub.Publish(types.WatchMsg[string, []byte]{
+					Event: types.DeleteEvent,
+					Item:  types.Item[string, []byte]{Key: k},
+				})
+			}
+
+			files = next
+		}
+	}()
+}
@@ -0,0 +1,80 @@
+//go:build linux
+
+package fs
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB | syscall.IN_DELETE_SELF
+
+func newNotifier(poll time.Duration, lg storage.Logger) notifier {
+	if poll > 0 {
+		return newPoller(poll)
+	}
+
+	n, err := newInotify()
+	if err != nil {
+		lg.Warn("inotify not available, falling back to polling:", err)
+		return newPoller(pollInterval)
+	}
+	return n
+}
+
+// inotify signals every event in watched directories, events are not parsed,
+// because directory is scanned after every change anyway
+type inotify struct {
+	fd   int
+	file *os.File
+	c    chan struct{}
+}
+
+func newInotify() (*inotify, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &inotify{
+		fd: fd,
+		// non-blocking descriptor uses runtime poller, so Close unblocks Read
+		file: os.NewFile(uintptr(fd), "inotify"),
+		c:    make(chan struct{}, 1),
+	}
+
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			_, err := n.file.Read(buf)
+			if err != nil {
+				return
+			}
+
+			select {
+			case n.c <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return n, nil
+}
+
+func (n *inotify) C() <-chan struct{} {
+	return n.c
+}
+
+func (n *inotify) Add(dirs []string) {
+	// adding watched directory only updates its mask, recreated directories get new watch
+	for _, dir := range dirs {
+		syscall.InotifyAddWatch(n.fd, dir, inotifyMask)
+	}
+}
+
+func (n *inotify) Close() {
+	n.file.Close()
+}
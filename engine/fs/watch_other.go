@@ -0,0 +1,16 @@
+//go:build !linux
+
+package fs
+
+import (
+	"time"
+
+	"github.com/rafalb8/go-storage"
+)
+
+func newNotifier(poll time.Duration, lg storage.Logger) notifier {
+	if poll <= 0 {
+		poll = pollInterval
+	}
+	return newPoller(poll)
+}
@@ -3,8 +3,10 @@ package jsondb
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,13 +17,17 @@ import (
 	"github.com/rafalb8/go-storage/encoding/key"
 	"github.com/rafalb8/go-storage/encoding/value"
 	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/history"
 	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/hub"
 	"github.com/rafalb8/go-storage/internal/iter"
 	"github.com/rafalb8/go-storage/options"
 )
 
 var (
-	_ storage.Connection = (*JsonDB)(nil)
+	_ storage.Connection    = (*JsonDB)(nil)
+	_ history.TimeHistorian = (*JsonDB)(nil)
+	_ storage.Publisher     = (*JsonDB)(nil)
 )
 
 type JsonDB struct {
@@ -33,8 +39,21 @@ type JsonDB struct {
 	ticker   *time.Ticker   // ticker for db file sync
 	encoding encoding.Coder // db key/value encoder
 
+	// version chain, nil when history is disabled
+	history *history.Chain
+	// orders writes of data with versions recorded in history
+	mtx sync.Mutex
+
 	// prefix mutex map
 	pfxMutex maps.Maper[string, sync.Locker]
+	// key mutexes ordering Incr with Set, Delete and expiration of the same key
+	keyMutex internal.Stripes
+
+	// TTL timers
+	timers maps.Maper[string, *time.Timer]
+
+	// published messages, kept apart from data map
+	topics *hub.Hub[types.Item[string, []byte]]
 
 	// cancel for data map event watcher/hub
 	cancel context.CancelFunc
@@ -51,6 +70,8 @@ func New(opts ...JsonDBOpts) (storage.Connection, error) {
 		encoding: encoding.NewCoder(key.Simple, value.JSON),
 
 		pfxMutex: maps.New[string, sync.Locker](nil).Safe(),
+		timers:   maps.New[string, *time.Timer](nil).Safe(),
+		topics:   hub.New[types.Item[string, []byte]](),
 		cancel:   cancel,
 		lg:       &internal.SimpleLogger{},
 	}
@@ -155,22 +176,70 @@ func (j *JsonDB) Set(k string, v any, op ...storage.Option) error {
 	if err != nil {
 		return err
 	}
-	j.data.Set(k, data)
 
+	mtx := j.keyMutex.Of(k)
+	mtx.Lock()
+	defer mtx.Unlock()
+	j.set(k, data, op)
+	return nil
+}
+
+// set encoded value of key and apply options, TTL of key is removed when none is given
+func (j *JsonDB) set(k string, data []byte, op []storage.Option) {
+	j.store(k, data)
+
+	ttl := time.Duration(0)
 	for _, opt := range op {
 		switch opt := opt.(type) {
 		case *options.TTLOption:
-			go func(d time.Duration) {
-				time.Sleep(d)
-				j.data.Delete(k)
-			}(opt.Value)
+			ttl = opt.Value
 
 		default:
 			j.lg.Warn("Unsupported option: %T", opt)
 		}
 	}
+	j.expire(k, ttl)
+}
 
-	return nil
+// store encoded value of key and record it in history, TTL of key is kept
+func (j *JsonDB) store(k string, data []byte) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	j.data.Set(k, data)
+	if j.history != nil {
+		j.history.Set(k, data)
+	}
+}
+
+// Incr adds delta to integer value of key under key lock
+func (j *JsonDB) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	j.lg.Debug("INCR", k, delta)
+	return incr(j, k, delta, op)
+}
+
+// IncrFloat adds delta to float value of key under key lock
+func (j *JsonDB) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	j.lg.Debug("INCRFLOAT", k, delta)
+	return incr(j, k, delta, op)
+}
+
+func incr[T internal.Number](j *JsonDB, k string, delta T, op []storage.Option) (T, error) {
+	mtx := j.keyMutex.Of(k)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	data, exists := j.data.GetFull(k)
+	n, data, err := internal.Incr(j.encoding, data, delta)
+	if err != nil {
+		return n, fmt.Errorf("incr %s: %w", k, err)
+	}
+	if exists {
+		// TTL is set when key is created, existing TTL is kept
+		j.store(k, data)
+		return n, nil
+	}
+	j.set(k, data, op)
+	return n, nil
 }
 
 func (j *JsonDB) Get(k string, v any) error {
@@ -189,10 +258,96 @@ func (j *JsonDB) Exists(k string) bool {
 
 func (j *JsonDB) Delete(k string) error {
 	j.lg.Debug("DELETE", k)
-	j.data.Delete(k)
+	mtx := j.keyMutex.Of(k)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	j.expire(k, 0)
+	j.remove(k)
 	return nil
 }
 
+// expire removes key after ttl, previous TTL of key is replaced, zero ttl only cancels it
+func (j *JsonDB) expire(k string, ttl time.Duration) {
+	j.timers.Commit(func(timers map[string]*time.Timer) {
+		if timer, exists := timers[k]; exists {
+			timer.Stop()
+			delete(timers, k)
+		}
+
+		if ttl <= 0 {
+			return
+		}
+
+		var timer *time.Timer
+		timer = time.AfterFunc(ttl, func() {
+			mtx := j.keyMutex.Of(k)
+			mtx.Lock()
+			defer mtx.Unlock()
+
+			expired := false
+			j.timers.Commit(func(timers map[string]*time.Timer) {
+				// replaced meanwhile
+				if timers[k] != timer {
+					return
+				}
+				delete(timers, k)
+				expired = true
+			})
+
+			if expired {
+				j.remove(k)
+			}
+		})
+		timers[k] = timer
+	})
+}
+
+// remove key and record delete in history
+func (j *JsonDB) remove(k string) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	if j.history != nil && j.data.Exists(k) {
+		j.history.Delete(k)
+	}
+	j.data.Delete(k)
+}
+
+// History returns kept versions of key, History option has to be enabled
+func (j *JsonDB) History(k string) ([]history.Version, error) {
+	j.lg.Debug("HISTORY", k)
+	if j.history == nil {
+		return nil, errors.New("jsondb: history not enabled. Use History option")
+	}
+	return j.history.History(k)
+}
+
+func (j *JsonDB) GetAt(k string, rev int64, v any) error {
+	j.lg.Debug("GETAT", k, rev)
+	if j.history == nil {
+		return errors.New("jsondb: history not enabled. Use History option")
+	}
+
+	version, err := j.history.At(k, rev)
+	if err != nil {
+		return err
+	}
+	return j.encoding.DecodeValue(version.Value, v)
+}
+
+func (j *JsonDB) GetAtTime(k string, t time.Time, v any) error {
+	j.lg.Debug("GETAT", k, t)
+	if j.history == nil {
+		return errors.New("jsondb: history not enabled. Use History option")
+	}
+
+	version, err := j.history.AtTime(k, t)
+	if err != nil {
+		return err
+	}
+	return j.encoding.DecodeValue(version.Value, v)
+}
+
 func (j *JsonDB) Len(pfx string) (int, error) {
 	j.lg.Debug("LEN", pfx)
 	return maps.NewBucket[[]byte](j.data, pfx).Len(), nil
@@ -226,23 +381,77 @@ func (j *JsonDB) Iter(ctx context.Context, pfx string) types.Iterator[string, []
 func (j *JsonDB) Watch(ctx context.Context, pfx string) types.Watcher[string, []byte] {
 	j.lg.Debug("WATCH", pfx)
 	out := make(chan types.WatchMsg[string, []byte])
+	// register before returning, so changes made after Watch returns are not missed
+	events := j.data.Register(ctx)
 	go func() {
 		defer close(out)
-		for event := range maps.NewBucket[[]byte](j.data, pfx).Watch(ctx) {
-			out <- types.WatchMsg[string, []byte]{
+		// client is closed by the hub after ctx is done,
+		// keep draining it so the hub never blocks
+		for event := range events {
+			if ctx.Err() != nil || !strings.HasPrefix(event.Key, pfx) {
+				continue
+			}
+
+			select {
+			case out <- types.WatchMsg[string, []byte]{
 				Event: event.Event,
 				Item: types.Item[string, []byte]{
 					Key: event.Key, Value: event.Value,
 				},
+			}:
+			case <-ctx.Done():
 			}
 		}
 	}()
 	return out
 }
 
+// Publish delivers message to subscribers of topic without blocking, slow subscribers are disconnected
+func (j *JsonDB) Publish(topic string, v any) error {
+	j.lg.Debug("PUBLISH", topic, v)
+	data, err := j.encoding.EncodeValue(v)
+	if err != nil {
+		return fmt.Errorf("encoder: %w", err)
+	}
+
+	j.topics.Publish(types.Item[string, []byte]{Key: topic, Value: data})
+	return nil
+}
+
+func (j *JsonDB) Subscribe(ctx context.Context, topicPfx string) types.Iterator[string, []byte] {
+	j.lg.Debug("SUBSCRIBE", topicPfx)
+	out := make(chan types.Item[string, []byte])
+	msgs := j.topics.Subscribe(ctx)
+
+	go func() {
+		defer close(out)
+		for msg := range msgs {
+			if !strings.HasPrefix(msg.Key, topicPfx) {
+				continue
+			}
+
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
 func (j *JsonDB) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
 	j.lg.Debug("TX", pfx)
 
+	mtx := j.lock(pfx)
+	mtx.Lock()
+	defer mtx.Unlock()
+	return fn(j.Bucket(pfx))
+}
+
+// lock returns mutex of transaction prefix
+func (j *JsonDB) lock(pfx string) sync.Locker {
 	var mtx sync.Locker
 	j.pfxMutex.Commit(func(data map[string]sync.Locker) {
 		var exists bool
@@ -252,8 +461,5 @@ func (j *JsonDB) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
 			data[pfx] = mtx
 		}
 	})
-
-	mtx.Lock()
-	defer mtx.Unlock()
-	return fn(j.Bucket(pfx))
+	return mtx
 }
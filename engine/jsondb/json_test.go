@@ -3,12 +3,15 @@ package jsondb_test
 import (
 	"context"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
 	"github.com/rafalb8/go-storage/engine/jsondb"
 	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/history"
 	"github.com/rafalb8/go-storage/internal"
 )
 
@@ -150,6 +153,71 @@ func TestWatch(t *testing.T) {
 	}
 }
 
+func TestWatchPrefix(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// registered before Watch returns, no sleep needed
+	events := db.Watch(ctx, "watch/a")
+	for _, k := range []string{"watch/b", "watch/a1", "watch/a2"} {
+		err := db.Set(k, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for _, k := range []string{"watch/b", "watch/a1", "watch/a2"} {
+			db.Delete(k)
+		}
+	}()
+
+	for _, k := range []string{"watch/a1", "watch/a2"} {
+		select {
+		case event := <-events:
+			if event.Key != k {
+				t.Error("expected", k, "got", event.Key)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("change of", k, "not found")
+		}
+	}
+
+	// cancelled watcher is drained, so writers are not blocked
+	cancel()
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 100; i++ {
+			err := db.Set("watch/a1", i)
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Set blocked by cancelled watcher")
+	}
+
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("watcher not closed")
+		}
+	}
+}
+
 func TestLenKeyVals(t *testing.T) {
 	err := db.Set("test/one", 1)
 	if err != nil {
@@ -189,8 +257,123 @@ func TestLenKeyVals(t *testing.T) {
 	}
 }
 
+func TestHistory(t *testing.T) {
+	conn := internal.Must(jsondb.New(jsondb.File("/tmp/github.com/rafalb8/go-storage/history.json"), jsondb.History(10, 0)))
+	defer conn.Close()
+	h := conn.(history.Historian)
+
+	for i := 1; i <= 3; i++ {
+		err := conn.Set("history", i)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	versions, err := h.History("history")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(versions) != 3 {
+		t.Fatal("Expected 3 versions, got", len(versions))
+	}
+
+	var val int
+	err = h.GetAt("history", versions[0].Revision, &val)
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value at revision not 1, got", val)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	db.Delete("counter")
+	db.Delete("float")
+
+	for i := int64(1); i <= 3; i++ {
+		n, err := db.Incr("counter", 1)
+		if err != nil {
+			t.Error(err)
+		}
+		if n != i {
+			t.Error("Expected", i, "got", n)
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := db.Incr("counter", 1)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := helpers.Get[int64](db, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 103 {
+		t.Error("Lost increments, expected 103, got", n)
+	}
+
+	_, err = db.IncrFloat("float", 1.5)
+	if err != nil {
+		t.Error(err)
+	}
+	f, err := db.IncrFloat("float", -0.25)
+	if err != nil {
+		t.Error(err)
+	}
+	if f != 1.25 {
+		t.Error("Expected 1.25, got", f)
+	}
+
+	_, err = db.Incr("float", 1)
+	if err == nil {
+		t.Error("Expected error incrementing float by integer")
+	}
+}
+
 func TestMain(m *testing.M) {
 	code := m.Run()
 	db.Close()
 	os.Exit(code)
 }
+
+func TestPubSub(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgs := helpers.Subscribe[string](ctx, db.(helpers.SubscribeHelper), "events/")
+
+	pub := db.(storage.Publisher)
+	err := pub.Publish("other", "skipped")
+	if err != nil {
+		t.Error(err)
+	}
+	err = pub.Publish("events/a", "one")
+	if err != nil {
+		t.Error(err)
+	}
+
+	select {
+	case msg := <-msgs:
+		if msg.Key != "events/a" || msg.Value != "one" {
+			t.Error("Expected events/a one, got", msg.Key, msg.Value)
+		}
+	case <-ctx.Done():
+		t.Fatal("Message not received")
+	}
+
+	if db.Exists("events/a") {
+		t.Error("Message was stored")
+	}
+}
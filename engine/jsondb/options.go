@@ -2,8 +2,10 @@ package jsondb
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/history"
 )
 
 type JsonDBOpts func(*JsonDB) error
@@ -23,6 +25,15 @@ func Dir(dir string) JsonDBOpts {
 	}
 }
 
+// Keep last keep versions of every key within retention, zero disables limit.
+// History is kept in memory, it is not saved to file.
+func History(keep int, retention time.Duration) JsonDBOpts {
+	return func(j *JsonDB) error {
+		j.history = history.NewChain(keep, retention)
+		return nil
+	}
+}
+
 func Logger(lg storage.Logger) JsonDBOpts {
 	return func(j *JsonDB) error {
 		j.lg = lg
@@ -0,0 +1,122 @@
+package layered
+
+import (
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/keypath"
+)
+
+// layer transcodes keys and values between its connection and top layer encoding
+type layer struct {
+	storage.Connection
+
+	top    encoding.Coder
+	keys   bool // keys have to be transcoded
+	values bool // values have to be transcoded
+}
+
+func newLayer(conn, top storage.Connection) *layer {
+	return &layer{
+		Connection: conn,
+		top:        top.Encoding(),
+		keys:       conn.Encoding().Symbols() != top.Encoding().Symbols(),
+		values:     valueCoder(conn.Encoding()) != valueCoder(top.Encoding()),
+	}
+}
+
+// valueCoder returns type of value coder
+func valueCoder(c encoding.Coder) reflect.Type {
+	if pair, ok := c.(*encoding.CoderPair); ok {
+		return reflect.TypeOf(pair.ValueCoder)
+	}
+	return reflect.TypeOf(c)
+}
+
+// key converts top layer key to layer key
+func (l *layer) key(k string) string {
+	if !l.keys {
+		return k
+	}
+	buckets, name := keypath.Parse(l.top, k)
+	return keypath.EncodeKey(l.Encoding(), buckets, name)
+}
+
+// topKey converts layer key to top layer key
+func (l *layer) topKey(k string) string {
+	if !l.keys {
+		return k
+	}
+	buckets, name := keypath.Parse(l.Encoding(), k)
+	return keypath.EncodeKey(l.top, buckets, name)
+}
+
+// prefix converts top layer prefix to layer prefix
+func (l *layer) prefix(pfx string) string {
+	sym := l.top.Symbols()
+	if !l.keys || !strings.HasPrefix(pfx, sym.BucketKey[0]) {
+		return pfx
+	}
+
+	// bucket with key prefix
+	if buckets, name := keypath.Parse(l.top, pfx); buckets != nil {
+		return keypath.EncodeKey(l.Encoding(), buckets, name)
+	}
+
+	inner := pfx[len(sym.BucketKey[0]):]
+
+	// whole bucket
+	if strings.HasSuffix(inner, sym.BucketKey[1]) {
+		inner = strings.TrimSuffix(inner, sym.BucketKey[1])
+		return l.Encoding().EncodeBucket(strings.Split(inner, sym.Delimiter)...)
+	}
+
+	// incomplete bucket name
+	lsym := l.Encoding().Symbols()
+	return lsym.BucketKey[0] + strings.Join(strings.Split(inner, sym.Delimiter), lsym.Delimiter)
+}
+
+// value converts layer value to top layer encoding
+func (l *layer) value(data []byte) ([]byte, error) {
+	if !l.values {
+		return data, nil
+	}
+
+	var val any
+	err := l.Encoding().DecodeValue(data, &val)
+	if err != nil {
+		return nil, err
+	}
+	return l.top.EncodeValue(integers(internal.FixValue(val)))
+}
+
+// integers converts whole floats to integers, so values decoded from JSON can be decoded into integers
+// after encoding with other coder
+func integers(v any) any {
+	switch v := v.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+		return v
+
+	case map[string]any:
+		for k, val := range v {
+			v[k] = integers(val)
+		}
+		return v
+
+	case []any:
+		for i, val := range v {
+			v[i] = integers(val)
+		}
+		return v
+
+	default:
+		return v
+	}
+}
@@ -0,0 +1,607 @@
+// Package layered combines several connections into one, like overlay filesystem.
+//
+// Layers are ordered by priority, first layer is the top one. Reads fall through from top to bottom layer,
+// writes go only to the top layer and lower layers are never modified. Deleting key which exists
+// in lower layer stores whiteout in the top layer, key in bucket is whited out by ".wh.<key>" key in the same bucket,
+// so keys starting with ".wh." are reserved.
+//
+// Layers can use different encodings, keys and values of lower layers are transcoded to the top layer encoding.
+// Transcoding of values works only with coders created by encoding.NewCoder.
+package layered
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/keypath"
+)
+
+var (
+	_ storage.Connection = (*Layered)(nil)
+)
+
+// prefix of whiteout key
+const whiteout = ".wh."
+
+// top layer operations, implemented by connection and running transaction
+type top interface {
+	storage.Getter
+	storage.Setter
+	storage.Deleter
+	storage.Incrementer
+	storage.Iterator
+}
+
+type Layered struct {
+	top    top
+	layers []*layer // layers[0] is top connection
+
+	// context
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Logger
+	lg storage.Logger
+}
+
+// New combines layers, first layer is the top one. Closing connection closes all layers.
+func New(layers []storage.Connection, opts ...LayeredOpts) (storage.Connection, error) {
+	if len(layers) == 0 {
+		return nil, errors.New("no layers")
+	}
+
+	l := &Layered{
+		top: layers[0],
+		lg:  &internal.SimpleLogger{},
+	}
+
+	for _, conn := range layers {
+		l.layers = append(l.layers, newLayer(conn, layers[0]))
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(l)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if l.ctx == nil {
+		// Add default context
+		Context(context.Background())(l)
+	}
+
+	return l, nil
+}
+
+func (l *Layered) Close() {
+	l.cancel()
+	for _, layer := range l.layers {
+		layer.Close()
+	}
+}
+
+func (l *Layered) Encoding() encoding.Coder {
+	return l.layers[0].Encoding()
+}
+
+func (l *Layered) Bucket(bucket ...string) *storage.Bucket {
+	return storage.NewBucket(l, l.Encoding().DecodeBucket(bucket...)...)
+}
+
+func (l *Layered) PrintDebug(pfx string) error {
+	out := map[string]any{}
+	err := l.each(l.ctx, pfx, func(item types.Item[string, []byte]) error {
+		val, err := helpers.Decode[any](l.Encoding(), item.Value)
+		if err != nil {
+			return err
+		}
+		out[item.Key] = internal.FixValue(val)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	internal.PrintJSON(out)
+	return nil
+}
+
+// whiteoutKey returns whiteout of key
+func (l *Layered) whiteoutKey(k string) string {
+	buckets, name := keypath.Parse(l.Encoding(), k)
+	return keypath.EncodeKey(l.Encoding(), buckets, whiteout+name)
+}
+
+// whitedOut returns key hidden by whiteout k
+func (l *Layered) whitedOut(k string) (string, bool) {
+	buckets, name := keypath.Parse(l.Encoding(), k)
+	if !strings.HasPrefix(name, whiteout) {
+		return "", false
+	}
+	return keypath.EncodeKey(l.Encoding(), buckets, strings.TrimPrefix(name, whiteout)), true
+}
+
+// whiteoutPrefix returns prefix of whiteouts hiding keys starting with pfx
+func (l *Layered) whiteoutPrefix(pfx string) string {
+	if pfx == "" {
+		return ""
+	}
+
+	if !strings.HasPrefix(pfx, l.Encoding().Symbols().BucketKey[0]) {
+		return whiteout + pfx
+	}
+
+	if buckets, name := keypath.Parse(l.Encoding(), pfx); buckets != nil {
+		return keypath.EncodeKey(l.Encoding(), buckets, whiteout+name)
+	}
+
+	// whole bucket contains its whiteouts
+	return pfx
+}
+
+// lookup returns value of key in top layer encoding and index of layer containing it or its whiteout
+func (l *Layered) lookup(k string) ([]byte, int, error) {
+	var raw encoding.Raw
+	err := l.top.Get(k, &raw)
+	if !errors.Is(err, storage.ErrNotFound) {
+		return raw, 0, err
+	}
+
+	if l.top.Exists(l.whiteoutKey(k)) {
+		return nil, 0, fmt.Errorf("get %s: %w", k, storage.ErrNotFound)
+	}
+
+	for i, layer := range l.layers[1:] {
+		err := layer.Get(layer.key(k), &raw)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, i + 1, err
+		}
+
+		data, err := layer.value(raw)
+		return data, i + 1, err
+	}
+
+	return nil, len(l.layers), fmt.Errorf("get %s: %w", k, storage.ErrNotFound)
+}
+
+func (l *Layered) Set(k string, v any, op ...storage.Option) error {
+	l.lg.Debug("SET", k, v)
+	err := l.top.Set(k, v, op...)
+	if err != nil {
+		return err
+	}
+
+	// key is visible again
+	wh := l.whiteoutKey(k)
+	if l.top.Exists(wh) {
+		return l.top.Delete(wh)
+	}
+	return nil
+}
+
+func (l *Layered) Get(k string, v any) error {
+	l.lg.Debug("GET", k)
+	err := l.top.Get(k, v)
+	if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	if l.top.Exists(l.whiteoutKey(k)) {
+		return fmt.Errorf("get %s: %w", k, storage.ErrNotFound)
+	}
+
+	for _, layer := range l.layers[1:] {
+		err := layer.Get(layer.key(k), v)
+		if !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("get %s: %w", k, storage.ErrNotFound)
+}
+
+func (l *Layered) Exists(k string) bool {
+	l.lg.Debug("EXISTS", k)
+	if l.top.Exists(k) {
+		return true
+	}
+
+	if l.top.Exists(l.whiteoutKey(k)) {
+		return false
+	}
+
+	for _, layer := range l.layers[1:] {
+		if layer.Exists(layer.key(k)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Layered) Delete(k string) error {
+	l.lg.Debug("DELETE", k)
+
+	for _, layer := range l.layers[1:] {
+		if !layer.Exists(layer.key(k)) {
+			continue
+		}
+
+		// whiteout is stored first, so lower value is never visible
+		err := l.top.Set(l.whiteoutKey(k), true)
+		if err != nil {
+			return err
+		}
+		break
+	}
+
+	return l.top.Delete(k)
+}
+
+// Incr adds delta to integer value of key in the top layer
+func (l *Layered) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	l.lg.Debug("INCR", k, delta)
+	return incr(l, k, func() (int64, error) {
+		return l.top.Incr(k, delta, op...)
+	})
+}
+
+// IncrFloat adds delta to float value of key in the top layer
+func (l *Layered) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	l.lg.Debug("INCRFLOAT", k, delta)
+	return incr(l, k, func() (float64, error) {
+		return l.top.IncrFloat(k, delta, op...)
+	})
+}
+
+// incr copies value of lower layer to the top layer before first increment,
+// concurrent first increments of value from lower layer can overwrite each other
+func incr[T internal.Number](l *Layered, k string, fn func() (T, error)) (T, error) {
+	wh := l.whiteoutKey(k)
+	if !l.top.Exists(k) && !l.top.Exists(wh) {
+		data, _, err := l.lookup(k)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return 0, err
+		}
+		if err == nil {
+			err = l.top.Set(k, encoding.Raw(data))
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	n, err := fn()
+	if err != nil {
+		return n, err
+	}
+
+	// key is visible again
+	if l.top.Exists(wh) {
+		return n, l.top.Delete(wh)
+	}
+	return n, nil
+}
+
+// each calls fn for every visible item starting with pfx, items of top layer first
+func (l *Layered) each(ctx context.Context, pfx string, fn func(item types.Item[string, []byte]) error) error {
+	// keys already seen or whited out
+	hidden := map[string]struct{}{}
+	for item := range l.top.Iter(ctx, l.whiteoutPrefix(pfx)) {
+		if k, ok := l.whitedOut(item.Key); ok && strings.HasPrefix(k, pfx) {
+			hidden[k] = struct{}{}
+		}
+	}
+
+	for i, layer := range l.layers {
+		var items types.Iterator[string, []byte]
+		if i == 0 {
+			items = l.top.Iter(ctx, pfx)
+		} else {
+			items = layer.Iter(ctx, layer.prefix(pfx))
+		}
+
+		for item := range items {
+			k := layer.topKey(item.Key)
+			if _, ok := l.whitedOut(k); ok || !strings.HasPrefix(k, pfx) {
+				continue
+			}
+
+			if _, exists := hidden[k]; exists {
+				continue
+			}
+			hidden[k] = struct{}{}
+
+			data, err := layer.value(item.Value)
+			if err != nil {
+				l.lg.Warn("decode", "err", err, "key", k)
+				continue
+			}
+
+			err = fn(types.Item[string, []byte]{Key: k, Value: data})
+			if err != nil {
+				// drain, so layer iterator is not blocked
+				for range items {
+				}
+				return err
+			}
+		}
+	}
+
+	return ctx.Err()
+}
+
+func (l *Layered) Len(pfx string) (int, error) {
+	l.lg.Debug("LEN", pfx)
+	n := 0
+	err := l.each(l.ctx, pfx, func(types.Item[string, []byte]) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+func (l *Layered) Keys(pfx string) ([]string, error) {
+	l.lg.Debug("KEYS", pfx)
+	keys := []string{}
+	err := l.each(l.ctx, pfx, func(item types.Item[string, []byte]) error {
+		keys = append(keys, item.Key)
+		return nil
+	})
+	return keys, err
+}
+
+func (l *Layered) Values(pfx string) ([][]byte, error) {
+	l.lg.Debug("VALUES", pfx)
+	values := [][]byte{}
+	err := l.each(l.ctx, pfx, func(item types.Item[string, []byte]) error {
+		values = append(values, item.Value)
+		return nil
+	})
+	return values, err
+}
+
+func (l *Layered) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
+	l.lg.Debug("ITER", pfx)
+	out := make(chan types.Item[string, []byte])
+	go func() {
+		defer close(out)
+		err := l.each(ctx, pfx, func(item types.Item[string, []byte]) error {
+			select {
+			case out <- item:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			l.lg.Error(err)
+		}
+	}()
+	return out
+}
+
+// layer event
+type event struct {
+	layer int
+	msg   types.WatchMsg[string, []byte]
+}
+
+// Watch reports changes of visible values, changes of keys shadowed by higher layer are skipped
+func (l *Layered) Watch(ctx context.Context, pfx string) types.Watcher[string, []byte] {
+	l.lg.Debug("WATCH", pfx)
+	out := make(chan types.WatchMsg[string, []byte])
+	events := make(chan event)
+
+	wg := sync.WaitGroup{}
+	forward := func(i int, w types.Watcher[string, []byte]) {
+		defer wg.Done()
+		// keep draining after ctx is done, so layer watcher is not blocked
+		for msg := range w {
+			select {
+			case events <- event{layer: i, msg: msg}:
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	for i, layer := range l.layers {
+		wg.Add(1)
+		go forward(i, layer.Watch(ctx, layer.prefix(pfx)))
+	}
+
+	if wpfx := l.whiteoutPrefix(pfx); !strings.HasPrefix(wpfx, pfx) {
+		wg.Add(1)
+		go forward(0, l.layers[0].Watch(ctx, wpfx))
+	}
+
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	go func() {
+		defer close(out)
+		for ev := range events {
+			msg, ok := l.resolve(ev, pfx)
+			if !ok {
+				continue
+			}
+
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return out
+}
+
+// resolve layer event into change of visible value
+func (l *Layered) resolve(ev event, pfx string) (types.WatchMsg[string, []byte], bool) {
+	k := l.layers[ev.layer].topKey(ev.msg.Key)
+	if orig, ok := l.whitedOut(k); ok {
+		// removed whiteout is followed by put of key
+		if ev.msg.Event != types.PutEvent {
+			return types.WatchMsg[string, []byte]{}, false
+		}
+		k = orig
+	}
+
+	if !strings.HasPrefix(k, pfx) {
+		return types.WatchMsg[string, []byte]{}, false
+	}
+
+	data, i, err := l.lookup(k)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		l.lg.Error("watch", k, err)
+		return types.WatchMsg[string, []byte]{}, false
+	}
+
+	// shadowed by higher layer
+	if i < ev.layer {
+		return types.WatchMsg[string, []byte]{}, false
+	}
+
+	msg := types.WatchMsg[string, []byte]{
+		Event: types.PutEvent,
+		Item:  types.Item[string, []byte]{Key: k, Value: data},
+	}
+	if err != nil {
+		msg.Event = types.DeleteEvent
+		msg.Value = nil
+	}
+	return msg, true
+}
+
+// Tx runs fn in transaction of the top layer, lower layers are read outside of transaction
+func (l *Layered) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
+	l.lg.Debug("TX", pfx)
+	return l.layers[0].Tx(pfx, func(tx storage.Transactioner) error {
+		conn := *l
+		conn.top = &txTop{tx: tx, pfx: l.Encoding().EncodeKey(pfx, "")}
+		return fn(conn.Bucket(pfx))
+	})
+}
+
+// txTop adapts transaction bound to bucket to full keys
+type txTop struct {
+	tx  storage.Transactioner
+	pfx string // prefix of keys in transaction bucket
+}
+
+func (t *txTop) rel(k string) (string, error) {
+	if !strings.HasPrefix(k, t.pfx) {
+		return "", fmt.Errorf("key %q outside of transaction bucket", k)
+	}
+	return strings.TrimPrefix(k, t.pfx), nil
+}
+
+func (t *txTop) Set(k string, v any, op ...storage.Option) error {
+	rel, err := t.rel(k)
+	if err != nil {
+		return err
+	}
+	return t.tx.Set(rel, v, op...)
+}
+
+func (t *txTop) Get(k string, v any) error {
+	rel, err := t.rel(k)
+	if err != nil {
+		return err
+	}
+	return t.tx.Get(rel, v)
+}
+
+func (t *txTop) Exists(k string) bool {
+	rel, err := t.rel(k)
+	if err != nil {
+		return false
+	}
+	return t.tx.Exists(rel)
+}
+
+func (t *txTop) Delete(k string) error {
+	rel, err := t.rel(k)
+	if err != nil {
+		return err
+	}
+	return t.tx.Delete(rel)
+}
+
+func (t *txTop) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	rel, err := t.rel(k)
+	if err != nil {
+		return 0, err
+	}
+	if inc, ok := t.tx.(storage.Incrementer); ok {
+		return inc.Incr(rel, delta, op...)
+	}
+	return txIncr(t.tx, rel, delta, op)
+}
+
+func (t *txTop) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	rel, err := t.rel(k)
+	if err != nil {
+		return 0, err
+	}
+	if inc, ok := t.tx.(storage.Incrementer); ok {
+		return inc.IncrFloat(rel, delta, op...)
+	}
+	return txIncr(t.tx, rel, delta, op)
+}
+
+// txIncr increments value with Get and Set of transaction
+func txIncr[T internal.Number](tx storage.Transactioner, k string, delta T, op []storage.Option) (T, error) {
+	var n T
+	err := tx.Get(k, &n)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return n, fmt.Errorf("incr %s: %w", k, err)
+	}
+	if err == nil {
+		// TTL is set when key is created
+		op = nil
+	}
+
+	n += delta
+	return n, tx.Set(k, n, op...)
+}
+
+func (t *txTop) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
+	out := make(chan types.Item[string, []byte])
+
+	rel, err := t.rel(pfx)
+	if err != nil {
+		if !strings.HasPrefix(t.pfx, pfx) {
+			// no key of transaction bucket matches
+			close(out)
+			return out
+		}
+		rel = ""
+	}
+
+	go func() {
+		defer close(out)
+		for item := range t.tx.Iter(ctx, rel) {
+			item.Key = t.pfx + item.Key
+			select {
+			case out <- item:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,511 @@
+package layered_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/engine/jsondb"
+	"github.com/rafalb8/go-storage/engine/layered"
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+)
+
+var (
+	dir       = internal.Must(os.MkdirTemp("", "go-storage-layered"))
+	defaults  = internal.Must(jsondb.New(jsondb.File(filepath.Join(dir, "defaults.json"))))
+	overrides = internal.Must(memory.New())
+	top       = internal.Must(memory.New())
+	db        = internal.Must(layered.New([]storage.Connection{top, overrides, defaults}))
+)
+
+func TestGetSet(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test2", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value not 1")
+	}
+
+	var two int
+	err = db.Get("test2", &two)
+	if err != nil {
+		t.Error(err)
+	}
+	if two != 2 {
+		t.Error("Value not 2")
+	}
+}
+
+func TestDeleteExists(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !db.Exists("test1") {
+		t.Log("Value not created")
+	}
+
+	err = db.Delete("test1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if db.Exists("test1") {
+		t.Log("Value not deleted")
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err == nil {
+		t.Error("Got value, expected error")
+	}
+	if val != 0 {
+		t.Error("Expected zero value")
+	}
+}
+
+func TestIter(t *testing.T) {
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	i := 0
+	for item := range helpers.Iter[rune](context.Background(), db) {
+		i++
+		switch item.Key {
+		case "one":
+			if item.Value != '1' {
+				t.Error("Value not 1")
+			}
+		case "two":
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+		default:
+			i--
+		}
+	}
+
+	if i < 2 {
+		t.Error("Not full iteration")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hit := make(chan struct{})
+
+	go func() {
+		for item := range helpers.Watch[rune](ctx, db, "two") {
+			if item.Event != types.PutEvent {
+				t.Error("Not Put Event")
+			}
+			if item.Key != "two" {
+				t.Error("Key not two")
+			}
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+			hit <- struct{}{}
+		}
+	}()
+
+	// Magic sleep
+	time.Sleep(1 * time.Second)
+
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts := time.NewTimer(3 * time.Second)
+	defer ts.Stop()
+
+	select {
+	case <-hit:
+	case <-ts.C:
+		t.Error("Change not found")
+	}
+}
+
+func TestLenKeyVals(t *testing.T) {
+	err := db.Set("test/one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test/two", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	length, err := db.Len("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if length < 2 {
+		t.Error("Len < 2")
+	}
+
+	keys, err := db.Keys("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(keys) < 2 {
+		t.Error("Keys Len < 2")
+	}
+
+	vals, err := db.Values("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(vals) < 2 {
+		t.Error("Vals Len < 2")
+	}
+}
+
+func TestTx(t *testing.T) {
+	const workers = 5
+	bucket := db.Bucket("tx")
+
+	err := bucket.Set("counter", 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := bucket.Tx(func(tx storage.Transactioner) error {
+				val, err := helpers.Get[int](tx, "counter")
+				if err != nil {
+					return err
+				}
+				return tx.Set("counter", val+1)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	val, err := helpers.Get[int](bucket, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != workers {
+		t.Error("Counter not", workers, "got", val)
+	}
+}
+
+// layers returns new layered connection with its top, overrides and defaults layers
+func layers(t *testing.T) (storage.Connection, storage.Connection, storage.Connection, storage.Connection) {
+	defaults, err := jsondb.New(jsondb.File(filepath.Join(t.TempDir(), "defaults.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	top, overrides := internal.Must(memory.New()), internal.Must(memory.New())
+	db, err := layered.New([]storage.Connection{top, overrides, defaults})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(db.Close)
+	return db, top, overrides, defaults
+}
+
+func TestFallthrough(t *testing.T) {
+	db, top, overrides, defaults := layers(t)
+	bucket := db.Bucket("fallthrough")
+
+	err := defaults.Bucket("fallthrough").Set("one", map[string]any{"name": "default"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[map[string]string](bucket, "one")
+	if err != nil {
+		t.Error(err)
+	}
+	if val["name"] != "default" {
+		t.Error("Value not default")
+	}
+
+	err = overrides.Bucket("fallthrough").Set("one", map[string]any{"name": "override"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err = helpers.Get[map[string]string](bucket, "one")
+	if err != nil {
+		t.Error(err)
+	}
+	if val["name"] != "override" {
+		t.Error("Value not override")
+	}
+
+	err = bucket.Set("one", map[string]any{"name": "top"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !top.Bucket("fallthrough").Exists("one") {
+		t.Error("Value not written to top layer")
+	}
+
+	def, err := helpers.Get[map[string]string](defaults.Bucket("fallthrough"), "one")
+	if err != nil {
+		t.Error(err)
+	}
+	if def["name"] != "default" {
+		t.Error("Lower layer modified")
+	}
+}
+
+func TestWhiteout(t *testing.T) {
+	db, _, _, defaults := layers(t)
+	bucket := db.Bucket("whiteout")
+
+	err := defaults.Bucket("whiteout").Set("one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = defaults.Bucket("whiteout").Set("two", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = bucket.Delete("one")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if bucket.Exists("one") {
+		t.Error("Value not deleted")
+	}
+
+	_, err = helpers.Get[int](bucket, "one")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Error("Expected not found, got", err)
+	}
+
+	if !defaults.Bucket("whiteout").Exists("one") {
+		t.Error("Lower layer modified")
+	}
+
+	keys, err := bucket.Keys()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(keys) != 1 || keys[0] != "two" {
+		t.Error("Unexpected keys", keys)
+	}
+
+	err = bucket.Set("one", 11)
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[int](bucket, "one")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 11 {
+		t.Error("Value not 11")
+	}
+
+	length, err := bucket.Len()
+	if err != nil {
+		t.Error(err)
+	}
+	if length != 2 {
+		t.Error("Len not 2, got", length)
+	}
+}
+
+func TestWatchLayers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, _, defaults := layers(t)
+	bucket := db.Bucket("watch")
+	events := helpers.Watch[int](ctx, bucket, "")
+
+	// Magic sleep
+	time.Sleep(100 * time.Millisecond)
+
+	next := func() types.WatchMsg[string, int] {
+		select {
+		case item := <-events:
+			return item
+		case <-time.After(3 * time.Second):
+			t.Error("Change not found")
+			return types.WatchMsg[string, int]{}
+		}
+	}
+
+	err := defaults.Bucket("watch").Set("one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	item := next()
+	if item.Event != types.PutEvent || item.Key != "one" || item.Value != 1 {
+		t.Error("Unexpected event", item)
+	}
+
+	err = bucket.Delete("one")
+	if err != nil {
+		t.Error(err)
+	}
+
+	item = next()
+	if item.Event != types.DeleteEvent || item.Key != "one" {
+		t.Error("Unexpected event", item)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	db.Delete("counter")
+	db.Delete("float")
+
+	for i := int64(1); i <= 3; i++ {
+		n, err := db.Incr("counter", 1)
+		if err != nil {
+			t.Error(err)
+		}
+		if n != i {
+			t.Error("Expected", i, "got", n)
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := db.Incr("counter", 1)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := helpers.Get[int64](db, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 103 {
+		t.Error("Lost increments, expected 103, got", n)
+	}
+
+	_, err = db.IncrFloat("float", 1.5)
+	if err != nil {
+		t.Error(err)
+	}
+	f, err := db.IncrFloat("float", -0.25)
+	if err != nil {
+		t.Error(err)
+	}
+	if f != 1.25 {
+		t.Error("Expected 1.25, got", f)
+	}
+
+	_, err = db.Incr("float", 1)
+	if err == nil {
+		t.Error("Expected error incrementing float by integer")
+	}
+}
+
+func TestIncrCopyUp(t *testing.T) {
+	db, top, _, defaults := layers(t)
+	bucket := db.Bucket("incr")
+
+	err := defaults.Bucket("incr").Set("counter", 5)
+	if err != nil {
+		t.Error(err)
+	}
+
+	n, err := bucket.Incr("counter", 1)
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 6 {
+		t.Error("Expected 6, got", n)
+	}
+	if !top.Bucket("incr").Exists("counter") {
+		t.Error("Counter not copied to top layer")
+	}
+
+	def, err := helpers.Get[int64](defaults.Bucket("incr"), "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if def != 5 {
+		t.Error("Lower layer modified")
+	}
+
+	err = bucket.Delete("counter")
+	if err != nil {
+		t.Error(err)
+	}
+
+	// deleted counter starts from zero
+	n, err = bucket.Incr("counter", 1)
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 1 {
+		t.Error("Expected 1, got", n)
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	db.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,23 @@
+package layered
+
+import (
+	"context"
+
+	"github.com/rafalb8/go-storage"
+)
+
+type LayeredOpts func(*Layered) error
+
+func Context(ctx context.Context) LayeredOpts {
+	return func(l *Layered) error {
+		l.ctx, l.cancel = context.WithCancel(ctx)
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) LayeredOpts {
+	return func(l *Layered) error {
+		l.lg = lg
+		return nil
+	}
+}
@@ -2,7 +2,9 @@ package memory
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,20 +15,37 @@ import (
 	"github.com/rafalb8/go-storage/encoding/key"
 	"github.com/rafalb8/go-storage/encoding/value"
 	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/history"
 	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/hub"
 	"github.com/rafalb8/go-storage/options"
 )
 
 var (
-	_ storage.Connection = (*InMemory)(nil)
+	_ storage.Connection    = (*InMemory)(nil)
+	_ history.TimeHistorian = (*InMemory)(nil)
+	_ storage.Publisher     = (*InMemory)(nil)
 )
 
 type InMemory struct {
 	data     maps.EventfulMaper[string, []byte] // database data
 	encoding encoding.Coder                     // db key/value encoder
 
+	// version chain, nil when history is disabled
+	history *history.Chain
+	// orders writes of data with versions recorded in history
+	mtx sync.Mutex
+
 	// prefix mutex map
 	pfxMutex maps.Maper[string, sync.Locker]
+	// key mutexes ordering Incr with Set, Delete and expiration of the same key
+	keyMutex internal.Stripes
+
+	// TTL timers
+	timers maps.Maper[string, *time.Timer]
+
+	// published messages, kept apart from data map
+	topics *hub.Hub[types.Item[string, []byte]]
 
 	// cancel for data map event watcher/hub
 	cancel context.CancelFunc
@@ -43,6 +62,8 @@ func New(opts ...MemoryOpts) (storage.Connection, error) {
 		encoding: encoding.NewCoder(key.Binary, value.CBOR),
 
 		pfxMutex: maps.New[string, sync.Locker](nil).Safe(),
+		timers:   maps.New[string, *time.Timer](nil).Safe(),
+		topics:   hub.New[types.Item[string, []byte]](),
 		cancel:   cancel,
 		lg:       &internal.SimpleLogger{},
 	}
@@ -92,21 +113,70 @@ func (m *InMemory) Set(k string, v any, op ...storage.Option) error {
 	if err != nil {
 		return err
 	}
-	m.data.Set(k, data)
 
+	mtx := m.keyMutex.Of(k)
+	mtx.Lock()
+	defer mtx.Unlock()
+	m.set(k, data, op)
+	return nil
+}
+
+// set encoded value of key and apply options, TTL of key is removed when none is given
+func (m *InMemory) set(k string, data []byte, op []storage.Option) {
+	m.store(k, data)
+
+	ttl := time.Duration(0)
 	for _, opt := range op {
 		switch opt := opt.(type) {
 		case *options.TTLOption:
-			go func(d time.Duration) {
-				time.Sleep(d)
-				m.data.Delete(k)
-			}(opt.Value)
+			ttl = opt.Value
 
 		default:
 			m.lg.Warn("Unsupported option: %T", opt)
 		}
 	}
-	return nil
+	m.expire(k, ttl)
+}
+
+// store encoded value of key and record it in history, TTL of key is kept
+func (m *InMemory) store(k string, data []byte) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.data.Set(k, data)
+	if m.history != nil {
+		m.history.Set(k, data)
+	}
+}
+
+// Incr adds delta to integer value of key under key lock
+func (m *InMemory) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	m.lg.Debug("INCR", k, delta)
+	return incr(m, k, delta, op)
+}
+
+// IncrFloat adds delta to float value of key under key lock
+func (m *InMemory) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	m.lg.Debug("INCRFLOAT", k, delta)
+	return incr(m, k, delta, op)
+}
+
+func incr[T internal.Number](m *InMemory, k string, delta T, op []storage.Option) (T, error) {
+	mtx := m.keyMutex.Of(k)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	data, exists := m.data.GetFull(k)
+	n, data, err := internal.Incr(m.encoding, data, delta)
+	if err != nil {
+		return n, fmt.Errorf("incr %s: %w", k, err)
+	}
+	if exists {
+		// TTL is set when key is created, existing TTL is kept
+		m.store(k, data)
+		return n, nil
+	}
+	m.set(k, data, op)
+	return n, nil
 }
 
 func (m *InMemory) Get(k string, v any) error {
@@ -125,10 +195,96 @@ func (m *InMemory) Exists(k string) bool {
 
 func (m *InMemory) Delete(k string) error {
 	m.lg.Debug("DELETE", k)
-	m.data.Delete(k)
+	mtx := m.keyMutex.Of(k)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	m.expire(k, 0)
+	m.remove(k)
 	return nil
 }
 
+// expire removes key after ttl, previous TTL of key is replaced, zero ttl only cancels it
+func (m *InMemory) expire(k string, ttl time.Duration) {
+	m.timers.Commit(func(timers map[string]*time.Timer) {
+		if timer, exists := timers[k]; exists {
+			timer.Stop()
+			delete(timers, k)
+		}
+
+		if ttl <= 0 {
+			return
+		}
+
+		var timer *time.Timer
+		timer = time.AfterFunc(ttl, func() {
+			mtx := m.keyMutex.Of(k)
+			mtx.Lock()
+			defer mtx.Unlock()
+
+			expired := false
+			m.timers.Commit(func(timers map[string]*time.Timer) {
+				// replaced meanwhile
+				if timers[k] != timer {
+					return
+				}
+				delete(timers, k)
+				expired = true
+			})
+
+			if expired {
+				m.remove(k)
+			}
+		})
+		timers[k] = timer
+	})
+}
+
+// remove key and record delete in history
+func (m *InMemory) remove(k string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.history != nil && m.data.Exists(k) {
+		m.history.Delete(k)
+	}
+	m.data.Delete(k)
+}
+
+// History returns kept versions of key, History option has to be enabled
+func (m *InMemory) History(k string) ([]history.Version, error) {
+	m.lg.Debug("HISTORY", k)
+	if m.history == nil {
+		return nil, errors.New("memory: history not enabled. Use History option")
+	}
+	return m.history.History(k)
+}
+
+func (m *InMemory) GetAt(k string, rev int64, v any) error {
+	m.lg.Debug("GETAT", k, rev)
+	if m.history == nil {
+		return errors.New("memory: history not enabled. Use History option")
+	}
+
+	version, err := m.history.At(k, rev)
+	if err != nil {
+		return err
+	}
+	return m.encoding.DecodeValue(version.Value, v)
+}
+
+func (m *InMemory) GetAtTime(k string, t time.Time, v any) error {
+	m.lg.Debug("GETAT", k, t)
+	if m.history == nil {
+		return errors.New("memory: history not enabled. Use History option")
+	}
+
+	version, err := m.history.AtTime(k, t)
+	if err != nil {
+		return err
+	}
+	return m.encoding.DecodeValue(version.Value, v)
+}
+
 func (m *InMemory) Len(pfx string) (int, error) {
 	m.lg.Debug("LEN", pfx)
 	return maps.NewBucket[[]byte](m.data, pfx).Len(), nil
@@ -162,23 +318,77 @@ func (m *InMemory) Iter(ctx context.Context, pfx string) types.Iterator[string,
 func (m *InMemory) Watch(ctx context.Context, pfx string) types.Watcher[string, []byte] {
 	m.lg.Debug("WATCH", pfx)
 	out := make(chan types.WatchMsg[string, []byte])
+	// register before returning, so changes made after Watch returns are not missed
+	events := m.data.Register(ctx)
 	go func() {
 		defer close(out)
-		for event := range maps.NewBucket[[]byte](m.data, pfx).Watch(ctx) {
-			out <- types.WatchMsg[string, []byte]{
+		// client is closed by the hub after ctx is done,
+		// keep draining it so the hub never blocks
+		for event := range events {
+			if ctx.Err() != nil || !strings.HasPrefix(event.Key, pfx) {
+				continue
+			}
+
+			select {
+			case out <- types.WatchMsg[string, []byte]{
 				Event: event.Event,
 				Item: types.Item[string, []byte]{
 					Key: event.Key, Value: event.Value,
 				},
+			}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+// Publish delivers message to subscribers of topic without blocking, slow subscribers are disconnected
+func (m *InMemory) Publish(topic string, v any) error {
+	m.lg.Debug("PUBLISH", topic, v)
+	data, err := m.encoding.EncodeValue(v)
+	if err != nil {
+		return fmt.Errorf("encoder: %w", err)
+	}
+
+	m.topics.Publish(types.Item[string, []byte]{Key: topic, Value: data})
+	return nil
+}
+
+func (m *InMemory) Subscribe(ctx context.Context, topicPfx string) types.Iterator[string, []byte] {
+	m.lg.Debug("SUBSCRIBE", topicPfx)
+	out := make(chan types.Item[string, []byte])
+	msgs := m.topics.Subscribe(ctx)
+
+	go func() {
+		defer close(out)
+		for msg := range msgs {
+			if !strings.HasPrefix(msg.Key, topicPfx) {
+				continue
+			}
+
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
+
 	return out
 }
 
 func (m *InMemory) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
 	m.lg.Debug("TX", pfx)
 
+	mtx := m.lock(pfx)
+	mtx.Lock()
+	defer mtx.Unlock()
+	return fn(m.Bucket(pfx))
+}
+
+// lock returns mutex of transaction prefix
+func (m *InMemory) lock(pfx string) sync.Locker {
 	var mtx sync.Locker
 	m.pfxMutex.Commit(func(data map[string]sync.Locker) {
 		var exists bool
@@ -188,8 +398,5 @@ func (m *InMemory) Tx(pfx string, fn func(tx storage.Transactioner) error) error
 			data[pfx] = mtx
 		}
 	})
-
-	mtx.Lock()
-	defer mtx.Unlock()
-	return fn(m.Bucket(pfx))
+	return mtx
 }
@@ -3,13 +3,16 @@ package memory_test
 import (
 	"context"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
 	"github.com/rafalb8/go-storage/engine/memory"
 	"github.com/rafalb8/go-storage/helpers"
 	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/options"
 )
 
 var (
@@ -150,6 +153,71 @@ func TestWatch(t *testing.T) {
 	}
 }
 
+func TestWatchPrefix(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// registered before Watch returns, no sleep needed
+	events := db.Watch(ctx, "watch/a")
+	for _, k := range []string{"watch/b", "watch/a1", "watch/a2"} {
+		err := db.Set(k, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for _, k := range []string{"watch/b", "watch/a1", "watch/a2"} {
+			db.Delete(k)
+		}
+	}()
+
+	for _, k := range []string{"watch/a1", "watch/a2"} {
+		select {
+		case event := <-events:
+			if event.Key != k {
+				t.Error("expected", k, "got", event.Key)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("change of", k, "not found")
+		}
+	}
+
+	// cancelled watcher is drained, so writers are not blocked
+	cancel()
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 100; i++ {
+			err := db.Set("watch/a1", i)
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Set blocked by cancelled watcher")
+	}
+
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("watcher not closed")
+		}
+	}
+}
+
 func TestLenKeyVals(t *testing.T) {
 	err := db.Set("test/one", 1)
 	if err != nil {
@@ -189,8 +257,197 @@ func TestLenKeyVals(t *testing.T) {
 	}
 }
 
+func TestIncr(t *testing.T) {
+	db.Delete("counter")
+	db.Delete("float")
+
+	for i := int64(1); i <= 3; i++ {
+		n, err := db.Incr("counter", 1)
+		if err != nil {
+			t.Error(err)
+		}
+		if n != i {
+			t.Error("Expected", i, "got", n)
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := db.Incr("counter", 1)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := helpers.Get[int64](db, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 103 {
+		t.Error("Lost increments, expected 103, got", n)
+	}
+
+	_, err = db.IncrFloat("float", 1.5)
+	if err != nil {
+		t.Error(err)
+	}
+	f, err := db.IncrFloat("float", -0.25)
+	if err != nil {
+		t.Error(err)
+	}
+	if f != 1.25 {
+		t.Error("Expected 1.25, got", f)
+	}
+
+	_, err = db.Incr("float", 1)
+	if err == nil {
+		t.Error("Expected error incrementing float by integer")
+	}
+}
+
+func TestIncrTTL(t *testing.T) {
+	n, err := db.Incr("incr-ttl", 1, options.TTL(200*time.Millisecond))
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 1 {
+		t.Error("Expected 1, got", n)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	// TTL is not extended by increments
+	n, err = db.Incr("incr-ttl", 1, options.TTL(time.Hour))
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 2 {
+		t.Error("Expected 2, got", n)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if db.Exists("incr-ttl") {
+		t.Error("Counter not expired")
+	}
+}
+
+func TestTTLRenew(t *testing.T) {
+	err := db.Set("renew", 1, options.TTL(200*time.Millisecond))
+	if err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	err = db.Set("renew", 2, options.TTL(200*time.Millisecond))
+	if err != nil {
+		t.Error(err)
+	}
+
+	// first TTL is replaced
+	time.Sleep(150 * time.Millisecond)
+	if !db.Exists("renew") {
+		t.Error("Key expired by replaced TTL")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if db.Exists("renew") {
+		t.Error("Key not expired")
+	}
+}
+
+func TestTTLRemove(t *testing.T) {
+	err := db.Set("persist", 1, options.TTL(100*time.Millisecond))
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Set without TTL makes key persistent
+	err = db.Set("persist", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if !db.Exists("persist") {
+		t.Error("Key expired by removed TTL")
+	}
+	db.Delete("persist")
+}
+
 func TestMain(m *testing.M) {
 	code := m.Run()
 	db.Close()
 	os.Exit(code)
 }
+
+func TestPubSub(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgs := helpers.Subscribe[string](ctx, db.(helpers.SubscribeHelper), "events/")
+
+	pub := db.(storage.Publisher)
+	err := pub.Publish("other", "skipped")
+	if err != nil {
+		t.Error(err)
+	}
+	err = pub.Publish("events/a", "one")
+	if err != nil {
+		t.Error(err)
+	}
+
+	select {
+	case msg := <-msgs:
+		if msg.Key != "events/a" || msg.Value != "one" {
+			t.Error("Expected events/a one, got", msg.Key, msg.Value)
+		}
+	case <-ctx.Done():
+		t.Fatal("Message not received")
+	}
+
+	if db.Exists("events/a") {
+		t.Error("Message was stored")
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+	pub := conn.(storage.Publisher)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// never read while publishing
+	msgs := pub.Subscribe(ctx, "slow/")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			pub.Publish("slow/topic", i)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("Publish blocked by slow subscriber")
+	}
+
+	// slow subscriber is disconnected after queued messages
+	n := 0
+	for range msgs {
+		n++
+	}
+	if ctx.Err() != nil || n >= 1000 {
+		t.Error("Slow subscriber not disconnected, received", n)
+	}
+}
@@ -1,9 +1,22 @@
 package memory
 
-import "github.com/rafalb8/go-storage"
+import (
+	"time"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/history"
+)
 
 type MemoryOpts func(*InMemory) error
 
+// Keep last keep versions of every key within retention, zero disables limit
+func History(keep int, retention time.Duration) MemoryOpts {
+	return func(m *InMemory) error {
+		m.history = history.NewChain(keep, retention)
+		return nil
+	}
+}
+
 func Logger(lg storage.Logger) MemoryOpts {
 	return func(m *InMemory) error {
 		m.lg = lg
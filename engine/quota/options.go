@@ -0,0 +1,24 @@
+package quota
+
+import (
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/internal/keypath"
+)
+
+type QuotaOpts func(*Quota) error
+
+// Limit keys in buckets matching pattern, eg. "tenant/*" limits every bucket in tenant bucket separately.
+// "*" matches any bucket name, empty pattern limits whole database.
+func Limit(pattern string, limits Limits) QuotaOpts {
+	return func(q *Quota) error {
+		q.rules = append(q.rules, rule{pattern: keypath.Buckets(pattern), limits: limits})
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) QuotaOpts {
+	return func(q *Quota) error {
+		q.lg = lg
+		return nil
+	}
+}
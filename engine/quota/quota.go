@@ -0,0 +1,534 @@
+// Package quota wraps connection and limits number of keys and stored bytes per bucket.
+//
+// Usage is computed on start and kept up to date by watching limited buckets, so writes
+// made by other clients are counted too. Size of key is length of key plus length of encoded value.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/keypath"
+)
+
+var (
+	_ storage.Connection = (*Quota)(nil)
+)
+
+type Limits struct {
+	Keys  int   // max number of keys, 0 means unlimited
+	Bytes int64 // max size of keys and values, 0 means unlimited
+}
+
+type Usage struct {
+	Keys   int
+	Bytes  int64
+	Limits Limits
+}
+
+// QuotaError is returned when write would exceed quota, errors.Is(err, storage.ErrQuotaExceeded) reports true
+type QuotaError struct {
+	Bucket []string
+	Usage  Usage // usage after rejected write
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded: bucket %q: %d/%d keys, %d/%d bytes",
+		strings.Join(e.Bucket, keypath.Separator), e.Usage.Keys, e.Usage.Limits.Keys, e.Usage.Bytes, e.Usage.Limits.Bytes)
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == storage.ErrQuotaExceeded
+}
+
+type rule struct {
+	pattern []string
+	limits  Limits
+}
+
+// usage of single bucket matched by rule
+type usage struct {
+	bucket []string
+	limits Limits
+	sizes  map[string]int64
+	bytes  int64
+}
+
+func (u *usage) set(k string, size int64) {
+	u.bytes += size - u.sizes[k]
+	u.sizes[k] = size
+}
+
+func (u *usage) remove(k string) {
+	u.bytes -= u.sizes[k]
+	delete(u.sizes, k)
+}
+
+// check returns error when changing size of key from old to size exceeds limits, writes not growing usage are allowed
+func (u *usage) check(keys int, bytes int64, old int64, exists bool, size int64) error {
+	if !exists {
+		keys++
+	}
+	bytes += size - old
+
+	if (u.limits.Keys > 0 && keys > u.limits.Keys && !exists) || (u.limits.Bytes > 0 && bytes > u.limits.Bytes && size > old) {
+		return &QuotaError{
+			Bucket: u.bucket,
+			Usage:  Usage{Keys: keys, Bytes: bytes, Limits: u.limits},
+		}
+	}
+	return nil
+}
+
+type Quota struct {
+	storage.Connection
+
+	rules []rule
+
+	mtx   sync.Mutex
+	usage map[string]*usage // by rule and bucket
+
+	// events received during scans of Refresh, applied to fresh usage before it replaces current one
+	journals map[*[]types.WatchMsg[string, []byte]]struct{}
+
+	// context
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Logger
+	lg storage.Logger
+}
+
+// New wraps conn with quotas. Closing connection closes conn.
+func New(conn storage.Connection, opts ...QuotaOpts) (*Quota, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q := &Quota{
+		Connection: conn,
+		usage:      map[string]*usage{},
+		journals:   map[*[]types.WatchMsg[string, []byte]]struct{}{},
+		ctx:        ctx,
+		cancel:     cancel,
+		lg:         &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(q)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	// watch before scan, so no change is missed
+	for _, pfx := range q.prefixes() {
+		go q.watch(conn.Watch(ctx, pfx))
+	}
+
+	err := q.Refresh()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+func (q *Quota) Close() {
+	q.cancel()
+	q.Connection.Close()
+}
+
+func (q *Quota) Bucket(bucket ...string) *storage.Bucket {
+	return storage.NewBucket(q, q.Encoding().DecodeBucket(bucket...)...)
+}
+
+// prefixes returns distinct prefixes of limited buckets
+func (q *Quota) prefixes() []string {
+	sym := q.Encoding().Symbols()
+	seen := map[string]struct{}{}
+	out := []string{}
+
+	for _, r := range q.rules {
+		static := r.pattern
+		for i, name := range r.pattern {
+			if name == keypath.Wildcard {
+				static = r.pattern[:i]
+				break
+			}
+		}
+
+		pfx := ""
+		if len(static) > 0 {
+			pfx = sym.BucketKey[0] + strings.Join(static, sym.Delimiter)
+		}
+
+		if _, exists := seen[pfx]; !exists {
+			seen[pfx] = struct{}{}
+			out = append(out, pfx)
+		}
+	}
+	return out
+}
+
+// namespaces returns usage of all buckets limited by rules containing key, must be called with mtx locked
+func (q *Quota) namespaces(k string) []*usage {
+	buckets, _ := keypath.Parse(q.Encoding(), k)
+
+	out := []*usage{}
+	for i, r := range q.rules {
+		matched, ok := keypath.Match(r.pattern, buckets)
+		if !ok {
+			continue
+		}
+
+		id := strconv.Itoa(i) + keypath.Separator + keypath.Join(matched, "")
+		u, exists := q.usage[id]
+		if !exists {
+			u = &usage{
+				bucket: append([]string{}, matched...),
+				limits: r.limits,
+				sizes:  map[string]int64{},
+			}
+			q.usage[id] = u
+		}
+		out = append(out, u)
+	}
+	return out
+}
+
+func size(k string, data []byte) int64 {
+	return int64(len(k) + len(data))
+}
+
+func (q *Quota) watch(events types.Watcher[string, []byte]) {
+	for msg := range events {
+		q.mtx.Lock()
+		q.apply(msg)
+		for journal := range q.journals {
+			*journal = append(*journal, msg)
+		}
+		q.mtx.Unlock()
+	}
+}
+
+// apply change to usage, must be called with mtx locked
+func (q *Quota) apply(msg types.WatchMsg[string, []byte]) {
+	for _, u := range q.namespaces(msg.Key) {
+		if msg.Event == types.DeleteEvent {
+			u.remove(msg.Key)
+		} else {
+			u.set(msg.Key, size(msg.Key, msg.Value))
+		}
+	}
+}
+
+// Refresh recomputes usage of all limited buckets, changes made during scan are applied after it
+func (q *Quota) Refresh() error {
+	fresh := &Quota{
+		Connection: q.Connection,
+		rules:      q.rules,
+		usage:      map[string]*usage{},
+	}
+
+	journal := &[]types.WatchMsg[string, []byte]{}
+	q.mtx.Lock()
+	q.journals[journal] = struct{}{}
+	q.mtx.Unlock()
+	defer func() {
+		q.mtx.Lock()
+		delete(q.journals, journal)
+		q.mtx.Unlock()
+	}()
+
+	for _, pfx := range q.prefixes() {
+		for item := range q.Connection.Iter(q.ctx, pfx) {
+			for _, u := range fresh.namespaces(item.Key) {
+				u.set(item.Key, size(item.Key, item.Value))
+			}
+		}
+	}
+
+	if err := q.ctx.Err(); err != nil {
+		return err
+	}
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	for _, msg := range *journal {
+		fresh.apply(msg)
+	}
+	q.usage = fresh.usage
+	return nil
+}
+
+// Usage returns usage of bucket matched by Limit pattern, eg. Usage("tenant", "1") for "tenant/*" pattern
+func (q *Quota) Usage(bucket ...string) (Usage, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	for i, r := range q.rules {
+		if len(r.pattern) != len(bucket) {
+			continue
+		}
+		if _, ok := keypath.Match(r.pattern, bucket); !ok {
+			continue
+		}
+
+		u, exists := q.usage[strconv.Itoa(i)+keypath.Separator+keypath.Join(bucket, "")]
+		if !exists {
+			return Usage{Limits: r.limits}, nil
+		}
+		return Usage{Keys: len(u.sizes), Bytes: u.bytes, Limits: u.limits}, nil
+	}
+
+	return Usage{}, fmt.Errorf("usage %q: %w", strings.Join(bucket, keypath.Separator), storage.ErrNotFound)
+}
+
+func (q *Quota) Set(k string, v any, op ...storage.Option) error {
+	q.lg.Debug("SET", k, v)
+	data, err := q.Encoding().EncodeValue(v)
+	if err != nil {
+		return fmt.Errorf("encoder: %w", err)
+	}
+	s := size(k, data)
+
+	q.mtx.Lock()
+	namespaces := q.namespaces(k)
+	for _, u := range namespaces {
+		old, exists := u.sizes[k]
+		err := u.check(len(u.sizes), u.bytes, old, exists, s)
+		if err != nil {
+			q.mtx.Unlock()
+			return err
+		}
+	}
+
+	// reserve, so concurrent writes can't exceed quota
+	type previous struct {
+		size   int64
+		exists bool
+	}
+	prev := make([]previous, len(namespaces))
+	for i, u := range namespaces {
+		prev[i].size, prev[i].exists = u.sizes[k]
+		u.set(k, s)
+	}
+	q.mtx.Unlock()
+
+	err = q.Connection.Set(k, encoding.Raw(data), op...)
+	if err != nil {
+		q.mtx.Lock()
+		for i, u := range namespaces {
+			if prev[i].exists {
+				u.set(k, prev[i].size)
+			} else {
+				u.remove(k)
+			}
+		}
+		q.mtx.Unlock()
+	}
+	return err
+}
+
+// Incr adds delta to integer value of key, creation of key is checked against quotas
+func (q *Quota) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	q.lg.Debug("INCR", k, delta)
+	return incr(q, k, delta, func() (int64, error) {
+		return q.Connection.Incr(k, delta, op...)
+	})
+}
+
+// IncrFloat adds delta to float value of key, creation of key is checked against quotas
+func (q *Quota) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	q.lg.Debug("INCRFLOAT", k, delta)
+	return incr(q, k, delta, func() (float64, error) {
+		return q.Connection.IncrFloat(k, delta, op...)
+	})
+}
+
+// incr reserves usage of created key, size of existing number is not checked as it barely changes
+func incr[T internal.Number](q *Quota, k string, delta T, fn func() (T, error)) (T, error) {
+	// counter of created key is equal to delta
+	data, err := q.Encoding().EncodeValue(delta)
+	if err != nil {
+		return 0, fmt.Errorf("encoder: %w", err)
+	}
+
+	q.mtx.Lock()
+	namespaces := q.namespaces(k)
+	created := []*usage{}
+	for _, u := range namespaces {
+		if _, exists := u.sizes[k]; exists {
+			continue
+		}
+		err := u.check(len(u.sizes), u.bytes, 0, false, size(k, data))
+		if err != nil {
+			q.mtx.Unlock()
+			return 0, err
+		}
+		created = append(created, u)
+	}
+
+	// reserve, so concurrent writes can't exceed quota
+	for _, u := range created {
+		u.set(k, size(k, data))
+	}
+	q.mtx.Unlock()
+
+	n, err := fn()
+	if err != nil {
+		q.mtx.Lock()
+		for _, u := range created {
+			u.remove(k)
+		}
+		q.mtx.Unlock()
+		return n, err
+	}
+
+	data, err = q.Encoding().EncodeValue(n)
+	if err == nil {
+		q.mtx.Lock()
+		for _, u := range namespaces {
+			u.set(k, size(k, data))
+		}
+		q.mtx.Unlock()
+	}
+	return n, nil
+}
+
+func (q *Quota) Delete(k string) error {
+	q.lg.Debug("DELETE", k)
+	err := q.Connection.Delete(k)
+	if err != nil {
+		return err
+	}
+
+	q.mtx.Lock()
+	for _, u := range q.namespaces(k) {
+		u.remove(k)
+	}
+	q.mtx.Unlock()
+	return nil
+}
+
+// Tx runs fn in transaction of connection, writes in transaction are checked against quotas
+func (q *Quota) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
+	q.lg.Debug("TX", pfx)
+
+	var t *tx
+	err := q.Connection.Tx(pfx, func(inner storage.Transactioner) error {
+		t = &tx{
+			Transactioner: inner,
+			q:             q,
+			pfx:           q.Encoding().EncodeKey(pfx, ""),
+			pending:       map[string]int64{},
+			delta:         map[*usage]Usage{},
+		}
+		return fn(t)
+	})
+	if err != nil {
+		return err
+	}
+
+	q.mtx.Lock()
+	for k, s := range t.pending {
+		for _, u := range q.namespaces(k) {
+			if s < 0 {
+				u.remove(k)
+			} else {
+				u.set(k, s)
+			}
+		}
+	}
+	q.mtx.Unlock()
+	return nil
+}
+
+// tx checks writes of transaction, usage is updated after commit
+type tx struct {
+	storage.Transactioner
+	q   *Quota
+	pfx string
+
+	pending map[string]int64 // sizes of written keys, -1 for deleted
+	delta   map[*usage]Usage // usage change of transaction
+}
+
+// lookup returns size of key including writes of transaction
+func (t *tx) lookup(u *usage, k string) (int64, bool) {
+	if s, exists := t.pending[k]; exists {
+		return s, s >= 0
+	}
+	s, exists := u.sizes[k]
+	return s, exists
+}
+
+func (t *tx) Set(k string, v any, op ...storage.Option) error {
+	data, err := t.Encoding().EncodeValue(v)
+	if err != nil {
+		return fmt.Errorf("encoder: %w", err)
+	}
+
+	full := t.pfx + k
+	s := size(full, data)
+
+	t.q.mtx.Lock()
+	namespaces := t.q.namespaces(full)
+	for _, u := range namespaces {
+		old, exists := t.lookup(u, full)
+		d := t.delta[u]
+		err := u.check(len(u.sizes)+d.Keys, u.bytes+d.Bytes, old, exists, s)
+		if err != nil {
+			t.q.mtx.Unlock()
+			return err
+		}
+	}
+
+	for _, u := range namespaces {
+		old, exists := t.lookup(u, full)
+		d := t.delta[u]
+		if !exists {
+			d.Keys++
+		}
+		d.Bytes += s - old
+		t.delta[u] = d
+	}
+	t.pending[full] = s
+	t.q.mtx.Unlock()
+
+	return t.Transactioner.Set(k, encoding.Raw(data), op...)
+}
+
+func (t *tx) Delete(k string) error {
+	err := t.Transactioner.Delete(k)
+	if err != nil {
+		return err
+	}
+
+	full := t.pfx + k
+
+	t.q.mtx.Lock()
+	for _, u := range t.q.namespaces(full) {
+		old, exists := t.lookup(u, full)
+		if !exists {
+			continue
+		}
+
+		d := t.delta[u]
+		d.Keys--
+		d.Bytes -= old
+		t.delta[u] = d
+	}
+	t.pending[full] = -1
+	t.q.mtx.Unlock()
+	return nil
+}
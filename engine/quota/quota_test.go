@@ -0,0 +1,495 @@
+package quota_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/engine/quota"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+)
+
+var (
+	db = internal.Must(quota.New(internal.Must(memory.New()), quota.Limit("tx", quota.Limits{Keys: 10})))
+)
+
+func TestGetSet(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test2", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value not 1")
+	}
+
+	var two int
+	err = db.Get("test2", &two)
+	if err != nil {
+		t.Error(err)
+	}
+	if two != 2 {
+		t.Error("Value not 2")
+	}
+}
+
+func TestDeleteExists(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !db.Exists("test1") {
+		t.Log("Value not created")
+	}
+
+	err = db.Delete("test1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if db.Exists("test1") {
+		t.Log("Value not deleted")
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err == nil {
+		t.Error("Got value, expected error")
+	}
+	if val != 0 {
+		t.Error("Expected zero value")
+	}
+}
+
+func TestIter(t *testing.T) {
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	i := 0
+	for item := range helpers.Iter[rune](context.Background(), db) {
+		i++
+		switch item.Key {
+		case "one":
+			if item.Value != '1' {
+				t.Error("Value not 1")
+			}
+		case "two":
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+		default:
+			i--
+		}
+	}
+
+	if i < 2 {
+		t.Error("Not full iteration")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hit := make(chan struct{})
+
+	go func() {
+		for item := range helpers.Watch[rune](ctx, db, "two") {
+			if item.Event != types.PutEvent {
+				t.Error("Not Put Event")
+			}
+			if item.Key != "two" {
+				t.Error("Key not two")
+			}
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+			hit <- struct{}{}
+		}
+	}()
+
+	// Magic sleep
+	time.Sleep(1 * time.Second)
+
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts := time.NewTimer(3 * time.Second)
+	defer ts.Stop()
+
+	select {
+	case <-hit:
+	case <-ts.C:
+		t.Error("Change not found")
+	}
+}
+
+func TestLenKeyVals(t *testing.T) {
+	err := db.Set("test/one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test/two", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	length, err := db.Len("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if length < 2 {
+		t.Error("Len < 2")
+	}
+
+	keys, err := db.Keys("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(keys) < 2 {
+		t.Error("Keys Len < 2")
+	}
+
+	vals, err := db.Values("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(vals) < 2 {
+		t.Error("Vals Len < 2")
+	}
+}
+
+func TestTx(t *testing.T) {
+	const workers = 5
+	bucket := db.Bucket("tx")
+
+	err := bucket.Set("counter", 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := bucket.Tx(func(tx storage.Transactioner) error {
+				val, err := helpers.Get[int](tx, "counter")
+				if err != nil {
+					return err
+				}
+				return tx.Set("counter", val+1)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	val, err := helpers.Get[int](bucket, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != workers {
+		t.Error("Counter not", workers, "got", val)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	q := internal.Must(quota.New(internal.Must(memory.New()), quota.Limit("limited", quota.Limits{Keys: 2})))
+	defer q.Close()
+
+	bucket := q.Bucket("limited")
+	for _, k := range []string{"one", "two"} {
+		err := bucket.Set(k, 1)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	err := bucket.Set("three", 3)
+	if !errors.Is(err, storage.ErrQuotaExceeded) {
+		t.Error("Expected quota exceeded, got", err)
+	}
+
+	// overwrite doesn't add key
+	err = bucket.Set("two", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// outside of limited bucket
+	err = q.Set("three", 3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = bucket.Delete("one")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = bucket.Set("three", 3)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	q := internal.Must(quota.New(internal.Must(memory.New()), quota.Limit("", quota.Limits{Bytes: 64})))
+	defer q.Close()
+
+	err := q.Set("small", "value")
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = q.Set("large", strings.Repeat("x", 64))
+	if !errors.Is(err, storage.ErrQuotaExceeded) {
+		t.Error("Expected quota exceeded, got", err)
+	}
+
+	if q.Exists("large") {
+		t.Error("Rejected value stored")
+	}
+}
+
+func TestTenants(t *testing.T) {
+	q := internal.Must(quota.New(internal.Must(memory.New()), quota.Limit("tenant/*", quota.Limits{Keys: 1})))
+	defer q.Close()
+
+	err := q.Bucket("tenant", "1").Set("one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = q.Bucket("tenant", "2", "config").Set("one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = q.Bucket("tenant", "1", "config").Set("two", 2)
+	if !errors.Is(err, storage.ErrQuotaExceeded) {
+		t.Error("Expected quota exceeded, got", err)
+	}
+
+	usage, err := q.Usage("tenant", "2")
+	if err != nil {
+		t.Error(err)
+	}
+	if usage.Keys != 1 || usage.Bytes == 0 || usage.Limits.Keys != 1 {
+		t.Error("Unexpected usage", usage)
+	}
+
+	_, err = q.Usage("other")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Error("Expected not found, got", err)
+	}
+}
+
+func TestExternalWrites(t *testing.T) {
+	conn := internal.Must(memory.New())
+	err := conn.Bucket("limited").Set("existing", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	q := internal.Must(quota.New(conn, quota.Limit("limited", quota.Limits{Keys: 3})))
+	defer q.Close()
+
+	usage, err := q.Usage("limited")
+	if err != nil {
+		t.Error(err)
+	}
+	if usage.Keys != 1 {
+		t.Error("Existing key not counted, got", usage.Keys)
+	}
+
+	// Magic sleep
+	time.Sleep(100 * time.Millisecond)
+
+	err = conn.Bucket("limited").Set("external", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	usage, err = q.Usage("limited")
+	if err != nil {
+		t.Error(err)
+	}
+	if usage.Keys != 2 {
+		t.Error("External key not counted, got", usage.Keys)
+	}
+}
+
+// pausedIter pauses Iter after all items were sent, until resume is closed
+type pausedIter struct {
+	storage.Connection
+	paused  chan struct{}
+	resume  chan struct{}
+	enabled bool
+}
+
+func (p *pausedIter) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
+	if !p.enabled {
+		return p.Connection.Iter(ctx, pfx)
+	}
+
+	out := make(chan types.Item[string, []byte])
+	go func() {
+		defer close(out)
+		for item := range p.Connection.Iter(ctx, pfx) {
+			out <- item
+		}
+		close(p.paused)
+		<-p.resume
+	}()
+	return out
+}
+
+func TestRefreshDuringWrites(t *testing.T) {
+	conn := &pausedIter{Connection: internal.Must(memory.New()), paused: make(chan struct{}), resume: make(chan struct{})}
+	err := conn.Bucket("refresh").Set("deleted", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := internal.Must(quota.New(conn, quota.Limit("refresh", quota.Limits{Keys: 3})))
+	defer q.Close()
+
+	// Magic sleep
+	time.Sleep(100 * time.Millisecond)
+
+	conn.enabled = true
+	done := make(chan error)
+	go func() {
+		done <- q.Refresh()
+	}()
+
+	// key is deleted after it was scanned
+	<-conn.paused
+	err = conn.Bucket("refresh").Delete("deleted")
+	if err != nil {
+		t.Error(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(conn.resume)
+
+	err = <-done
+	if err != nil {
+		t.Error(err)
+	}
+
+	usage, err := q.Usage("refresh")
+	if err != nil {
+		t.Error(err)
+	}
+	if usage.Keys != 0 {
+		t.Error("Delete made during refresh lost, got", usage.Keys, "keys")
+	}
+}
+
+func TestTxLimit(t *testing.T) {
+	q := internal.Must(quota.New(internal.Must(memory.New()), quota.Limit("limited", quota.Limits{Keys: 2})))
+	defer q.Close()
+
+	err := q.Bucket("limited").Tx(func(tx storage.Transactioner) error {
+		for _, k := range []string{"one", "two", "three"} {
+			err := tx.Set(k, 1)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if !errors.Is(err, storage.ErrQuotaExceeded) {
+		t.Error("Expected quota exceeded, got", err)
+	}
+
+	usage, err := q.Usage("limited")
+	if err != nil {
+		t.Error(err)
+	}
+	if usage.Keys != 0 {
+		t.Error("Rolled back transaction counted, got", usage.Keys)
+	}
+}
+
+func TestIncrLimit(t *testing.T) {
+	q := internal.Must(quota.New(internal.Must(memory.New()), quota.Limit("counters", quota.Limits{Keys: 2})))
+	defer q.Close()
+
+	bucket := q.Bucket("counters")
+	for _, k := range []string{"one", "two"} {
+		_, err := bucket.Incr(k, 1)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	_, err := bucket.Incr("three", 1)
+	if !errors.Is(err, storage.ErrQuotaExceeded) {
+		t.Error("Expected quota exceeded, got", err)
+	}
+
+	// increment doesn't add key
+	n, err := bucket.Incr("two", 1)
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 2 {
+		t.Error("Expected 2, got", n)
+	}
+
+	usage, err := q.Usage("counters")
+	if err != nil {
+		t.Error(err)
+	}
+	if usage.Keys != 2 {
+		t.Error("Expected 2 keys, got", usage.Keys)
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	db.Close()
+	os.Exit(code)
+}
@@ -0,0 +1,86 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+type RedisOpts func(*Redis) error
+
+// Source of Watch events
+type NotifyMode int
+
+const (
+	// Keyspace notifications, server must have notify-keyspace-events with at least "K$gx" flags.
+	// Catches changes made by other clients and expired keys.
+	Keyspace NotifyMode = iota
+
+	// Changes are published by the engine itself to channels with Channel prefix.
+	// Works without server configuration, but only changes made with this engine are seen
+	// and expired keys are not reported.
+	Publish
+)
+
+// Connect to redis server
+func Addr(addr string) RedisOpts {
+	return func(r *Redis) error {
+		r.client = goredis.NewClient(&goredis.Options{Addr: addr})
+		return nil
+	}
+}
+
+// Use configured redis client
+func Client(client *goredis.Client) RedisOpts {
+	return func(r *Redis) error {
+		r.client = client
+		return nil
+	}
+}
+
+// Source of Watch events, default Keyspace
+func Notify(mode NotifyMode) RedisOpts {
+	return func(r *Redis) error {
+		r.notify = mode
+		return nil
+	}
+}
+
+// Channel prefix used in Publish notify mode
+func Channel(pfx string) RedisOpts {
+	return func(r *Redis) error {
+		r.channel = pfx
+		return nil
+	}
+}
+
+// Max number of optimistic Tx retries
+func TxRetries(n int) RedisOpts {
+	return func(r *Redis) error {
+		r.txRetries = n
+		return nil
+	}
+}
+
+func Coder(coder encoding.Coder) RedisOpts {
+	return func(r *Redis) error {
+		r.encoding = coder
+		return nil
+	}
+}
+
+func Context(ctx context.Context) RedisOpts {
+	return func(r *Redis) error {
+		r.ctx, r.cancel = context.WithCancel(ctx)
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) RedisOpts {
+	return func(r *Redis) error {
+		r.lg = lg
+		return nil
+	}
+}
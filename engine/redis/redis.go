@@ -0,0 +1,766 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/encoding/key"
+	"github.com/rafalb8/go-storage/encoding/value"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/options"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var (
+	_ storage.Connection = (*Redis)(nil)
+)
+
+// number of keys fetched by single SCAN/MGET
+const batchSize = 100
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`, `^`, `\^`)
+
+type Redis struct {
+	// context
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	client    *goredis.Client
+	notify    NotifyMode
+	channel   string
+	txRetries int
+
+	// Storage driver encoding
+	encoding encoding.Coder
+
+	// Logger
+	lg storage.Logger
+}
+
+// notification published in Publish notify mode
+type notification struct {
+	Event types.EventType `json:"event"`
+	Value []byte          `json:"value,omitempty"`
+}
+
+func New(opts ...RedisOpts) (storage.Connection, error) {
+	r := &Redis{
+		notify:    Keyspace,
+		channel:   "go-storage:",
+		txRetries: 100,
+		encoding:  encoding.NewCoder(key.Binary, value.CBOR),
+		lg:        &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.client == nil {
+		return nil, errors.New("client not set. Use Addr or Client option")
+	}
+
+	if r.ctx == nil {
+		// Add default context
+		Context(context.Background())(r)
+	}
+
+	err := r.client.Ping(r.ctx).Err()
+	if err != nil {
+		r.cancel()
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+
+	return r, nil
+}
+
+func (r *Redis) Close() {
+	r.cancel()
+	r.client.Close()
+}
+
+func (r *Redis) Bucket(bucket ...string) *storage.Bucket {
+	return storage.NewBucket(r, r.encoding.DecodeBucket(bucket...)...)
+}
+
+func (r *Redis) Encoding() encoding.Coder {
+	return r.encoding
+}
+
+func (r *Redis) PrintDebug(pfx string) error {
+	out := map[string]any{}
+	for item := range r.Iter(r.ctx, pfx) {
+		val, err := helpers.Decode[any](r.encoding, item.Value)
+		if err != nil {
+			r.lg.Warn("decode", "err", err, "key", item.Key, "value", string(item.Value))
+			out[item.Key] = string(item.Value)
+			continue
+		}
+		out[item.Key] = internal.FixValue(val)
+	}
+	internal.PrintJSON(out)
+	return nil
+}
+
+// ttl returns expiration from options, 0 means no expiration
+func (r *Redis) ttl(ops []storage.Option) time.Duration {
+	var ttl time.Duration
+	for _, opt := range ops {
+		switch opt := opt.(type) {
+		case *options.TTLOption:
+			ttl = opt.Value
+
+		default:
+			r.lg.Warn("Unsupported option: %T", opt)
+		}
+	}
+	return ttl
+}
+
+// publish change in Publish notify mode
+func (r *Redis) publish(ctx context.Context, c goredis.Cmdable, event types.EventType, k string, data []byte) {
+	if r.notify != Publish {
+		return
+	}
+
+	payload, err := json.Marshal(notification{Event: event, Value: data})
+	if err != nil {
+		r.lg.Error(err)
+		return
+	}
+
+	err = c.Publish(ctx, r.channel+k, payload).Err()
+	if err != nil {
+		r.lg.Error("publish", k, err)
+	}
+}
+
+func (r *Redis) Set(k string, v any, op ...storage.Option) error {
+	r.lg.Debug("SET", k, v)
+	data, err := r.encoding.EncodeValue(v)
+	if err != nil {
+		return fmt.Errorf("encoder: %w", err)
+	}
+
+	err = r.client.Set(r.ctx, k, data, r.ttl(op)).Err()
+	if err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+
+	r.publish(r.ctx, r.client, types.PutEvent, k, data)
+	return nil
+}
+
+func (r *Redis) Get(k string, v any) error {
+	r.lg.Debug("GET", k)
+	data, err := r.client.Get(r.ctx, k).Bytes()
+	if err == goredis.Nil {
+		return fmt.Errorf("get %s: %w", k, storage.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+	return r.encoding.DecodeValue(data, v)
+}
+
+func (r *Redis) Exists(k string) bool {
+	r.lg.Debug("EXISTS", k)
+	n, err := r.client.Exists(r.ctx, k).Result()
+	if err != nil {
+		r.lg.Error(err)
+		return false
+	}
+	return n > 0
+}
+
+func (r *Redis) Delete(k string) error {
+	r.lg.Debug("DELETE", k)
+	err := r.client.Del(r.ctx, k).Err()
+	if err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+
+	r.publish(r.ctx, r.client, types.DeleteEvent, k, nil)
+	return nil
+}
+
+// Incr adds delta to integer value of key, key is WATCHed and write is retried when key was changed
+func (r *Redis) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	r.lg.Debug("INCR", k, delta)
+	return incr(r, k, delta, op)
+}
+
+// IncrFloat adds delta to float value of key, key is WATCHed and write is retried when key was changed
+func (r *Redis) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	r.lg.Debug("INCRFLOAT", k, delta)
+	return incr(r, k, delta, op)
+}
+
+func incr[T internal.Number](r *Redis, k string, delta T, op []storage.Option) (T, error) {
+	var n T
+	for i := 0; i < r.txRetries; i++ {
+		var data []byte
+		err := r.client.Watch(r.ctx, func(tx *goredis.Tx) error {
+			old, err := tx.Get(r.ctx, k).Bytes()
+			if err != nil && err != goredis.Nil {
+				return fmt.Errorf("redis: %w", err)
+			}
+
+			n, data, err = internal.Incr(r.encoding, old, delta)
+			if err != nil {
+				return fmt.Errorf("incr %s: %w", k, err)
+			}
+
+			// TTL is set when key is created
+			ttl := time.Duration(goredis.KeepTTL)
+			if old == nil {
+				ttl = r.ttl(op)
+			}
+
+			_, err = tx.TxPipelined(r.ctx, func(pipe goredis.Pipeliner) error {
+				pipe.Set(r.ctx, k, data, ttl)
+				return nil
+			})
+			return err
+		}, k)
+
+		if err == goredis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+
+		r.publish(r.ctx, r.client, types.PutEvent, k, data)
+		return n, nil
+	}
+
+	return n, fmt.Errorf("redis: incr %s: %w", k, goredis.TxFailedErr)
+}
+
+// scan calls fn with batches of keys starting with pfx
+func (r *Redis) scan(ctx context.Context, pfx string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, globEscaper.Replace(pfx)+"*", batchSize).Result()
+		if err != nil {
+			return fmt.Errorf("redis: %w", err)
+		}
+
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// values returns existing items for keys
+func (r *Redis) values(ctx context.Context, keys []string) ([]types.Item[string, []byte], error) {
+	vals, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+
+	items := make([]types.Item[string, []byte], 0, len(vals))
+	for i, val := range vals {
+		// deleted since scan
+		if s, ok := val.(string); ok {
+			items = append(items, types.Item[string, []byte]{Key: keys[i], Value: []byte(s)})
+		}
+	}
+	return items, nil
+}
+
+func (r *Redis) Len(pfx string) (int, error) {
+	r.lg.Debug("LEN", pfx)
+	keys, err := r.Keys(pfx)
+	return len(keys), err
+}
+
+func (r *Redis) Keys(pfx string) ([]string, error) {
+	r.lg.Debug("KEYS", pfx)
+
+	// SCAN may return key more than once
+	seen := map[string]struct{}{}
+	out := []string{}
+	err := r.scan(r.ctx, pfx, func(keys []string) error {
+		for _, k := range keys {
+			if _, exists := seen[k]; !exists {
+				seen[k] = struct{}{}
+				out = append(out, k)
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (r *Redis) Values(pfx string) ([][]byte, error) {
+	r.lg.Debug("VALUES", pfx)
+	keys, err := r.Keys(pfx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([][]byte, 0, len(keys))
+	for i := 0; i < len(keys); i += batchSize {
+		end := i + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		items, err := r.values(r.ctx, keys[i:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			out = append(out, item.Value)
+		}
+	}
+	return out, nil
+}
+
+func (r *Redis) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
+	r.lg.Debug("ITER", pfx)
+	out := make(chan types.Item[string, []byte])
+
+	go func() {
+		defer close(out)
+
+		seen := map[string]struct{}{}
+		err := r.scan(ctx, pfx, func(keys []string) error {
+			fresh := keys[:0]
+			for _, k := range keys {
+				if _, exists := seen[k]; !exists {
+					seen[k] = struct{}{}
+					fresh = append(fresh, k)
+				}
+			}
+			if len(fresh) == 0 {
+				return nil
+			}
+
+			items, err := r.values(ctx, fresh)
+			if err != nil {
+				return err
+			}
+
+			for _, item := range items {
+				select {
+				case out <- item:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			r.lg.Error(err)
+		}
+	}()
+
+	return out
+}
+
+func (r *Redis) Watch(ctx context.Context, pfx string) types.Watcher[string, []byte] {
+	r.lg.Debug("WATCH", pfx)
+	out := make(chan types.WatchMsg[string, []byte])
+
+	channel := r.channel
+	if r.notify == Keyspace {
+		channel = fmt.Sprintf("__keyspace@%d__:", r.client.Options().DB)
+	}
+
+	sub := r.client.PSubscribe(ctx, channel+globEscaper.Replace(pfx)+"*")
+
+	// wait for subscription, so changes made after Watch returns are not lost
+	if _, err := sub.Receive(ctx); err != nil {
+		r.lg.Error("watch", pfx, err)
+		sub.Close()
+		close(out)
+		return out
+	}
+
+	go func() {
+		<-ctx.Done()
+		sub.Close()
+	}()
+
+	go func() {
+		defer close(out)
+
+		for msg := range sub.Channel() {
+			k := strings.TrimPrefix(msg.Channel, channel)
+
+			var event types.WatchMsg[string, []byte]
+			var ok bool
+			if r.notify == Keyspace {
+				event, ok = r.keyspaceEvent(ctx, k, msg.Payload)
+			} else {
+				event, ok = r.publishEvent(k, msg.Payload)
+			}
+			if !ok {
+				continue
+			}
+
+			select {
+			case out <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// keyspaceEvent converts keyspace notification, value is fetched for changed keys
+func (r *Redis) keyspaceEvent(ctx context.Context, k, op string) (types.WatchMsg[string, []byte], bool) {
+	event := types.WatchMsg[string, []byte]{Item: types.Item[string, []byte]{Key: k}}
+
+	switch op {
+	case "set", "setrange", "append", "incrby", "incrbyfloat", "rename_to":
+		data, err := r.client.Get(ctx, k).Bytes()
+		if err != nil {
+			// already deleted, delete event will follow
+			return event, false
+		}
+		event.Event = types.PutEvent
+		event.Value = data
+
+	case "del", "expired", "evicted", "rename_from":
+		event.Event = types.DeleteEvent
+
+	default:
+		return event, false
+	}
+
+	return event, true
+}
+
+// publishEvent converts notification published by engine
+func (r *Redis) publishEvent(k, payload string) (types.WatchMsg[string, []byte], bool) {
+	n := notification{}
+	err := json.Unmarshal([]byte(payload), &n)
+	if err != nil {
+		r.lg.Error("watch", k, err)
+		return types.WatchMsg[string, []byte]{}, false
+	}
+
+	return types.WatchMsg[string, []byte]{
+		Event: n.Event,
+		Item: types.Item[string, []byte]{
+			Key: k, Value: n.Value,
+		},
+	}, true
+}
+
+// Tx runs fn in optimistic transaction. Keys read in fn are WATCHed and writes are applied with MULTI/EXEC.
+// When any of read keys was changed by another client, writes are discarded and fn is retried,
+// so fn may run several times and shouldn't have side effects outside of tx.
+func (r *Redis) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
+	r.lg.Debug("TX", pfx)
+
+	for i := 0; i < r.txRetries; i++ {
+		var conn *txConn
+		err := r.client.Watch(r.ctx, func(tx *goredis.Tx) error {
+			conn = &txConn{Redis: r, tx: tx, pending: map[string][]byte{}}
+
+			err := fn(conn.Bucket(pfx))
+			if err != nil {
+				return err
+			}
+
+			if len(conn.writes) == 0 {
+				return nil
+			}
+
+			_, err = tx.TxPipelined(r.ctx, func(pipe goredis.Pipeliner) error {
+				for _, write := range conn.writes {
+					write(pipe)
+				}
+				return nil
+			})
+			return err
+		})
+
+		if err == goredis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, event := range conn.events {
+			r.publish(r.ctx, r.client, event.Event, event.Key, event.Value)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("redis: tx %s: %w", pfx, goredis.TxFailedErr)
+}
+
+// txConn reads through WATCHed transaction and queues writes until EXEC.
+// Listings see pending writes and WATCH listed keys, keys created by other clients after listing are not detected.
+type txConn struct {
+	*Redis
+	tx *goredis.Tx
+
+	writes  []func(pipe goredis.Pipeliner)
+	events  []types.WatchMsg[string, []byte]
+	pending map[string][]byte // nil value marks deleted key
+}
+
+func (t *txConn) Bucket(bucket ...string) *storage.Bucket {
+	return storage.NewBucket(t, t.encoding.DecodeBucket(bucket...)...)
+}
+
+func (t *txConn) Set(k string, v any, op ...storage.Option) error {
+	t.lg.Debug("TX SET", k, v)
+	data, err := t.encoding.EncodeValue(v)
+	if err != nil {
+		return fmt.Errorf("encoder: %w", err)
+	}
+
+	ttl := t.ttl(op)
+	t.pending[k] = data
+	t.writes = append(t.writes, func(pipe goredis.Pipeliner) {
+		pipe.Set(t.ctx, k, data, ttl)
+	})
+	t.events = append(t.events, types.WatchMsg[string, []byte]{
+		Event: types.PutEvent,
+		Item:  types.Item[string, []byte]{Key: k, Value: data},
+	})
+	return nil
+}
+
+func (t *txConn) Get(k string, v any) error {
+	t.lg.Debug("TX GET", k)
+	data, err := t.get(k)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return fmt.Errorf("get %s: %w", k, storage.ErrNotFound)
+	}
+	return t.encoding.DecodeValue(data, v)
+}
+
+// get returns pending or WATCHed value of key, nil for missing key
+func (t *txConn) get(k string) ([]byte, error) {
+	if data, exists := t.pending[k]; exists {
+		return data, nil
+	}
+
+	err := t.tx.Watch(t.ctx, k).Err()
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+
+	data, err := t.tx.Get(t.ctx, k).Bytes()
+	if err == goredis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return data, nil
+}
+
+func (t *txConn) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	t.lg.Debug("TX INCR", k, delta)
+	return txIncr(t, k, delta, op)
+}
+
+func (t *txConn) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	t.lg.Debug("TX INCRFLOAT", k, delta)
+	return txIncr(t, k, delta, op)
+}
+
+// txIncr queues write of sum, key is WATCHed by get
+func txIncr[T internal.Number](t *txConn, k string, delta T, op []storage.Option) (T, error) {
+	old, err := t.get(k)
+	if err != nil {
+		return 0, err
+	}
+
+	n, data, err := internal.Incr(t.encoding, old, delta)
+	if err != nil {
+		return n, fmt.Errorf("incr %s: %w", k, err)
+	}
+
+	// TTL is set when key is created
+	ttl := time.Duration(goredis.KeepTTL)
+	if old == nil {
+		ttl = t.ttl(op)
+	}
+
+	t.pending[k] = data
+	t.writes = append(t.writes, func(pipe goredis.Pipeliner) {
+		pipe.Set(t.ctx, k, data, ttl)
+	})
+	t.events = append(t.events, types.WatchMsg[string, []byte]{
+		Event: types.PutEvent,
+		Item:  types.Item[string, []byte]{Key: k, Value: data},
+	})
+	return n, nil
+}
+
+func (t *txConn) Exists(k string) bool {
+	t.lg.Debug("TX EXISTS", k)
+	if data, exists := t.pending[k]; exists {
+		return data != nil
+	}
+
+	err := t.tx.Watch(t.ctx, k).Err()
+	if err != nil {
+		t.lg.Error(err)
+		return false
+	}
+
+	n, err := t.tx.Exists(t.ctx, k).Result()
+	if err != nil {
+		t.lg.Error(err)
+		return false
+	}
+	return n > 0
+}
+
+func (t *txConn) Delete(k string) error {
+	t.lg.Debug("TX DELETE", k)
+	t.pending[k] = nil
+	t.writes = append(t.writes, func(pipe goredis.Pipeliner) {
+		pipe.Del(t.ctx, k)
+	})
+	t.events = append(t.events, types.WatchMsg[string, []byte]{
+		Event: types.DeleteEvent,
+		Item:  types.Item[string, []byte]{Key: k},
+	})
+	return nil
+}
+
+// Keys returns keys with prefix including pending writes, listed keys are WATCHed
+func (t *txConn) Keys(pfx string) ([]string, error) {
+	t.lg.Debug("TX KEYS", pfx)
+	keys, err := t.Redis.Keys(pfx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) > 0 {
+		err := t.tx.Watch(t.ctx, keys...).Err()
+		if err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+	}
+
+	seen := map[string]struct{}{}
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		seen[k] = struct{}{}
+		if data, exists := t.pending[k]; exists && data == nil {
+			// deleted in tx
+			continue
+		}
+		out = append(out, k)
+	}
+
+	for k, data := range t.pending {
+		if _, exists := seen[k]; !exists && data != nil && strings.HasPrefix(k, pfx) {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+func (t *txConn) Len(pfx string) (int, error) {
+	keys, err := t.Keys(pfx)
+	return len(keys), err
+}
+
+func (t *txConn) Values(pfx string) ([][]byte, error) {
+	items, err := t.items(t.ctx, pfx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([][]byte, 0, len(items))
+	for _, item := range items {
+		out = append(out, item.Value)
+	}
+	return out, nil
+}
+
+func (t *txConn) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
+	out := make(chan types.Item[string, []byte])
+
+	go func() {
+		defer close(out)
+
+		items, err := t.items(ctx, pfx)
+		if err != nil {
+			t.lg.Error("iter", pfx, err)
+			return
+		}
+
+		for _, item := range items {
+			select {
+			case out <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// items returns items with prefix, pending values replace stored ones
+func (t *txConn) items(ctx context.Context, pfx string) ([]types.Item[string, []byte], error) {
+	keys, err := t.Keys(pfx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]types.Item[string, []byte], 0, len(keys))
+	stored := []string{}
+	for _, k := range keys {
+		if data, exists := t.pending[k]; exists {
+			out = append(out, types.Item[string, []byte]{Key: k, Value: data})
+			continue
+		}
+		stored = append(stored, k)
+	}
+
+	for i := 0; i < len(stored); i += batchSize {
+		end := i + batchSize
+		if end > len(stored) {
+			end = len(stored)
+		}
+
+		items, err := t.values(ctx, stored[i:end])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, items...)
+	}
+	return out, nil
+}
@@ -0,0 +1,60 @@
+package remote
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+)
+
+type RemoteOpts func(*Remote) error
+
+// Base URL of go-storage HTTP gateway
+func URL(url string) RemoteOpts {
+	return func(r *Remote) error {
+		r.url = strings.TrimSuffix(url, "/")
+		return nil
+	}
+}
+
+// HTTP client used for requests.
+// Client Timeout also applies to Iter and Watch streams, prefer request contexts.
+func Client(client *http.Client) RemoteOpts {
+	return func(r *Remote) error {
+		r.client = client
+		return nil
+	}
+}
+
+// Coder must match coder of connection served by gateway
+func Coder(coder encoding.Coder) RemoteOpts {
+	return func(r *Remote) error {
+		r.encoding = coder
+		return nil
+	}
+}
+
+// Delay between watch stream reconnects
+func Reconnect(d time.Duration) RemoteOpts {
+	return func(r *Remote) error {
+		r.reconnect = d
+		return nil
+	}
+}
+
+func Context(ctx context.Context) RemoteOpts {
+	return func(r *Remote) error {
+		r.ctx, r.cancel = context.WithCancel(ctx)
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) RemoteOpts {
+	return func(r *Remote) error {
+		r.lg = lg
+		return nil
+	}
+}
@@ -0,0 +1,472 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/encoding/key"
+	"github.com/rafalb8/go-storage/encoding/value"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/options"
+	gateway "github.com/rafalb8/go-storage/server/http"
+)
+
+var (
+	_ storage.Connection = (*Remote)(nil)
+)
+
+// Remote is connection to go-storage HTTP gateway
+type Remote struct {
+	// context
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	url       string
+	client    *http.Client
+	reconnect time.Duration
+
+	// Storage driver encoding
+	encoding encoding.Coder
+
+	// Logger
+	lg storage.Logger
+}
+
+func New(opts ...RemoteOpts) (storage.Connection, error) {
+	r := &Remote{
+		client:    http.DefaultClient,
+		reconnect: time.Second,
+		encoding:  encoding.NewCoder(key.Binary, value.CBOR),
+		lg:        &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.url == "" {
+		return nil, errors.New("url not set. Use URL option")
+	}
+
+	if r.ctx == nil {
+		// Add default context
+		Context(context.Background())(r)
+	}
+
+	// Check if served connection uses the same keys
+	info := gateway.Info{}
+	err := r.call(r.ctx, http.MethodGet, "info", nil, nil, &info)
+	if err != nil {
+		r.cancel()
+		return nil, err
+	}
+	if info.Symbols != r.encoding.Symbols() {
+		r.cancel()
+		return nil, fmt.Errorf("remote: key coder mismatch, server uses %+v", info.Symbols)
+	}
+	probe, err := r.encoding.EncodeValue(gateway.ValueProbe)
+	if err != nil || !bytes.Equal(probe, info.Probe) {
+		r.cancel()
+		return nil, errors.New("remote: value coder mismatch. Use Coder option")
+	}
+
+	return r, nil
+}
+
+func (r *Remote) Close() {
+	r.cancel()
+}
+
+func (r *Remote) Bucket(bucket ...string) *storage.Bucket {
+	return storage.NewBucket(r, r.encoding.DecodeBucket(bucket...)...)
+}
+
+func (r *Remote) Encoding() encoding.Coder {
+	return r.encoding
+}
+
+func (r *Remote) PrintDebug(pfx string) error {
+	out := map[string]any{}
+	for item := range r.Iter(r.ctx, pfx) {
+		val, err := helpers.Decode[any](r.encoding, item.Value)
+		if err != nil {
+			r.lg.Warn("decode", "err", err, "key", item.Key, "value", string(item.Value))
+			out[item.Key] = string(item.Value)
+			continue
+		}
+		out[item.Key] = internal.FixValue(val)
+	}
+	internal.PrintJSON(out)
+	return nil
+}
+
+func (r *Remote) Set(k string, v any, op ...storage.Option) error {
+	r.lg.Debug("SET", k, v)
+	data, err := r.encoding.EncodeValue(v)
+	if err != nil {
+		return fmt.Errorf("encoder: %w", err)
+	}
+
+	return r.call(r.ctx, http.MethodPut, "kv", r.query(k, op), data, nil)
+}
+
+// query returns query of key with Set options
+func (r *Remote) query(k string, op []storage.Option) url.Values {
+	query := url.Values{"key": {k}}
+	for _, opt := range op {
+		switch opt := opt.(type) {
+		case *options.TTLOption:
+			query.Set("ttl", opt.Value.String())
+
+		default:
+			r.lg.Warn("Unsupported option: %T", opt)
+		}
+	}
+	return query
+}
+
+// Incr adds delta to integer value of key on server
+func (r *Remote) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	r.lg.Debug("INCR", k, delta)
+	query := r.query(k, op)
+	query.Set("delta", strconv.FormatInt(delta, 10))
+
+	var n int64
+	err := r.call(r.ctx, http.MethodPost, "incr", query, nil, &n)
+	return n, err
+}
+
+// IncrFloat adds delta to float value of key on server
+func (r *Remote) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	r.lg.Debug("INCRFLOAT", k, delta)
+	query := r.query(k, op)
+	query.Set("delta", strconv.FormatFloat(delta, 'g', -1, 64))
+	query.Set("float", "true")
+
+	var n float64
+	err := r.call(r.ctx, http.MethodPost, "incr", query, nil, &n)
+	return n, err
+}
+
+func (r *Remote) Get(k string, v any) error {
+	r.lg.Debug("GET", k)
+	resp, err := r.do(r.ctx, http.MethodGet, "kv", url.Values{"key": {k}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("get %s: %w", k, storage.ErrNotFound)
+	}
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("remote: %w", err)
+	}
+	return r.encoding.DecodeValue(data, v)
+}
+
+func (r *Remote) Exists(k string) bool {
+	r.lg.Debug("EXISTS", k)
+	resp, err := r.do(r.ctx, http.MethodHead, "kv", url.Values{"key": {k}}, nil)
+	if err != nil {
+		r.lg.Error(err)
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func (r *Remote) Delete(k string) error {
+	r.lg.Debug("DELETE", k)
+	return r.call(r.ctx, http.MethodDelete, "kv", url.Values{"key": {k}}, nil, nil)
+}
+
+func (r *Remote) Len(pfx string) (int, error) {
+	r.lg.Debug("LEN", pfx)
+	var length int
+	err := r.call(r.ctx, http.MethodGet, "len", url.Values{"prefix": {pfx}}, nil, &length)
+	return length, err
+}
+
+func (r *Remote) Keys(pfx string) ([]string, error) {
+	r.lg.Debug("KEYS", pfx)
+	keys := []string{}
+	err := r.call(r.ctx, http.MethodGet, "keys", url.Values{"prefix": {pfx}}, nil, &keys)
+	return keys, err
+}
+
+func (r *Remote) Values(pfx string) ([][]byte, error) {
+	r.lg.Debug("VALUES", pfx)
+	resp, err := r.do(r.ctx, http.MethodGet, "iter", url.Values{"prefix": {pfx}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+
+	values := [][]byte{}
+	dec := json.NewDecoder(resp.Body)
+	for {
+		item := gateway.RawItem{}
+		err := dec.Decode(&item)
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("remote: %w", err)
+		}
+		values = append(values, item.Value)
+	}
+}
+
+func (r *Remote) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
+	r.lg.Debug("ITER", pfx)
+	out := make(chan types.Item[string, []byte])
+
+	go func() {
+		defer close(out)
+
+		resp, err := r.do(ctx, http.MethodGet, "iter", url.Values{"prefix": {pfx}}, nil)
+		if err != nil {
+			r.lg.Error(err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if err := checkStatus(resp); err != nil {
+			r.lg.Error(err)
+			return
+		}
+
+		dec := json.NewDecoder(resp.Body)
+		for {
+			item := gateway.RawItem{}
+			err := dec.Decode(&item)
+			if err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					r.lg.Error(err)
+				}
+				return
+			}
+
+			select {
+			case out <- types.Item[string, []byte]{Key: item.Key, Value: item.Value}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+func (r *Remote) Watch(ctx context.Context, pfx string) types.Watcher[string, []byte] {
+	r.lg.Debug("WATCH", pfx)
+	out := make(chan types.WatchMsg[string, []byte])
+
+	go func() {
+		defer close(out)
+
+		for {
+			err := r.watch(ctx, pfx, out)
+			if ctx.Err() != nil || r.ctx.Err() != nil {
+				return
+			}
+			r.lg.Warn("watch", pfx, "reconnecting:", err)
+
+			// changes made while disconnected are not replayed
+			select {
+			case out <- types.WatchMsg[string, []byte]{
+				Event: types.ErrorEvent,
+				Item: types.Item[string, []byte]{
+					Key: fmt.Sprintf("watch %s disconnected, changes may be missed: %s", pfx, err),
+				},
+			}:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case <-time.After(r.reconnect):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// watch streams events until stream is closed
+func (r *Remote) watch(ctx context.Context, pfx string, out chan<- types.WatchMsg[string, []byte]) error {
+	resp, err := r.do(ctx, http.MethodGet, "watch", url.Values{"prefix": {pfx}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		event := gateway.RawEvent{}
+		err := dec.Decode(&event)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case out <- types.WatchMsg[string, []byte]{
+			Event: event.Event,
+			Item: types.Item[string, []byte]{
+				Key: event.Key, Value: event.Value,
+			},
+		}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Tx runs fn while server holds transaction lock of prefix. Server releases the lock after its TxTimeout,
+// fn has to finish within it, otherwise Tx returns error of unlock even when fn succeeded.
+func (r *Remote) Tx(pfx string, fn func(tx storage.Transactioner) error) (err error) {
+	r.lg.Debug("TX", pfx)
+
+	lock := gateway.TxLock{}
+	err = r.call(r.ctx, http.MethodPost, "tx", url.Values{"prefix": {pfx}}, nil, &lock)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		unlock := r.call(r.ctx, http.MethodDelete, "tx/"+lock.ID, nil, nil, nil)
+		if unlock != nil {
+			err = errors.Join(err, fmt.Errorf("unlock %s: %w", pfx, unlock))
+		}
+	}()
+
+	return fn(r.Bucket(pfx))
+}
+
+// do sends request to raw gateway route
+func (r *Remote) do(ctx context.Context, method, route string, query url.Values, body []byte) (*http.Response, error) {
+	// stop requests after Close
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-r.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	u := r.url + gateway.RawRoute + route
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("remote: %w", err)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("remote: %w", err)
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// call sends request and decodes JSON response into out
+func (r *Remote) call(ctx context.Context, method, route string, query url.Values, body []byte, out any) error {
+	resp, err := r.do(ctx, method, route, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return fmt.Errorf("remote: %w", err)
+	}
+	return nil
+}
+
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	msg := struct {
+		Error string `json:"error"`
+	}{}
+	json.NewDecoder(resp.Body).Decode(&msg)
+	if msg.Error == "" {
+		msg.Error = resp.Status
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("remote: %s: %w", msg.Error, storage.ErrNotFound)
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("remote: %s: %w", msg.Error, storage.ErrPermissionDenied)
+	}
+	if resp.StatusCode == http.StatusInsufficientStorage {
+		return fmt.Errorf("remote: %s: %w", msg.Error, storage.ErrQuotaExceeded)
+	}
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		return fmt.Errorf("remote: %s: %w", msg.Error, storage.ErrInvalidValue)
+	}
+	return fmt.Errorf("remote: %s", msg.Error)
+}
+
+// cancelBody releases request context after body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
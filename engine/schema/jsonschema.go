@@ -0,0 +1,408 @@
+package schema
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rafalb8/go-storage/encoding"
+)
+
+// annotations are accepted and ignored
+var annotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true,
+	"description": true, "default": true, "examples": true, "format": true,
+}
+
+// jsonSchema is compiled subset of JSON Schema
+type jsonSchema struct {
+	reject bool // false schema
+
+	types      []string
+	enum       []any
+	constant   []any // single value when const is set
+	properties map[string]*jsonSchema
+	required   []string
+	additional *jsonSchema
+	items      *jsonSchema
+
+	minimum, maximum                   *float64
+	exclusiveMinimum, exclusiveMaximum *float64
+	minLength, maxLength               *int
+	minItems, maxItems                 *int
+	pattern                            *regexp.Regexp
+}
+
+// JSONSchema returns validator of JSON Schema document. Supported keywords are type, enum, const,
+// properties, required, additionalProperties, items, minimum, maximum, exclusiveMinimum,
+// exclusiveMaximum, minLength, maxLength, pattern, minItems and maxItems, other keywords are rejected.
+// Values are validated as stored by connection, typed values are encoded with coder of connection
+// and decoded like encoded values. Bytes are base64 strings, times are RFC 3339 strings with JSON
+// coder and numbers with CBOR coder.
+func JSONSchema(doc []byte) (Validator, error) {
+	var raw any
+	err := json.Unmarshal(doc, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	return compile(raw, "")
+}
+
+func compile(raw any, path string) (*jsonSchema, error) {
+	if b, ok := raw.(bool); ok {
+		return &jsonSchema{reject: !b}, nil
+	}
+	doc, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("schema %s: expected object or boolean", at(path))
+	}
+
+	s := &jsonSchema{}
+
+	// sorted, so errors are deterministic
+	keywords := make([]string, 0, len(doc))
+	for keyword := range doc {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+
+	var err error
+	for _, keyword := range keywords {
+		value := doc[keyword]
+		switch keyword {
+		case "type":
+			s.types, err = stringList(value)
+		case "enum":
+			list, ok := value.([]any)
+			if !ok {
+				err = errors.New("expected array")
+			}
+			s.enum = list
+		case "const":
+			s.constant = []any{value}
+		case "properties":
+			props, ok := value.(map[string]any)
+			if !ok {
+				err = errors.New("expected object")
+				break
+			}
+			s.properties = map[string]*jsonSchema{}
+			for name, prop := range props {
+				s.properties[name], err = compile(prop, join(path, name))
+				if err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			s.required, err = stringList(value)
+		case "additionalProperties":
+			s.additional, err = compile(value, join(path, "additionalProperties"))
+		case "items":
+			s.items, err = compile(value, join(path, "items"))
+		case "minimum":
+			s.minimum, err = number(value)
+		case "maximum":
+			s.maximum, err = number(value)
+		case "exclusiveMinimum":
+			s.exclusiveMinimum, err = number(value)
+		case "exclusiveMaximum":
+			s.exclusiveMaximum, err = number(value)
+		case "minLength":
+			s.minLength, err = count(value)
+		case "maxLength":
+			s.maxLength, err = count(value)
+		case "minItems":
+			s.minItems, err = count(value)
+		case "maxItems":
+			s.maxItems, err = count(value)
+		case "pattern":
+			str, ok := value.(string)
+			if !ok {
+				err = errors.New("expected string")
+				break
+			}
+			s.pattern, err = regexp.Compile(str)
+		default:
+			if !annotations[keyword] {
+				err = errors.New("unsupported keyword")
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: %s: %w", at(path), keyword, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *jsonSchema) Validate(c encoding.ValueCoder, v any) []FieldError {
+	value, err := jsonValue(c, v)
+	if err != nil {
+		return []FieldError{{Message: err.Error()}}
+	}
+
+	errs := []FieldError{}
+	s.validate(value, "", &errs)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+// jsonValue returns value as it is stored by connection, decoded with c into types of JSON decoded value.
+// Typed values are encoded with c first, so they are validated the same way as encoded values.
+func jsonValue(c encoding.ValueCoder, v any) (any, error) {
+	data, ok := v.(encoding.Raw)
+	if !ok {
+		var err error
+		data, err = c.EncodeValue(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var out any
+	err := c.DecodeValue(data, &out)
+	if err != nil {
+		return nil, err
+	}
+	return normalize(out), nil
+}
+
+func (s *jsonSchema) validate(v any, field string, errs *[]FieldError) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.reject {
+		fail("value not allowed")
+		return
+	}
+
+	if len(s.types) > 0 && !hasType(s.types, v) {
+		fail("expected %s, got %s", joinTypes(s.types), typeOf(v))
+		return
+	}
+
+	if len(s.enum) > 0 && !contains(s.enum, v) {
+		fail("value is not one of %v", s.enum)
+	}
+	if len(s.constant) > 0 && !contains(s.constant, v) {
+		fail("value must be %v", s.constant[0])
+	}
+
+	switch v := v.(type) {
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			fail("must be >= %v", *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			fail("must be <= %v", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && v <= *s.exclusiveMinimum {
+			fail("must be > %v", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && v >= *s.exclusiveMaximum {
+			fail("must be < %v", *s.exclusiveMaximum)
+		}
+
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.minLength != nil && length < *s.minLength {
+			fail("length must be >= %d", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			fail("length must be <= %d", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match %s", s.pattern)
+		}
+
+	case []any:
+		if s.minItems != nil && len(v) < *s.minItems {
+			fail("must have >= %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			fail("must have <= %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range v {
+				s.items.validate(item, join(field, strconv.Itoa(i)), errs)
+			}
+		}
+
+	case map[string]any:
+		for _, name := range s.required {
+			if _, exists := v[name]; !exists {
+				*errs = append(*errs, FieldError{Field: join(field, name), Message: "required"})
+			}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if prop, exists := s.properties[name]; exists {
+				prop.validate(v[name], join(field, name), errs)
+				continue
+			}
+			if s.additional != nil {
+				if s.additional.reject {
+					*errs = append(*errs, FieldError{Field: join(field, name), Message: "additional property not allowed"})
+					continue
+				}
+				s.additional.validate(v[name], join(field, name), errs)
+			}
+		}
+	}
+}
+
+// normalize converts value decoded with coder to types of JSON decoded value
+func normalize(v any) any {
+	switch v := v.(type) {
+	case nil, bool, string, float64:
+		return v
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			out[fmt.Sprint(k)] = normalize(val)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			out[k] = normalize(val)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, val := range v {
+			out[i] = normalize(val)
+		}
+		return out
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	}
+	return v
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func hasType(types []string, v any) bool {
+	actual := typeOf(v)
+	for _, t := range types {
+		if t == actual {
+			return true
+		}
+		if f, ok := v.(float64); ok && t == "integer" && f == math.Trunc(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinTypes(types []string) string {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return fmt.Sprintf("one of %v", types)
+}
+
+func contains(values []any, v any) bool {
+	for _, value := range values {
+		if reflect.DeepEqual(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringList(value any) ([]string, error) {
+	switch value := value.(type) {
+	case string:
+		return []string{value}, nil
+	case []any:
+		out := make([]string, len(value))
+		for i, item := range value {
+			str, ok := item.(string)
+			if !ok {
+				return nil, errors.New("expected strings")
+			}
+			out[i] = str
+		}
+		return out, nil
+	}
+	return nil, errors.New("expected string or array of strings")
+}
+
+func number(value any) (*float64, error) {
+	f, ok := value.(float64)
+	if !ok {
+		return nil, errors.New("expected number")
+	}
+	return &f, nil
+}
+
+func count(value any) (*int, error) {
+	f, ok := value.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return nil, errors.New("expected non negative integer")
+	}
+	n := int(f)
+	return &n, nil
+}
+
+// join appends field name to dot separated path
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// at names schema path in errors
+func at(path string) string {
+	if path == "" {
+		return "root"
+	}
+	return path
+}
@@ -0,0 +1,33 @@
+package schema
+
+import (
+	"errors"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/internal/keypath"
+)
+
+type SchemaOpts func(*Schema) error
+
+// Validate values of buckets matching pattern, eg. "tenant/*/config" validates config bucket of every tenant.
+// "*" matches any bucket name, sub buckets are validated only when they match pattern too.
+func Validate(pattern string, v Validator) SchemaOpts {
+	return func(s *Schema) error {
+		buckets := keypath.Buckets(pattern)
+		if len(buckets) == 0 {
+			return errors.New("schema: pattern must name bucket")
+		}
+		if v == nil {
+			return errors.New("schema: validator is nil")
+		}
+		s.rules = append(s.rules, rule{pattern: buckets, validator: v})
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) SchemaOpts {
+	return func(s *Schema) error {
+		s.lg = lg
+		return nil
+	}
+}
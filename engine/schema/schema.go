@@ -0,0 +1,237 @@
+// Package schema wraps connection and validates values of buckets before they are written.
+//
+// Bucket pattern is associated with Validator, JSON Schema document (JSONSchema) or Go
+// function (Func). Validators get value passed to Set, encoded values (encoding.Raw) are
+// decoded with connection coder. JSONSchema validates values as stored by connection.
+// Non conforming writes fail with ValidationError. Values written by other clients are not validated.
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/keypath"
+)
+
+var (
+	_ storage.Connection = (*Schema)(nil)
+)
+
+// FieldError describes non conforming field of value
+type FieldError struct {
+	Field   string `json:"field"` // dot separated path of field, empty for whole value
+	Message string `json:"message"`
+}
+
+func (e FieldError) String() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError is returned for non conforming values, errors.Is(err, storage.ErrInvalidValue) reports true
+type ValidationError struct {
+	Key    string
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		fields[i] = f.String()
+	}
+	return fmt.Sprintf("invalid value of %s: %s", e.Key, strings.Join(fields, "; "))
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == storage.ErrInvalidValue
+}
+
+// Validator checks value written to bucket, it returns non conforming fields.
+// Value is passed to Set or it is encoding.Raw value encoded with coder of connection.
+type Validator interface {
+	Validate(c encoding.ValueCoder, v any) []FieldError
+}
+
+// Func returns validator of values decoded to T, decode error is reported as error of whole value
+func Func[T any](fn func(v T) []FieldError) Validator {
+	return funcValidator[T](fn)
+}
+
+type funcValidator[T any] func(v T) []FieldError
+
+func (f funcValidator[T]) Validate(c encoding.ValueCoder, v any) []FieldError {
+	if t, ok := v.(T); ok {
+		return f(t)
+	}
+
+	data, ok := v.(encoding.Raw)
+	if !ok {
+		var err error
+		data, err = c.EncodeValue(v)
+		if err != nil {
+			return []FieldError{{Message: err.Error()}}
+		}
+	}
+
+	var t T
+	err := c.DecodeValue(data, &t)
+	if err != nil {
+		return []FieldError{{Message: err.Error()}}
+	}
+	return f(t)
+}
+
+type rule struct {
+	pattern   []string
+	validator Validator
+}
+
+type Schema struct {
+	storage.Connection
+
+	rules []rule
+
+	// Logger
+	lg storage.Logger
+}
+
+// New wraps conn with validation of values. Closing connection closes conn.
+func New(conn storage.Connection, opts ...SchemaOpts) (*Schema, error) {
+	s := &Schema{
+		Connection: conn,
+		lg:         &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Schema) Bucket(bucket ...string) *storage.Bucket {
+	return storage.NewBucket(s, s.Encoding().DecodeBucket(bucket...)...)
+}
+
+// validators returns validators of bucket containing key
+func (s *Schema) validators(k string) []Validator {
+	buckets, _ := keypath.Parse(s.Encoding(), k)
+
+	out := []Validator{}
+	for _, r := range s.rules {
+		if len(r.pattern) != len(buckets) {
+			continue
+		}
+		if _, ok := keypath.Match(r.pattern, buckets); ok {
+			out = append(out, r.validator)
+		}
+	}
+	return out
+}
+
+// check validates value written to key
+func (s *Schema) check(k string, v any) error {
+	fields := []FieldError{}
+	for _, validator := range s.validators(k) {
+		fields = append(fields, validator.Validate(s.Encoding(), v)...)
+	}
+
+	if len(fields) > 0 {
+		err := &ValidationError{Key: keypath.Decode(s.Encoding(), k), Fields: fields}
+		s.lg.Debug("INVALID", err)
+		return err
+	}
+	return nil
+}
+
+func (s *Schema) Set(k string, v any, op ...storage.Option) error {
+	s.lg.Debug("SET", k, v)
+	err := s.check(k, v)
+	if err != nil {
+		return err
+	}
+	return s.Connection.Set(k, v, op...)
+}
+
+// Incr adds delta to integer value of key, sum is validated in transaction of bucket when key is validated
+func (s *Schema) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	s.lg.Debug("INCR", k, delta)
+	if len(s.validators(k)) == 0 {
+		return s.Connection.Incr(k, delta, op...)
+	}
+	return incr(s, k, delta, op)
+}
+
+// IncrFloat adds delta to float value of key, sum is validated in transaction of bucket when key is validated
+func (s *Schema) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	s.lg.Debug("INCRFLOAT", k, delta)
+	if len(s.validators(k)) == 0 {
+		return s.Connection.IncrFloat(k, delta, op...)
+	}
+	return incr(s, k, delta, op)
+}
+
+// incr validates sum before it is written, atomic increment of engine can't be used
+func incr[T internal.Number](s *Schema, k string, delta T, op []storage.Option) (T, error) {
+	buckets, key := keypath.Parse(s.Encoding(), k)
+
+	var n T
+	err := s.Connection.Tx(s.Encoding().EncodeBucket(buckets...), func(tx storage.Transactioner) error {
+		var data encoding.Raw
+		err := tx.Get(key, &data)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+
+		var sum []byte
+		n, sum, err = internal.Incr(s.Encoding(), data, delta)
+		if err != nil {
+			return fmt.Errorf("incr %s: %w", k, err)
+		}
+
+		err = s.check(k, encoding.Raw(sum))
+		if err != nil {
+			return err
+		}
+
+		if data != nil {
+			// TTL is set when key is created
+			op = nil
+		}
+		return tx.Set(key, encoding.Raw(sum), op...)
+	})
+	return n, err
+}
+
+// Tx runs fn in transaction of connection, values written in transaction are validated
+func (s *Schema) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
+	s.lg.Debug("TX", pfx)
+	return s.Connection.Tx(pfx, func(inner storage.Transactioner) error {
+		return fn(&tx{Transactioner: inner, s: s, pfx: s.Encoding().EncodeKey(pfx, "")})
+	})
+}
+
+// tx validates values written in transaction
+type tx struct {
+	storage.Transactioner
+	s   *Schema
+	pfx string
+}
+
+func (t *tx) Set(k string, v any, op ...storage.Option) error {
+	err := t.s.check(t.pfx+k, v)
+	if err != nil {
+		return err
+	}
+	return t.Transactioner.Set(k, v, op...)
+}
@@ -0,0 +1,450 @@
+package schema_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/engine/jsondb"
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/engine/schema"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+)
+
+const userSchema = `{
+	"type": "object",
+	"required": ["name", "age"],
+	"additionalProperties": false,
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"age": {"type": "integer", "minimum": 0},
+		"email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+		"role": {"enum": ["admin", "user"]},
+		"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+		"created": {"type": ["string", "number", "null"]}
+	}
+}`
+
+var (
+	users = internal.Must(schema.JSONSchema([]byte(userSchema)))
+	db    = internal.Must(schema.New(internal.Must(memory.New()), schema.Validate("users", users)))
+)
+
+func TestGetSet(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test2", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value not 1")
+	}
+
+	var two int
+	err = db.Get("test2", &two)
+	if err != nil {
+		t.Error(err)
+	}
+	if two != 2 {
+		t.Error("Value not 2")
+	}
+}
+
+func TestDeleteExists(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !db.Exists("test1") {
+		t.Log("Value not created")
+	}
+
+	err = db.Delete("test1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if db.Exists("test1") {
+		t.Log("Value not deleted")
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err == nil {
+		t.Error("Got value, expected error")
+	}
+	if val != 0 {
+		t.Error("Expected zero value")
+	}
+}
+
+func TestIter(t *testing.T) {
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	i := 0
+	for item := range helpers.Iter[rune](context.Background(), db) {
+		i++
+		switch item.Key {
+		case "one":
+			if item.Value != '1' {
+				t.Error("Value not 1")
+			}
+		case "two":
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+		default:
+			i--
+		}
+	}
+
+	if i < 2 {
+		t.Error("Not full iteration")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hit := make(chan struct{})
+
+	go func() {
+		for item := range helpers.Watch[rune](ctx, db, "two") {
+			if item.Event != types.PutEvent {
+				t.Error("Not Put Event")
+			}
+			if item.Key != "two" {
+				t.Error("Key not two")
+			}
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+			hit <- struct{}{}
+		}
+	}()
+
+	// Magic sleep
+	time.Sleep(1 * time.Second)
+
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts := time.NewTimer(3 * time.Second)
+	defer ts.Stop()
+
+	select {
+	case <-hit:
+	case <-ts.C:
+		t.Error("Change not found")
+	}
+}
+
+func TestLenKeyVals(t *testing.T) {
+	err := db.Set("test/one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test/two", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	length, err := db.Len("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if length < 2 {
+		t.Error("Len < 2")
+	}
+
+	keys, err := db.Keys("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(keys) < 2 {
+		t.Error("Keys Len < 2")
+	}
+
+	vals, err := db.Values("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(vals) < 2 {
+		t.Error("Vals Len < 2")
+	}
+}
+
+func TestTx(t *testing.T) {
+	const workers = 5
+	bucket := db.Bucket("tx")
+
+	err := bucket.Set("counter", 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := bucket.Tx(func(tx storage.Transactioner) error {
+				val, err := helpers.Get[int](tx, "counter")
+				if err != nil {
+					return err
+				}
+				return tx.Set("counter", val+1)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	val, err := helpers.Get[int](bucket, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != workers {
+		t.Error("Counter not", workers, "got", val)
+	}
+}
+
+type User struct {
+	Name    string    `json:"name"`
+	Age     int       `json:"age"`
+	Email   string    `json:"email,omitempty"`
+	Role    string    `json:"role,omitempty"`
+	Tags    []string  `json:"tags,omitempty"`
+	Created time.Time `json:"created,omitempty"`
+}
+
+func TestJSONSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  any
+		fields []string
+	}{
+		{"valid", User{Name: "alice", Age: 30, Email: "alice@example.com", Role: "admin", Tags: []string{"a"}, Created: time.Now()}, nil},
+		{"map", map[string]any{"name": "bob", "age": 1}, nil},
+		{"not object", "alice", []string{""}},
+		{"missing", map[string]any{"email": "bob@example.com"}, []string{"age", "name"}},
+		{"types", map[string]any{"name": 1, "age": 1.5}, []string{"age", "name"}},
+		{"bounds", User{Name: "", Age: -1, Tags: []string{"a", "b", "c"}}, []string{"age", "name", "tags"}},
+		{"pattern and enum", User{Name: "bob", Email: "bob", Role: "root"}, []string{"email", "role"}},
+		{"items", map[string]any{"name": "bob", "age": 1, "tags": []any{"a", 2}}, []string{"tags.1"}},
+		{"additional", map[string]any{"name": "bob", "age": 1, "admin": true}, []string{"admin"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := db.Bucket("users").Set("u", test.value)
+			if test.fields == nil {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+
+			if !errors.Is(err, storage.ErrInvalidValue) {
+				t.Fatal("Expected ErrInvalidValue, got", err)
+			}
+			verr := &schema.ValidationError{}
+			if !errors.As(err, &verr) {
+				t.Fatal("Expected ValidationError, got", err)
+			}
+
+			fields := []string{}
+			for _, f := range verr.Fields {
+				fields = append(fields, f.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(test.fields, ",") {
+				t.Error("Expected fields", test.fields, "got", verr.Fields)
+			}
+			if verr.Key != "users/u" {
+				t.Error("Expected key users/u, got", verr.Key)
+			}
+		})
+	}
+
+	// other buckets are not validated
+	err := db.Bucket("other").Set("u", "alice")
+	if err != nil {
+		t.Error(err)
+	}
+	err = db.Bucket("users", "nested").Set("u", "alice")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCoders(t *testing.T) {
+	created := internal.Must(schema.JSONSchema([]byte(`{"properties": {"created": {"type": "string"}}}`)))
+
+	// jsondb uses JSON coder, memory CBOR
+	conns := map[string]storage.Connection{
+		"jsondb": internal.Must(jsondb.New(jsondb.File(filepath.Join(t.TempDir(), "db.json")))),
+		"memory": internal.Must(memory.New()),
+	}
+
+	for name, conn := range conns {
+		s := internal.Must(schema.New(conn, schema.Validate("users", users)))
+
+		err := s.Bucket("users").Set("valid", User{Name: "alice", Age: 30, Created: time.Now()})
+		if err != nil {
+			t.Error(name, err)
+		}
+
+		err = s.Bucket("users").Set("invalid", map[string]any{"name": "alice", "age": uint8(3), "tags": []byte("ab")})
+		if !errors.Is(err, storage.ErrInvalidValue) {
+			t.Error(name, "expected ErrInvalidValue, got", err)
+		}
+
+		// typed and encoded values are validated as stored
+		user := User{Name: "alice", Age: 30, Created: time.Now()}
+		data, err := conn.Encoding().EncodeValue(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		typed := created.Validate(conn.Encoding(), user)
+		raw := created.Validate(conn.Encoding(), encoding.Raw(data))
+		if len(typed) != len(raw) {
+			t.Error(name, "typed and encoded values differ", typed, raw)
+		}
+		s.Close()
+	}
+}
+
+func TestFunc(t *testing.T) {
+	validator := schema.Func(func(u User) []schema.FieldError {
+		if u.Role == "admin" && !strings.HasSuffix(u.Email, "@example.com") {
+			return []schema.FieldError{{Field: "email", Message: "admin must use company email"}}
+		}
+		return nil
+	})
+	s := internal.Must(schema.New(internal.Must(memory.New()), schema.Validate("tenant/*/users", validator)))
+	defer s.Close()
+
+	err := s.Bucket("tenant", "1", "users").Set("a", User{Name: "alice", Role: "admin", Email: "alice@example.com"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = s.Bucket("tenant", "2", "users").Set("b", User{Name: "bob", Role: "admin", Email: "bob@gmail.com"})
+	if !errors.Is(err, storage.ErrInvalidValue) || !strings.Contains(err.Error(), "email: admin must use company email") {
+		t.Error("Expected email error, got", err)
+	}
+
+	// value not decodable to User
+	err = s.Bucket("tenant", "2", "users").Set("c", "bob")
+	if !errors.Is(err, storage.ErrInvalidValue) {
+		t.Error("Expected ErrInvalidValue, got", err)
+	}
+}
+
+func TestTxValidate(t *testing.T) {
+	err := db.Bucket("users").Tx(func(tx storage.Transactioner) error {
+		return tx.Set("tx", map[string]any{"name": "alice"})
+	})
+	if !errors.Is(err, storage.ErrInvalidValue) {
+		t.Error("Expected ErrInvalidValue, got", err)
+	}
+	if db.Bucket("users").Exists("tx") {
+		t.Error("Invalid value written in transaction")
+	}
+}
+
+func TestIncrValidate(t *testing.T) {
+	limit := internal.Must(schema.JSONSchema([]byte(`{"type": "integer", "maximum": 3}`)))
+	s := internal.Must(schema.New(internal.Must(memory.New()), schema.Validate("limits", limit)))
+	defer s.Close()
+
+	for i := int64(1); i <= 3; i++ {
+		n, err := s.Bucket("limits").Incr("n", 1)
+		if err != nil {
+			t.Error(err)
+		}
+		if n != i {
+			t.Error("Expected", i, "got", n)
+		}
+	}
+
+	_, err := s.Bucket("limits").Incr("n", 1)
+	if !errors.Is(err, storage.ErrInvalidValue) {
+		t.Error("Expected ErrInvalidValue, got", err)
+	}
+	n, _ := helpers.Get[int64](s.Bucket("limits"), "n")
+	if n != 3 {
+		t.Error("Expected 3, got", n)
+	}
+
+	_, err = s.Bucket("limits").IncrFloat("n", 0.5)
+	if !errors.Is(err, storage.ErrInvalidValue) {
+		t.Error("Expected ErrInvalidValue, got", err)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	for _, doc := range []string{
+		`"object"`,
+		`{"oneOf": [{"type": "string"}]}`,
+		`{"properties": {"a": {"minLength": -1}}}`,
+		`{"pattern": "("}`,
+		`{`,
+	} {
+		_, err := schema.JSONSchema([]byte(doc))
+		if err == nil {
+			t.Error("Expected error for", doc)
+		}
+	}
+
+	_, err := schema.New(internal.Must(memory.New()), schema.Validate("", users))
+	if err == nil {
+		t.Error("Expected error for empty pattern")
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	db.Close()
+	os.Exit(code)
+}
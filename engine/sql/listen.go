@@ -0,0 +1,99 @@
+package sql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+)
+
+// notification sent with pg_notify, payload is limited to 8000 bytes, so value is fetched by listener
+type notification struct {
+	Event types.EventType `json:"event"`
+	Key   []byte          `json:"key"`
+}
+
+// channel used for LISTEN/NOTIFY
+func (s *SQL) channel() string {
+	return "go_storage_" + s.table
+}
+
+func (s *SQL) pgNotify(event types.EventType, k string) error {
+	payload, err := json.Marshal(notification{Event: event, Key: []byte(k)})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.q.ExecContext(s.ctx, s.query(`SELECT pg_notify(?, ?)`), s.channel(), string(payload))
+	if err != nil {
+		return fmt.Errorf("sql: notify: %w", err)
+	}
+	return nil
+}
+
+// startListener forwards notifications from all processes to in-process watchers
+func (s *SQL) startListener() error {
+	l := pq.NewListener(s.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			s.lg.Error("listener", err)
+		}
+	})
+
+	err := l.Listen(s.channel())
+	if err != nil {
+		l.Close()
+		return fmt.Errorf("sql: listen: %w", err)
+	}
+
+	go func() {
+		defer l.Close()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+
+			case n := <-l.Notify:
+				// nil after reconnect, changes made meanwhile are lost
+				if n == nil {
+					s.lg.Warn("listener reconnected")
+					continue
+				}
+				s.forward(n.Extra)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (s *SQL) forward(payload string) {
+	n := notification{}
+	err := json.Unmarshal([]byte(payload), &n)
+	if err != nil {
+		s.lg.Error("listener", err)
+		return
+	}
+
+	msg := types.WatchMsg[string, []byte]{
+		Event: n.Event,
+		Item:  types.Item[string, []byte]{Key: string(n.Key)},
+	}
+
+	if n.Event == types.PutEvent {
+		msg.Value, err = s.get(s.db, msg.Key)
+		if errors.Is(err, storage.ErrNotFound) {
+			// already deleted, delete event will follow
+			return
+		}
+		if err != nil {
+			s.lg.Error("listener", err)
+			return
+		}
+	}
+
+	s.hub.Publish(msg)
+}
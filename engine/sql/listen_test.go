@@ -0,0 +1,69 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage/internal"
+	_ "modernc.org/sqlite"
+)
+
+// notifications of Postgres are forwarded to watchers with value read from table
+func TestForward(t *testing.T) {
+	dir := internal.Must(os.MkdirTemp("", "go-storage-listen"))
+	defer os.RemoveAll(dir)
+
+	conn := internal.Must(New(Open("sqlite", filepath.Join(dir, "listen.db"))))
+	defer conn.Close()
+	s := conn.(*SQL)
+
+	err := s.Set("listen/a", "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	events := s.Watch(ctx, "listen/")
+
+	payload := func(event types.EventType, k string) string {
+		data, err := json.Marshal(notification{Event: event, Key: []byte(k)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// invalid payload and put of already deleted key are skipped
+	s.forward("{")
+	s.forward(payload(types.PutEvent, "listen/missing"))
+	s.forward(payload(types.PutEvent, "listen/a"))
+	s.forward(payload(types.DeleteEvent, "listen/b"))
+
+	expected := []types.WatchMsg[string, []byte]{
+		{Event: types.PutEvent, Item: types.Item[string, []byte]{Key: "listen/a"}},
+		{Event: types.DeleteEvent, Item: types.Item[string, []byte]{Key: "listen/b"}},
+	}
+	for _, want := range expected {
+		select {
+		case msg := <-events:
+			if msg.Event != want.Event || msg.Key != want.Key {
+				t.Errorf("Expected %v %s, got %v %s", want.Event, want.Key, msg.Event, msg.Key)
+			}
+			if msg.Event == types.PutEvent {
+				var val string
+				err := s.Encoding().DecodeValue(msg.Value, &val)
+				if err != nil || val != "value" {
+					t.Error("Expected value, got", val, err)
+				}
+			}
+		case <-ctx.Done():
+			t.Fatal("Notification of", want.Key, "not forwarded")
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+)
+
+type SQLOpts func(*SQL) error
+
+// SQL dialect of database
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Open database with driver registered in database/sql, dialect is detected from driver name.
+// SQLite database is limited to single connection, so writes and transactions are serialized.
+func Open(driver, dsn string) SQLOpts {
+	return func(s *SQL) error {
+		switch driver {
+		case "sqlite", "sqlite3":
+			s.dialect = SQLite
+		case "postgres", "pgx":
+			s.dialect = Postgres
+		default:
+			return fmt.Errorf("unsupported driver: %s", driver)
+		}
+
+		db, err := dbsql.Open(driver, dsn)
+		if err != nil {
+			return fmt.Errorf("sql: %w", err)
+		}
+
+		if s.dialect == SQLite {
+			db.SetMaxOpenConns(1)
+		}
+
+		s.db = db
+		s.dsn = dsn
+		return nil
+	}
+}
+
+// Use opened database
+func DB(db *dbsql.DB, dialect Dialect) SQLOpts {
+	return func(s *SQL) error {
+		s.db = db
+		s.dialect = dialect
+		return nil
+	}
+}
+
+// Name of key/value table, default "kv"
+func Table(name string) SQLOpts {
+	return func(s *SQL) error {
+		if !identifier.MatchString(name) {
+			return fmt.Errorf("invalid table name: %q", name)
+		}
+		s.table = name
+		return nil
+	}
+}
+
+// Watch changes made by other processes with Postgres LISTEN/NOTIFY.
+// dsn is used for listener connection, empty dsn reuses dsn from Open.
+func Listen(dsn string) SQLOpts {
+	return func(s *SQL) error {
+		s.listen = true
+		if dsn != "" {
+			s.dsn = dsn
+		}
+		return nil
+	}
+}
+
+// Interval of expired keys removal, default 1s
+func PurgeInterval(interval time.Duration) SQLOpts {
+	return func(s *SQL) error {
+		s.purgeInterval = interval
+		return nil
+	}
+}
+
+func Coder(coder encoding.Coder) SQLOpts {
+	return func(s *SQL) error {
+		s.encoding = coder
+		return nil
+	}
+}
+
+func Context(ctx context.Context) SQLOpts {
+	return func(s *SQL) error {
+		s.ctx, s.cancel = context.WithCancel(ctx)
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) SQLOpts {
+	return func(s *SQL) error {
+		s.lg = lg
+		return nil
+	}
+}
@@ -0,0 +1,650 @@
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/encoding/key"
+	"github.com/rafalb8/go-storage/encoding/value"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/hub"
+	"github.com/rafalb8/go-storage/options"
+)
+
+var (
+	_ storage.Connection = (*SQL)(nil)
+	_ storage.Ranger     = (*SQL)(nil)
+)
+
+// number of rows fetched by single Iter query
+const pageSize = 100
+
+var schema = map[Dialect][]string{
+	SQLite: {
+		`CREATE TABLE IF NOT EXISTS {table} (key BLOB PRIMARY KEY, value BLOB NOT NULL, expires_at INTEGER, revision INTEGER NOT NULL)`,
+		`CREATE INDEX IF NOT EXISTS {table}_expires_at ON {table} (expires_at)`,
+	},
+	Postgres: {
+		`CREATE TABLE IF NOT EXISTS {table} (key BYTEA PRIMARY KEY, value BYTEA NOT NULL, expires_at BIGINT, revision BIGINT NOT NULL)`,
+		`CREATE INDEX IF NOT EXISTS {table}_expires_at ON {table} (expires_at)`,
+	},
+}
+
+// querier is implemented by *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (dbsql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*dbsql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *dbsql.Row
+}
+
+type SQL struct {
+	// context
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	db      *dbsql.DB
+	q       querier // db or running transaction
+	dialect Dialect
+	table   string
+
+	// Postgres LISTEN/NOTIFY
+	listen bool
+	dsn    string
+
+	purgeInterval time.Duration
+
+	// in-process watchers
+	hub *hub.Hub[types.WatchMsg[string, []byte]]
+
+	// events of running transaction, published after commit
+	events *[]types.WatchMsg[string, []byte]
+
+	// Storage driver encoding
+	encoding encoding.Coder
+
+	// Logger
+	lg storage.Logger
+}
+
+func New(opts ...SQLOpts) (storage.Connection, error) {
+	s := &SQL{
+		table:         "kv",
+		purgeInterval: time.Second,
+		hub:           hub.New[types.WatchMsg[string, []byte]](),
+		encoding:      encoding.NewCoder(key.Binary, value.CBOR),
+		lg:            &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.db == nil {
+		return nil, errors.New("database not set. Use Open or DB option")
+	}
+	s.q = s.db
+
+	if s.listen && s.dialect != Postgres {
+		return nil, errors.New("listen is supported only with postgres")
+	}
+
+	if s.ctx == nil {
+		// Add default context
+		Context(context.Background())(s)
+	}
+
+	for _, stmt := range schema[s.dialect] {
+		_, err := s.db.ExecContext(s.ctx, s.query(stmt))
+		if err != nil {
+			s.cancel()
+			return nil, fmt.Errorf("sql: schema: %w", err)
+		}
+	}
+
+	if s.listen {
+		err := s.startListener()
+		if err != nil {
+			s.cancel()
+			return nil, err
+		}
+	}
+
+	go s.purge()
+	return s, nil
+}
+
+func (s *SQL) Close() {
+	s.cancel()
+	s.db.Close()
+}
+
+func (s *SQL) Bucket(bucket ...string) *storage.Bucket {
+	return storage.NewBucket(s, s.encoding.DecodeBucket(bucket...)...)
+}
+
+func (s *SQL) Encoding() encoding.Coder {
+	return s.encoding
+}
+
+func (s *SQL) PrintDebug(pfx string) error {
+	out := map[string]any{}
+	for item := range s.Iter(s.ctx, pfx) {
+		val, err := helpers.Decode[any](s.encoding, item.Value)
+		if err != nil {
+			return err
+		}
+		out[item.Key] = internal.FixValue(val)
+	}
+	internal.PrintJSON(out)
+	return nil
+}
+
+// query replaces table name and rebinds placeholders for dialect
+func (s *SQL) query(q string) string {
+	q = strings.ReplaceAll(q, "{table}", s.table)
+	if s.dialect != Postgres {
+		return q
+	}
+
+	out := strings.Builder{}
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			out.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// live returns WHERE condition and arguments selecting not expired keys starting with pfx
+func live(pfx string) (string, []any) {
+	return liveRange([]byte(pfx), prefixEnd(pfx))
+}
+
+// liveRange returns WHERE condition and arguments selecting not expired keys in range [from, to), nil to is unbounded
+func liveRange(from, to []byte) (string, []any) {
+	cond := "(expires_at IS NULL OR expires_at > ?)"
+	args := []any{time.Now().UnixNano()}
+
+	if len(from) > 0 {
+		cond += " AND key >= ?"
+		args = append(args, from)
+	}
+	if to != nil {
+		cond += " AND key < ?"
+		args = append(args, to)
+	}
+	return cond, args
+}
+
+// prefixEnd returns smallest key greater than all keys starting with pfx, nil if there is none
+func prefixEnd(pfx string) []byte {
+	end := []byte(pfx)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// notify watchers about change, hub drops slow watchers instead of blocking writer
+func (s *SQL) notify(event types.EventType, k string, data []byte) error {
+	if s.listen {
+		// delivered to listeners on commit
+		return s.pgNotify(event, k)
+	}
+
+	msg := types.WatchMsg[string, []byte]{
+		Event: event,
+		Item:  types.Item[string, []byte]{Key: k, Value: data},
+	}
+
+	if s.events != nil {
+		*s.events = append(*s.events, msg)
+		return nil
+	}
+
+	s.hub.Publish(msg)
+	return nil
+}
+
+// expires returns expiration time from options, nil is stored as NULL
+func (s *SQL) expires(op []storage.Option) any {
+	var expires any
+	for _, opt := range op {
+		switch opt := opt.(type) {
+		case *options.TTLOption:
+			expires = time.Now().Add(opt.Value).UnixNano()
+
+		default:
+			s.lg.Warn("Unsupported option: %T", opt)
+		}
+	}
+	return expires
+}
+
+func (s *SQL) Set(k string, v any, op ...storage.Option) error {
+	s.lg.Debug("SET", k, v)
+	data, err := s.encoding.EncodeValue(v)
+	if err != nil {
+		return fmt.Errorf("encoder: %w", err)
+	}
+
+	_, err = s.q.ExecContext(s.ctx, s.query(
+		`INSERT INTO {table} (key, value, expires_at, revision) VALUES (?, ?, ?, 1)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at, revision = {table}.revision + 1`),
+		[]byte(k), data, s.expires(op),
+	)
+	if err != nil {
+		return fmt.Errorf("sql: %w", err)
+	}
+
+	return s.notify(types.PutEvent, k, data)
+}
+
+// Incr adds delta to integer value of key, update is retried until revision of key is unchanged
+func (s *SQL) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	s.lg.Debug("INCR", k, delta)
+	return incr(s, k, delta, op)
+}
+
+// IncrFloat adds delta to float value of key, update is retried until revision of key is unchanged
+func (s *SQL) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	s.lg.Debug("INCRFLOAT", k, delta)
+	return incr(s, k, delta, op)
+}
+
+func incr[T internal.Number](s *SQL, k string, delta T, op []storage.Option) (T, error) {
+	for {
+		var old []byte
+		var revision int64
+		var expires dbsql.NullInt64
+		err := s.q.QueryRowContext(s.ctx, s.query(
+			`SELECT value, revision, expires_at FROM {table} WHERE key = ?`),
+			[]byte(k),
+		).Scan(&old, &revision, &expires)
+		if err != nil && !errors.Is(err, dbsql.ErrNoRows) {
+			return 0, fmt.Errorf("sql: %w", err)
+		}
+
+		exists := err == nil
+		live := exists && (!expires.Valid || expires.Int64 > time.Now().UnixNano())
+		if !live {
+			// expired value is replaced
+			old = nil
+		}
+
+		n, data, err := internal.Incr(s.encoding, old, delta)
+		if err != nil {
+			return n, fmt.Errorf("incr %s: %w", k, err)
+		}
+
+		var res dbsql.Result
+		switch {
+		case !exists:
+			res, err = s.q.ExecContext(s.ctx, s.query(
+				`INSERT INTO {table} (key, value, expires_at, revision) VALUES (?, ?, ?, 1) ON CONFLICT (key) DO NOTHING`),
+				[]byte(k), data, s.expires(op),
+			)
+		case !live:
+			// TTL is set when key is created
+			res, err = s.q.ExecContext(s.ctx, s.query(
+				`UPDATE {table} SET value = ?, expires_at = ?, revision = revision + 1 WHERE key = ? AND revision = ?`),
+				data, s.expires(op), []byte(k), revision,
+			)
+		default:
+			res, err = s.q.ExecContext(s.ctx, s.query(
+				`UPDATE {table} SET value = ?, revision = revision + 1 WHERE key = ? AND revision = ?`),
+				data, []byte(k), revision,
+			)
+		}
+		if err != nil {
+			return n, fmt.Errorf("sql: %w", err)
+		}
+
+		updated, err := res.RowsAffected()
+		if err != nil {
+			return n, fmt.Errorf("sql: %w", err)
+		}
+		if updated > 0 {
+			return n, s.notify(types.PutEvent, k, data)
+		}
+	}
+}
+
+// get returns raw value of live key
+func (s *SQL) get(q querier, k string) ([]byte, error) {
+	var data []byte
+	err := q.QueryRowContext(s.ctx, s.query(
+		`SELECT value FROM {table} WHERE key = ? AND (expires_at IS NULL OR expires_at > ?)`),
+		[]byte(k), time.Now().UnixNano(),
+	).Scan(&data)
+	if errors.Is(err, dbsql.ErrNoRows) {
+		return nil, fmt.Errorf("get %s: %w", k, storage.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sql: %w", err)
+	}
+	return data, nil
+}
+
+func (s *SQL) Get(k string, v any) error {
+	s.lg.Debug("GET", k)
+	data, err := s.get(s.q, k)
+	if err != nil {
+		return err
+	}
+	return s.encoding.DecodeValue(data, v)
+}
+
+func (s *SQL) Exists(k string) bool {
+	s.lg.Debug("EXISTS", k)
+	_, err := s.get(s.q, k)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		s.lg.Error(err)
+	}
+	return err == nil
+}
+
+func (s *SQL) Delete(k string) error {
+	s.lg.Debug("DELETE", k)
+
+	var data []byte
+	err := s.q.QueryRowContext(s.ctx, s.query(
+		`DELETE FROM {table} WHERE key = ? RETURNING value`),
+		[]byte(k),
+	).Scan(&data)
+	if errors.Is(err, dbsql.ErrNoRows) {
+		// nothing deleted
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("sql: %w", err)
+	}
+
+	return s.notify(types.DeleteEvent, k, data)
+}
+
+func (s *SQL) Len(pfx string) (int, error) {
+	s.lg.Debug("LEN", pfx)
+	cond, args := live(pfx)
+
+	var n int
+	err := s.q.QueryRowContext(s.ctx, s.query(`SELECT COUNT(*) FROM {table} WHERE `+cond), args...).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("sql: %w", err)
+	}
+	return n, nil
+}
+
+// column returns values of column for live keys starting with pfx
+func (s *SQL) column(name, pfx string) ([][]byte, error) {
+	cond, args := live(pfx)
+	rows, err := s.q.QueryContext(s.ctx, s.query(`SELECT `+name+` FROM {table} WHERE `+cond+` ORDER BY key`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("sql: %w", err)
+	}
+	defer rows.Close()
+
+	out := [][]byte{}
+	for rows.Next() {
+		var data []byte
+		err := rows.Scan(&data)
+		if err != nil {
+			return nil, fmt.Errorf("sql: %w", err)
+		}
+		out = append(out, data)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sql: %w", err)
+	}
+	return out, nil
+}
+
+func (s *SQL) Keys(pfx string) ([]string, error) {
+	s.lg.Debug("KEYS", pfx)
+	keys, err := s.column("key", pfx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = string(k)
+	}
+	return out, nil
+}
+
+func (s *SQL) Values(pfx string) ([][]byte, error) {
+	s.lg.Debug("VALUES", pfx)
+	return s.column("value", pfx)
+}
+
+// page returns up to pageSize items matching condition, ordered by key and greater than after
+func (s *SQL) page(ctx context.Context, cond string, args []any, after []byte) ([]types.Item[string, []byte], error) {
+	if after != nil {
+		cond += " AND key > ?"
+		args = append(args, after)
+	}
+
+	rows, err := s.q.QueryContext(ctx, s.query(
+		`SELECT key, value FROM {table} WHERE `+cond+` ORDER BY key LIMIT `+strconv.Itoa(pageSize)),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("sql: %w", err)
+	}
+	defer rows.Close()
+
+	items := []types.Item[string, []byte]{}
+	for rows.Next() {
+		var k, v []byte
+		err := rows.Scan(&k, &v)
+		if err != nil {
+			return nil, fmt.Errorf("sql: %w", err)
+		}
+		items = append(items, types.Item[string, []byte]{Key: string(k), Value: v})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sql: %w", err)
+	}
+	return items, nil
+}
+
+func (s *SQL) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
+	s.lg.Debug("ITER", pfx)
+	cond, args := live(pfx)
+	return s.iter(ctx, cond, args)
+}
+
+// IterRange iterates keys in range [from, to), empty to is unbounded
+func (s *SQL) IterRange(ctx context.Context, from, to string) types.Iterator[string, []byte] {
+	s.lg.Debug("ITERRANGE", from, to)
+	var end []byte
+	if to != "" {
+		end = []byte(to)
+	}
+	cond, args := liveRange([]byte(from), end)
+	return s.iter(ctx, cond, args)
+}
+
+// iter iterates items matching condition in pages
+func (s *SQL) iter(ctx context.Context, cond string, args []any) types.Iterator[string, []byte] {
+	out := make(chan types.Item[string, []byte])
+
+	go func() {
+		defer close(out)
+
+		// rows are fetched in pages, so no connection is held while items are consumed
+		var after []byte
+		for {
+			items, err := s.page(ctx, cond, append([]any{}, args...), after)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.lg.Error(err)
+				}
+				return
+			}
+
+			for _, item := range items {
+				select {
+				case out <- item:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if len(items) < pageSize {
+				return
+			}
+			after = []byte(items[len(items)-1].Key)
+		}
+	}()
+
+	return out
+}
+
+func (s *SQL) Watch(ctx context.Context, pfx string) types.Watcher[string, []byte] {
+	s.lg.Debug("WATCH", pfx)
+	out := make(chan types.WatchMsg[string, []byte])
+	msgs := s.hub.Subscribe(ctx)
+
+	go func() {
+		defer close(out)
+		for msg := range msgs {
+			if !strings.HasPrefix(msg.Key, pfx) {
+				continue
+			}
+
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Tx runs fn in SQL transaction. On Postgres transactions with the same prefix are serialized with advisory lock,
+// SQLite uses single connection, so all transactions are serialized.
+func (s *SQL) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
+	s.lg.Debug("TX", pfx)
+
+	tx, err := s.db.BeginTx(s.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sql: %w", err)
+	}
+	defer tx.Rollback()
+
+	if s.dialect == Postgres {
+		_, err := tx.ExecContext(s.ctx, s.query(`SELECT pg_advisory_xact_lock(hashtext(?))`), pfx)
+		if err != nil {
+			return fmt.Errorf("sql: %w", err)
+		}
+	}
+
+	conn := *s
+	conn.q = tx
+	conn.events = &[]types.WatchMsg[string, []byte]{}
+
+	err = fn(conn.Bucket(pfx))
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("sql: %w", err)
+	}
+
+	for _, msg := range *conn.events {
+		s.hub.Publish(msg)
+	}
+	return nil
+}
+
+// purge removes expired keys every purgeInterval
+func (s *SQL) purge() {
+	ticker := time.NewTicker(s.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := s.purgeExpired()
+		if err != nil && s.ctx.Err() == nil {
+			s.lg.Error("purge", err)
+		}
+	}
+}
+
+func (s *SQL) purgeExpired() error {
+	now := time.Now().UnixNano()
+	keys := [][]byte{}
+
+	rows, err := s.db.QueryContext(s.ctx, s.query(`SELECT key FROM {table} WHERE expires_at <= ?`), now)
+	if err != nil {
+		return fmt.Errorf("sql: %w", err)
+	}
+	for rows.Next() {
+		var k []byte
+		err := rows.Scan(&k)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("sql: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("sql: %w", err)
+	}
+
+	for _, k := range keys {
+		var data []byte
+		err := s.db.QueryRowContext(s.ctx, s.query(
+			`DELETE FROM {table} WHERE key = ? AND expires_at <= ? RETURNING value`),
+			k, now,
+		).Scan(&data)
+		if errors.Is(err, dbsql.ErrNoRows) {
+			// updated or removed meanwhile
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("sql: %w", err)
+		}
+
+		err = s.notify(types.DeleteEvent, string(k), data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package trash
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+)
+
+type TrashOpts func(*Trash) error
+
+// Time after which deleted keys are purged, zero keeps them until Purge
+func Retention(d time.Duration) TrashOpts {
+	return func(t *Trash) error {
+		t.retention = d
+		return nil
+	}
+}
+
+// Interval of purging expired keys
+func PurgeInterval(d time.Duration) TrashOpts {
+	return func(t *Trash) error {
+		if d <= 0 {
+			return errors.New("trash: purge interval must be positive")
+		}
+		t.interval = d
+		return nil
+	}
+}
+
+// Name of hidden bucket storing deleted keys
+func Bucket(name string) TrashOpts {
+	return func(t *Trash) error {
+		if name == "" {
+			return errors.New("trash: empty bucket name")
+		}
+		t.bucket = name
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) TrashOpts {
+	return func(t *Trash) error {
+		t.lg = lg
+		return nil
+	}
+}
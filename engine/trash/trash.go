@@ -0,0 +1,384 @@
+// Package trash wraps connection with soft delete.
+//
+// Deleted keys are moved to hidden trash bucket with time of deletion. They are invisible
+// to Get, Iter and Keys, can be listed with Trashed and restored with Restore until they
+// are purged after retention. Keys expired by TTL are not moved to trash.
+package trash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/keypath"
+)
+
+var (
+	_ storage.Connection = (*Trash)(nil)
+)
+
+// Entry of deleted key
+type Entry struct {
+	Key     string    `json:"key"`
+	Deleted time.Time `json:"deleted"`
+	Value   []byte    `json:"value"` // encoded value
+}
+
+type Trash struct {
+	storage.Connection
+
+	bucket    string
+	retention time.Duration
+	interval  time.Duration
+
+	// context
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Logger
+	lg storage.Logger
+}
+
+// New wraps conn with soft delete. Closing connection closes conn.
+func New(conn storage.Connection, opts ...TrashOpts) (*Trash, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t := &Trash{
+		Connection: conn,
+		bucket:     ".trash",
+		retention:  7 * 24 * time.Hour,
+		interval:   time.Minute,
+		ctx:        ctx,
+		cancel:     cancel,
+		lg:         &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(t)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	if t.retention > 0 {
+		go t.purgeLoop()
+	}
+
+	return t, nil
+}
+
+func (t *Trash) Close() {
+	t.cancel()
+	t.Connection.Close()
+}
+
+func (t *Trash) Bucket(bucket ...string) *storage.Bucket {
+	return storage.NewBucket(t, t.Encoding().DecodeBucket(bucket...)...)
+}
+
+func (t *Trash) purgeLoop() {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := t.Purge()
+		if err != nil {
+			t.lg.Error("purge", err)
+		}
+	}
+}
+
+// hidden reports whether key is in trash bucket
+func (t *Trash) hidden(k string) bool {
+	buckets, _ := keypath.Parse(t.Encoding(), k)
+	return len(buckets) > 0 && buckets[0] == t.bucket
+}
+
+// trashKey returns key of deleted key in trash bucket
+func (t *Trash) trashKey(k string) string {
+	buckets, key := keypath.Parse(t.Encoding(), k)
+	return keypath.EncodeKey(t.Encoding(), append([]string{t.bucket}, buckets...), key)
+}
+
+// trashPrefix matches all keys in trash bucket, results have to be filtered with hidden
+func (t *Trash) trashPrefix() string {
+	return t.Encoding().Symbols().BucketKey[0] + t.bucket
+}
+
+// moveToTrash stores entry of deleted key
+func (t *Trash) moveToTrash(entry Entry) error {
+	err := t.Connection.Set(t.trashKey(entry.Key), entry)
+	if err != nil {
+		return fmt.Errorf("trash %s: %w", entry.Key, err)
+	}
+	return nil
+}
+
+func (t *Trash) Set(k string, v any, op ...storage.Option) error {
+	if t.hidden(k) {
+		return fmt.Errorf("set %s: trash bucket is read-only", k)
+	}
+	return t.Connection.Set(k, v, op...)
+}
+
+func (t *Trash) Incr(k string, delta int64, op ...storage.Option) (int64, error) {
+	if t.hidden(k) {
+		return 0, fmt.Errorf("incr %s: trash bucket is read-only", k)
+	}
+	return t.Connection.Incr(k, delta, op...)
+}
+
+func (t *Trash) IncrFloat(k string, delta float64, op ...storage.Option) (float64, error) {
+	if t.hidden(k) {
+		return 0, fmt.Errorf("incr %s: trash bucket is read-only", k)
+	}
+	return t.Connection.IncrFloat(k, delta, op...)
+}
+
+func (t *Trash) Get(k string, v any) error {
+	if t.hidden(k) {
+		return fmt.Errorf("get %s: %w", k, storage.ErrNotFound)
+	}
+	return t.Connection.Get(k, v)
+}
+
+func (t *Trash) Exists(k string) bool {
+	return !t.hidden(k) && t.Connection.Exists(k)
+}
+
+// Delete moves key to trash. Key in bucket is read and deleted in transaction of its bucket,
+// so the value can't be changed between read and delete on transactional engines.
+func (t *Trash) Delete(k string) error {
+	t.lg.Debug("DELETE", k)
+	if t.hidden(k) {
+		return fmt.Errorf("delete %s: %w", k, storage.ErrNotFound)
+	}
+
+	buckets, key := keypath.Parse(t.Encoding(), k)
+	if len(buckets) > 0 {
+		return t.Tx(t.Encoding().EncodeBucket(buckets...), func(tx storage.Transactioner) error {
+			return tx.Delete(key)
+		})
+	}
+
+	var data encoding.Raw
+	err := t.Connection.Get(k, &data)
+	if errors.Is(err, storage.ErrNotFound) {
+		return t.Connection.Delete(k)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = t.moveToTrash(Entry{Key: k, Deleted: time.Now(), Value: data})
+	if err != nil {
+		return err
+	}
+	return t.Connection.Delete(k)
+}
+
+// entry returns trash entry of deleted key
+func (t *Trash) entry(k string) (Entry, error) {
+	entry := Entry{}
+	err := t.Connection.Get(t.trashKey(k), &entry)
+	if err != nil {
+		return entry, fmt.Errorf("trash %s: %w", k, err)
+	}
+	return entry, nil
+}
+
+// Restore moves deleted key from trash back, existing value of key is overwritten
+func (t *Trash) Restore(k string) error {
+	t.lg.Debug("RESTORE", k)
+	entry, err := t.entry(k)
+	if err != nil {
+		return err
+	}
+
+	err = t.Connection.Set(k, encoding.Raw(entry.Value))
+	if err != nil {
+		return err
+	}
+	return t.Connection.Delete(t.trashKey(k))
+}
+
+// Trashed returns deleted keys with prefix
+func (t *Trash) Trashed(pfx string) ([]Entry, error) {
+	out := []Entry{}
+	for item := range t.Connection.Iter(t.ctx, t.trashPrefix()) {
+		if !t.hidden(item.Key) {
+			continue
+		}
+
+		entry := Entry{}
+		err := t.Encoding().DecodeValue(item.Value, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("trash %s: %w", item.Key, err)
+		}
+
+		if strings.HasPrefix(entry.Key, pfx) {
+			out = append(out, entry)
+		}
+	}
+	return out, nil
+}
+
+// Purge permanently deletes keys deleted before retention
+func (t *Trash) Purge() error {
+	entries, err := t.Trashed("")
+	if err != nil {
+		return err
+	}
+
+	limit := time.Now().Add(-t.retention)
+	errs := []error{}
+	for _, entry := range entries {
+		if t.retention > 0 && entry.Deleted.After(limit) {
+			continue
+		}
+
+		t.lg.Debug("PURGE", entry.Key)
+		err := t.Connection.Delete(t.trashKey(entry.Key))
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *Trash) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
+	out := make(chan types.Item[string, []byte])
+	go func() {
+		defer close(out)
+		for item := range t.Connection.Iter(ctx, pfx) {
+			if t.hidden(item.Key) {
+				continue
+			}
+
+			select {
+			case out <- item:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+func (t *Trash) Watch(ctx context.Context, pfx string) types.Watcher[string, []byte] {
+	out := make(chan types.WatchMsg[string, []byte])
+	msgs := t.Connection.Watch(ctx, pfx)
+	go func() {
+		defer close(out)
+		for msg := range msgs {
+			if t.hidden(msg.Key) {
+				continue
+			}
+
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+func (t *Trash) Keys(pfx string) ([]string, error) {
+	keys, err := t.Connection.Keys(pfx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []string{}
+	for _, k := range keys {
+		if !t.hidden(k) {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+func (t *Trash) Len(pfx string) (int, error) {
+	keys, err := t.Keys(pfx)
+	return len(keys), err
+}
+
+func (t *Trash) Values(pfx string) ([][]byte, error) {
+	out := [][]byte{}
+	for item := range t.Iter(context.Background(), pfx) {
+		out = append(out, item.Value)
+	}
+	return out, nil
+}
+
+func (t *Trash) PrintDebug(pfx string) error {
+	out := map[string]any{}
+	for item := range t.Iter(context.Background(), pfx) {
+		var val any
+		err := t.Encoding().DecodeValue(item.Value, &val)
+		if err != nil {
+			return err
+		}
+		out[item.Key] = internal.FixValue(val)
+	}
+	internal.PrintJSON(out)
+	return nil
+}
+
+// Tx runs fn in transaction of connection, keys deleted in transaction are moved to trash.
+// Trash entries are written through connection after transaction commits, so they are dropped on rollback.
+func (t *Trash) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
+	entries := []Entry{}
+	err := t.Connection.Tx(pfx, func(inner storage.Transactioner) error {
+		entries = entries[:0]
+		return fn(&tx{Transactioner: inner, pfx: t.Encoding().EncodeKey(pfx, ""), entries: &entries})
+	})
+	if err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for _, entry := range entries {
+		errs = append(errs, t.moveToTrash(entry))
+	}
+	return errors.Join(errs...)
+}
+
+// tx collects entries of deleted keys
+type tx struct {
+	storage.Transactioner
+	pfx     string
+	entries *[]Entry
+}
+
+func (tx *tx) Delete(k string) error {
+	var data encoding.Raw
+	err := tx.Transactioner.Get(k, &data)
+	if errors.Is(err, storage.ErrNotFound) {
+		return tx.Transactioner.Delete(k)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.Transactioner.Delete(k)
+	if err != nil {
+		return err
+	}
+	*tx.entries = append(*tx.entries, Entry{Key: tx.pfx + k, Deleted: time.Now(), Value: data})
+	return nil
+}
@@ -0,0 +1,407 @@
+package trash_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/engine/sql"
+	"github.com/rafalb8/go-storage/engine/trash"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+	_ "modernc.org/sqlite"
+)
+
+var (
+	db = internal.Must(trash.New(internal.Must(memory.New())))
+)
+
+func TestGetSet(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test2", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value not 1")
+	}
+
+	var two int
+	err = db.Get("test2", &two)
+	if err != nil {
+		t.Error(err)
+	}
+	if two != 2 {
+		t.Error("Value not 2")
+	}
+}
+
+func TestDeleteExists(t *testing.T) {
+	err := db.Set("test1", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !db.Exists("test1") {
+		t.Log("Value not created")
+	}
+
+	err = db.Delete("test1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if db.Exists("test1") {
+		t.Log("Value not deleted")
+	}
+
+	val, err := helpers.Get[uint64](db, "test1")
+	if err == nil {
+		t.Error("Got value, expected error")
+	}
+	if val != 0 {
+		t.Error("Expected zero value")
+	}
+}
+
+func TestIter(t *testing.T) {
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	i := 0
+	for item := range helpers.Iter[rune](context.Background(), db) {
+		i++
+		switch item.Key {
+		case "one":
+			if item.Value != '1' {
+				t.Error("Value not 1")
+			}
+		case "two":
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+		default:
+			i--
+		}
+	}
+
+	if i < 2 {
+		t.Error("Not full iteration")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hit := make(chan struct{})
+
+	go func() {
+		for item := range helpers.Watch[rune](ctx, db, "two") {
+			if item.Event != types.PutEvent {
+				t.Error("Not Put Event")
+			}
+			if item.Key != "two" {
+				t.Error("Key not two")
+			}
+			if item.Value != '2' {
+				t.Error("Value not 2")
+			}
+			hit <- struct{}{}
+		}
+	}()
+
+	// Magic sleep
+	time.Sleep(1 * time.Second)
+
+	err := db.Set("one", '1')
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("two", '2')
+	if err != nil {
+		t.Error(err)
+	}
+
+	ts := time.NewTimer(3 * time.Second)
+	defer ts.Stop()
+
+	select {
+	case <-hit:
+	case <-ts.C:
+		t.Error("Change not found")
+	}
+}
+
+func TestLenKeyVals(t *testing.T) {
+	err := db.Set("test/one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Set("test/two", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	length, err := db.Len("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if length < 2 {
+		t.Error("Len < 2")
+	}
+
+	keys, err := db.Keys("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(keys) < 2 {
+		t.Error("Keys Len < 2")
+	}
+
+	vals, err := db.Values("test/")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(vals) < 2 {
+		t.Error("Vals Len < 2")
+	}
+}
+
+func TestTx(t *testing.T) {
+	const workers = 5
+	bucket := db.Bucket("tx")
+
+	err := bucket.Set("counter", 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := bucket.Tx(func(tx storage.Transactioner) error {
+				val, err := helpers.Get[int](tx, "counter")
+				if err != nil {
+					return err
+				}
+				return tx.Set("counter", val+1)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	val, err := helpers.Get[int](bucket, "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != workers {
+		t.Error("Counter not", workers, "got", val)
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	conn := internal.Must(memory.New())
+	tr := internal.Must(trash.New(conn))
+	defer tr.Close()
+
+	bucket := tr.Bucket("config")
+	for _, k := range []string{"one", "two"} {
+		err := bucket.Set(k, k)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, k := range []string{"one", "two"} {
+		err := bucket.Delete(k)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	_, err := helpers.Get[string](bucket, "one")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Error("Expected not found, got", err)
+	}
+
+	keys, err := tr.Keys("")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(keys) != 0 {
+		t.Error("Trash visible", keys)
+	}
+
+	// trash is stored in underlying connection
+	length, err := conn.Len("")
+	if err != nil {
+		t.Error(err)
+	}
+	if length != 2 {
+		t.Error("Expected 2 keys in trash, got", length)
+	}
+
+	one := tr.Encoding().EncodeKey(tr.Encoding().EncodeBucket("config"), "one")
+	entries, err := tr.Trashed(one)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(entries) != 1 || entries[0].Key != one || entries[0].Deleted.IsZero() {
+		t.Error("Unexpected entries", entries)
+	}
+
+	err = tr.Restore(one)
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[string](bucket, "one")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != "one" {
+		t.Error("Value not restored")
+	}
+
+	entries, err = tr.Trashed("")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(entries) != 1 {
+		t.Error("Expected 1 entry, got", len(entries))
+	}
+
+	err = tr.Restore("missing")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Error("Expected not found, got", err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	conn := internal.Must(memory.New())
+	tr := internal.Must(trash.New(conn, trash.Retention(100*time.Millisecond), trash.PurgeInterval(50*time.Millisecond)))
+	defer tr.Close()
+
+	err := tr.Set("key", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = tr.Delete("key")
+	if err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	length, err := conn.Len("")
+	if err != nil {
+		t.Error(err)
+	}
+	if length != 0 {
+		t.Error("Trash not purged, got", length)
+	}
+}
+
+func TestTxDelete(t *testing.T) {
+	tr := internal.Must(trash.New(internal.Must(memory.New())))
+	defer tr.Close()
+
+	bucket := tr.Bucket("tx")
+	err := bucket.Set("key", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = bucket.Tx(func(tx storage.Transactioner) error {
+		return tx.Delete("key")
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = tr.Restore(tr.Encoding().EncodeKey(bucket.Prefix(), "key"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !bucket.Exists("key") {
+		t.Error("Value not restored")
+	}
+}
+
+func TestTxDeleteRollback(t *testing.T) {
+	dir := t.TempDir()
+	tr := internal.Must(trash.New(internal.Must(sql.New(sql.Open("sqlite", filepath.Join(dir, "trash.db"))))))
+	defer tr.Close()
+
+	bucket := tr.Bucket("tx")
+	err := bucket.Set("key", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	failed := errors.New("failed")
+	err = bucket.Tx(func(tx storage.Transactioner) error {
+		err := tx.Delete("key")
+		if err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Error("Expected failed, got", err)
+	}
+
+	// trash entry is written only when transaction commits
+	if !bucket.Exists("key") {
+		t.Error("Delete not rolled back")
+	}
+	entries, err := tr.Trashed("")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(entries) != 0 {
+		t.Error("Trash entry not rolled back", entries)
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	db.Close()
+	os.Exit(code)
+}
@@ -0,0 +1,110 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+)
+
+// KeyTag marks struct field used as key of value in Collection, eg. `storage:"key"`
+const KeyTag = "storage"
+
+// Keyed values return their key in Collection
+type Keyed interface {
+	Key() string
+}
+
+// Collection of values of type T stored in bucket
+type Collection[T any] struct {
+	bucket *storage.Bucket
+}
+
+func NewCollection[T any](bucket *storage.Bucket) *Collection[T] {
+	return &Collection[T]{bucket: bucket}
+}
+
+// Bucket returns bucket of collection
+func (c *Collection[T]) Bucket() *storage.Bucket {
+	return c.bucket
+}
+
+// Key returns key of value, value has to implement Keyed or have field tagged with `storage:"key"`
+func (c *Collection[T]) Key(v T) (string, error) {
+	if keyed, ok := any(v).(Keyed); ok {
+		return keyed.Key(), nil
+	}
+	if keyed, ok := any(&v).(Keyed); ok {
+		return keyed.Key(), nil
+	}
+
+	val := reflect.Indirect(reflect.ValueOf(v))
+	if val.Kind() == reflect.Struct {
+		for i := 0; i < val.NumField(); i++ {
+			if val.Type().Field(i).Tag.Get(KeyTag) == "key" {
+				// reflect.Value is printed without Interface, which panics on unexported field
+				return fmt.Sprint(val.Field(i)), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("collection: key of %T not found, implement Keyed or tag field with `%s:\"key\"`", v, KeyTag)
+}
+
+func (c *Collection[T]) Get(k string) (T, error) {
+	return Get[T](c.bucket, k)
+}
+
+func (c *Collection[T]) Exists(k string) bool {
+	return c.bucket.Exists(k)
+}
+
+// Put stores value under its key
+func (c *Collection[T]) Put(v T, op ...storage.Option) error {
+	k, err := c.Key(v)
+	if err != nil {
+		return err
+	}
+	return c.bucket.Set(k, v, op...)
+}
+
+// Set stores value under key
+func (c *Collection[T]) Set(k string, v T, op ...storage.Option) error {
+	return c.bucket.Set(k, v, op...)
+}
+
+func (c *Collection[T]) Delete(k string) error {
+	return c.bucket.Delete(k)
+}
+
+// List returns all values
+func (c *Collection[T]) List() ([]T, error) {
+	return Values[T](c.bucket)
+}
+
+func (c *Collection[T]) Iter(ctx context.Context) <-chan types.Item[string, T] {
+	return Iter[T](ctx, c.bucket)
+}
+
+// Watch changes of keys with prefix
+func (c *Collection[T]) Watch(ctx context.Context, pfx string) types.Watcher[string, T] {
+	return Watch[T](ctx, c.bucket, pfx)
+}
+
+// Update reads, modifies and writes value in transaction. Missing value is passed as zero value.
+func (c *Collection[T]) Update(k string, fn func(v *T) error, op ...storage.Option) error {
+	return c.bucket.Tx(func(tx storage.Transactioner) error {
+		v, err := Get[T](tx, k)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+
+		err = fn(&v)
+		if err != nil {
+			return err
+		}
+		return tx.Set(k, v, op...)
+	})
+}
@@ -0,0 +1,133 @@
+package helpers_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/rafalb8/go-storage/helpers"
+)
+
+type account struct {
+	ID      string `json:"id" storage:"key"`
+	Balance int    `json:"balance"`
+}
+
+type counter struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func (c counter) Key() string {
+	return "counter-" + c.Name
+}
+
+type session struct {
+	id   int `storage:"key"`
+	User string
+}
+
+func TestUnexportedKey(t *testing.T) {
+	sessions := helpers.NewCollection[session](db.Bucket("sessions"))
+
+	k, err := sessions.Key(session{id: 7})
+	if err != nil {
+		t.Error(err)
+	}
+	if k != "7" {
+		t.Error("Expected key 7, got", k)
+	}
+}
+
+func TestCollection(t *testing.T) {
+	accounts := helpers.NewCollection[account](db.Bucket("accounts"))
+
+	err := accounts.Put(account{ID: "a", Balance: 10})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = accounts.Put(account{ID: "b", Balance: 20})
+	if err != nil {
+		t.Error(err)
+	}
+
+	acc, err := accounts.Get("a")
+	if err != nil {
+		t.Error(err)
+	}
+	if acc.Balance != 10 {
+		t.Error("Balance not 10")
+	}
+
+	list, err := accounts.List()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(list) != 2 {
+		t.Error("Expected 2 accounts, got", len(list))
+	}
+
+	n := 0
+	for item := range accounts.Iter(context.Background()) {
+		n++
+		if item.Key != item.Value.ID {
+			t.Error("Unexpected item", item)
+		}
+	}
+	if n != 2 {
+		t.Error("Expected 2 items, got", n)
+	}
+
+	err = accounts.Delete("b")
+	if err != nil {
+		t.Error(err)
+	}
+	if accounts.Exists("b") {
+		t.Error("Account not deleted")
+	}
+
+	counters := helpers.NewCollection[counter](db.Bucket("counters"))
+	err = counters.Put(counter{Name: "visits"})
+	if err != nil {
+		t.Error(err)
+	}
+	if !counters.Exists("counter-visits") {
+		t.Error("Keyed value not stored")
+	}
+
+	_, err = helpers.NewCollection[int](db.Bucket("ints")).Key(1)
+	if err == nil {
+		t.Error("Expected error for value without key")
+	}
+}
+
+func TestCollectionUpdate(t *testing.T) {
+	const workers = 5
+	accounts := helpers.NewCollection[account](db.Bucket("update"))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := accounts.Update("a", func(acc *account) error {
+				acc.ID = "a"
+				acc.Balance++
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	acc, err := accounts.Get("a")
+	if err != nil {
+		t.Error(err)
+	}
+	if acc.Balance != workers {
+		t.Error("Balance not", workers, "got", acc.Balance)
+	}
+}
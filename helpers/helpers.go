@@ -16,11 +16,18 @@ type WatchHelper interface {
 
 func Watch[T any](ctx context.Context, tx WatchHelper, key string) types.Watcher[string, T] {
 	out := make(chan types.WatchMsg[string, T], 10)
+	events := tx.Watch(ctx, key)
 
 	go func() {
 		defer close(out)
 
-		for event := range tx.Watch(ctx, key) {
+		for event := range events {
+			if event.Event == types.ErrorEvent {
+				// reported by connection, eg. missed changes
+				out <- types.WatchMsg[string, T]{Event: event.Event, Item: types.Item[string, T]{Key: event.Key}}
+				continue
+			}
+
 			value, err := Decode[T](tx.Encoding(), event.Value)
 			if err != nil {
 				out <- types.WatchMsg[string, T]{
@@ -45,6 +52,32 @@ func Watch[T any](ctx context.Context, tx WatchHelper, key string) types.Watcher
 	return out
 }
 
+type SubscribeHelper interface {
+	storage.Publisher
+	Encoding() encoding.Coder
+}
+
+// Subscribe decodes messages published to topics with prefix, key of item is topic
+func Subscribe[T any](ctx context.Context, pub SubscribeHelper, topicPfx string) <-chan types.Item[string, T] {
+	out := make(chan types.Item[string, T], 10)
+	msgs := pub.Subscribe(ctx, topicPfx)
+
+	go func() {
+		defer close(out)
+
+		for msg := range msgs {
+			value, err := Decode[T](pub.Encoding(), msg.Value)
+			if err != nil {
+				out <- types.Item[string, T]{Key: fmt.Sprintf("error decoding %s, %s", msg.Key, err)}
+				continue
+			}
+			out <- types.Item[string, T]{Key: msg.Key, Value: value}
+		}
+	}()
+
+	return out
+}
+
 func Iter[T any](ctx context.Context, tx storage.Transactioner) <-chan types.Item[string, T] {
 	out := make(chan types.Item[string, T], 10)
 
@@ -0,0 +1,196 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/rafalb8/go-storage"
+)
+
+// IndexBucket is name of bucket inside indexed bucket storing index entries,
+// entries of value are stored as keys of bucket IndexBucket/index/value
+const IndexBucket = ".index"
+
+// IndexFunc returns indexed values of value
+type IndexFunc[T any] func(v T) []string
+
+// Indexed is bucket maintaining secondary indexes of its values, use FindBy to query them.
+// Index entries are written in transaction of bucket together with value.
+type Indexed[T any] struct {
+	bucket  *storage.Bucket
+	indexes map[string]IndexFunc[T]
+}
+
+func NewIndexed[T any](bucket *storage.Bucket, indexes map[string]IndexFunc[T]) *Indexed[T] {
+	return &Indexed[T]{bucket: bucket, indexes: indexes}
+}
+
+// Bucket returns indexed bucket
+func (i *Indexed[T]) Bucket() *storage.Bucket {
+	return i.bucket
+}
+
+func (i *Indexed[T]) Get(k string) (T, error) {
+	return Get[T](i.bucket, k)
+}
+
+// Set value and update its index entries
+func (i *Indexed[T]) Set(k string, v T, op ...storage.Option) error {
+	return i.bucket.Tx(func(tx storage.Transactioner) error {
+		old, exists, err := i.current(tx, k)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Set(k, v, op...)
+		if err != nil {
+			return err
+		}
+		return i.update(tx, k, old, exists, &v, op)
+	})
+}
+
+// Delete value and its index entries
+func (i *Indexed[T]) Delete(k string) error {
+	return i.bucket.Tx(func(tx storage.Transactioner) error {
+		old, exists, err := i.current(tx, k)
+		if err != nil || !exists {
+			return err
+		}
+
+		err = tx.Delete(k)
+		if err != nil {
+			return err
+		}
+		return i.update(tx, k, old, exists, nil, nil)
+	})
+}
+
+// Reindex rewrites index entries of all values, stale entries are removed.
+// Use it after index is added to bucket with values.
+func (i *Indexed[T]) Reindex() error {
+	return i.bucket.Tx(func(tx storage.Transactioner) error {
+		values := map[string]T{}
+		var err error
+		for item := range tx.Iter(context.Background(), "") {
+			if err != nil {
+				// drain iterator
+				continue
+			}
+			values[item.Key], err = Decode[T](tx.Encoding(), item.Value)
+			if err != nil {
+				err = fmt.Errorf("reindex %s: %w", item.Key, err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		for name := range i.indexes {
+			err := indexBucket(tx, i.bucket, name).Clear()
+			if err != nil {
+				return fmt.Errorf("index %s: %w", name, err)
+			}
+		}
+
+		for k, v := range values {
+			v := v
+			err := i.update(tx, k, v, false, &v, nil)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// current returns value of key in transaction
+func (i *Indexed[T]) current(tx storage.Transactioner, k string) (T, bool, error) {
+	old, err := Get[T](tx, k)
+	if errors.Is(err, storage.ErrNotFound) {
+		return old, false, nil
+	}
+	if err != nil {
+		return old, false, err
+	}
+	return old, true, nil
+}
+
+// update index entries of key from old to new value, nil value removes entries
+func (i *Indexed[T]) update(tx storage.Transactioner, k string, old T, exists bool, v *T, op []storage.Option) error {
+	for name, fn := range i.indexes {
+		stale := map[string]bool{}
+		if exists {
+			for _, value := range fn(old) {
+				stale[value] = true
+			}
+		}
+
+		fresh := map[string]bool{}
+		if v != nil {
+			for _, value := range fn(*v) {
+				fresh[value] = true
+			}
+		}
+
+		index := indexBucket(tx, i.bucket, name)
+		for value := range stale {
+			if fresh[value] {
+				continue
+			}
+			err := index.Bucket(indexValue(value)).Delete(k)
+			if err != nil {
+				return fmt.Errorf("index %s: %w", name, err)
+			}
+		}
+		for value := range fresh {
+			// refresh entries of unchanged values too, so they share TTL of value
+			err := index.Bucket(indexValue(value)).Set(k, "", op...)
+			if err != nil {
+				return fmt.Errorf("index %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// indexBucket returns bucket of index, connection of transaction is used when available
+func indexBucket(tx storage.Transactioner, bucket storage.Bucketer, name string) *storage.Bucket {
+	if b, ok := tx.(*storage.Bucket); ok {
+		return b.Bucket(IndexBucket, name)
+	}
+	return bucket.Bucket(IndexBucket, name)
+}
+
+// indexValue escapes indexed value, so it can be used as bucket name
+func indexValue(value string) string {
+	return url.QueryEscape(value)
+}
+
+// FindKeysBy returns keys of values with indexed value
+func FindKeysBy(bucket storage.Bucketer, index, value string) ([]string, error) {
+	return bucket.Bucket(IndexBucket, index, indexValue(value)).Keys()
+}
+
+// FindBy returns values with indexed value, entries of missing values are skipped
+func FindBy[T any](bucket storage.Bucketer, index, value string) ([]T, error) {
+	keys, err := FindKeysBy(bucket, index, value)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []T{}
+	for _, k := range keys {
+		v, err := Get[T](bucket, k)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
@@ -0,0 +1,132 @@
+package helpers_test
+
+import (
+	"testing"
+
+	"github.com/rafalb8/go-storage/helpers"
+)
+
+type user struct {
+	Name   string   `json:"name"`
+	Email  string   `json:"email"`
+	Groups []string `json:"groups"`
+}
+
+func TestIndexed(t *testing.T) {
+	users := helpers.NewIndexed(db.Bucket("users"), map[string]helpers.IndexFunc[user]{
+		"email":  func(u user) []string { return []string{u.Email} },
+		"groups": func(u user) []string { return u.Groups },
+	})
+
+	err := users.Set("1", user{Name: "alice", Email: "alice@example.com", Groups: []string{"admin", "dev"}})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = users.Set("2", user{Name: "bob", Email: "bob@example.com", Groups: []string{"dev"}})
+	if err != nil {
+		t.Error(err)
+	}
+
+	found, err := helpers.FindBy[user](users.Bucket(), "email", "bob@example.com")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(found) != 1 || found[0].Name != "bob" {
+		t.Error("Unexpected users", found)
+	}
+
+	found, err = helpers.FindBy[user](users.Bucket(), "groups", "dev")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(found) != 2 {
+		t.Error("Expected 2 users, got", found)
+	}
+
+	// changed value removes stale entries
+	err = users.Set("2", user{Name: "bob", Email: "robert@example.com"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	keys, err := helpers.FindKeysBy(users.Bucket(), "email", "bob@example.com")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(keys) != 0 {
+		t.Error("Stale entry found", keys)
+	}
+
+	err = users.Delete("1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	found, err = helpers.FindBy[user](users.Bucket(), "groups", "dev")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(found) != 0 {
+		t.Error("Deleted user found", found)
+	}
+
+	// index entries are not visible in bucket
+	length, err := users.Bucket().Len()
+	if err != nil {
+		t.Error(err)
+	}
+	if length != 1 {
+		t.Error("Expected 1 user, got", length)
+	}
+}
+
+func TestReindex(t *testing.T) {
+	bucket := db.Bucket("reindex")
+	err := bucket.Set("1", user{Name: "carol", Email: "carol@example.com"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// stale entry of value changed without index
+	err = bucket.Bucket(helpers.IndexBucket, "email", "old").Set("1", "")
+	if err != nil {
+		t.Error(err)
+	}
+
+	users := helpers.NewIndexed(bucket, map[string]helpers.IndexFunc[user]{
+		"email": func(u user) []string { return []string{u.Email} },
+	})
+
+	err = users.Reindex()
+	if err != nil {
+		t.Error(err)
+	}
+
+	found, err := helpers.FindBy[user](bucket, "email", "carol@example.com")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(found) != 1 || found[0].Name != "carol" {
+		t.Error("Unexpected users", found)
+	}
+
+	stale, err := helpers.FindKeysBy(bucket, "email", "old")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(stale) != 0 {
+		t.Error("Stale entries not removed", stale)
+	}
+
+	// value which can't be decoded fails reindex
+	err = bucket.Set("2", "not a user")
+	if err != nil {
+		t.Error(err)
+	}
+	defer bucket.Delete("2")
+	err = users.Reindex()
+	if err == nil {
+		t.Error("Expected decoding error")
+	}
+}
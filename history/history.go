@@ -0,0 +1,176 @@
+// Package history defines access to previous versions of values.
+//
+// Etcd serves history from MVCC revisions until compaction, memory and jsondb
+// keep explicit version chain enabled with their History option and record time of versions.
+package history
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+)
+
+// Version of value
+type Version struct {
+	Revision int64
+	Time     time.Time // zero when engine doesn't record time of change
+	Value    []byte    // encoded value, nil for delete
+	Deleted  bool
+}
+
+// Historian is implemented by connections keeping versions of values
+type Historian interface {
+	// History returns versions of key from oldest to newest
+	History(k string) ([]Version, error)
+	// GetAt decodes value of key at revision
+	GetAt(k string, rev int64, v any) error
+}
+
+// TimeHistorian is implemented by connections recording time of versions
+type TimeHistorian interface {
+	Historian
+	// GetAtTime decodes value of key at time
+	GetAtTime(k string, t time.Time, v any) error
+}
+
+// Rollback sets key to version it had at revision, key is deleted when it was deleted at revision
+func Rollback(conn storage.Connection, k string, rev int64) error {
+	h, ok := conn.(Historian)
+	if !ok {
+		return fmt.Errorf("history: %T doesn't keep history", conn)
+	}
+
+	versions, err := h.History(k)
+	if err != nil {
+		return err
+	}
+
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if v.Revision > rev {
+			continue
+		}
+		if v.Deleted {
+			return conn.Delete(k)
+		}
+		return conn.Set(k, encoding.Raw(v.Value))
+	}
+	return fmt.Errorf("history %s: revision %d: %w", k, rev, storage.ErrNotFound)
+}
+
+// Chain keeps versions of values
+type Chain struct {
+	keep      int
+	retention time.Duration
+
+	mtx      sync.Mutex
+	rev      int64
+	versions map[string][]Version
+}
+
+// NewChain keeps last keep versions of key within retention, zero disables limit.
+// Newest version of key is always kept.
+func NewChain(keep int, retention time.Duration) *Chain {
+	return &Chain{
+		keep:      keep,
+		retention: retention,
+		versions:  map[string][]Version{},
+	}
+}
+
+// Set records new value of key
+func (c *Chain) Set(k string, data []byte) {
+	c.add(k, Version{Value: append([]byte{}, data...)})
+}
+
+// Delete records delete of key
+func (c *Chain) Delete(k string) {
+	c.add(k, Version{Deleted: true})
+}
+
+func (c *Chain) add(k string, v Version) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.rev++
+	v.Revision = c.rev
+	v.Time = time.Now()
+	c.versions[k] = append(c.versions[k], v)
+	c.trim(k)
+}
+
+// trim drops versions outside of limits, must be called with mtx locked
+func (c *Chain) trim(k string) {
+	versions := c.versions[k]
+
+	drop := 0
+	if c.keep > 0 && len(versions) > c.keep {
+		drop = len(versions) - c.keep
+	}
+	if c.retention > 0 {
+		limit := time.Now().Add(-c.retention)
+		for drop < len(versions)-1 && versions[drop].Time.Before(limit) {
+			drop++
+		}
+	}
+
+	versions = versions[drop:]
+	if len(versions) == 1 && versions[0].Deleted && c.retention > 0 && versions[0].Time.Before(time.Now().Add(-c.retention)) {
+		// deleted key without kept versions
+		delete(c.versions, k)
+		return
+	}
+	c.versions[k] = versions
+}
+
+// Revision returns revision of last change
+func (c *Chain) Revision() int64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.rev
+}
+
+// History returns kept versions of key from oldest to newest
+func (c *Chain) History(k string) ([]Version, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.trim(k)
+	versions, exists := c.versions[k]
+	if !exists || len(versions) == 0 {
+		return nil, fmt.Errorf("history %s: %w", k, storage.ErrNotFound)
+	}
+	return append([]Version{}, versions...), nil
+}
+
+// At returns version of key at revision
+func (c *Chain) At(k string, rev int64) (Version, error) {
+	return c.find(k, func(v Version) bool { return v.Revision <= rev })
+}
+
+// AtTime returns version of key at time
+func (c *Chain) AtTime(k string, t time.Time) (Version, error) {
+	return c.find(k, func(v Version) bool { return !v.Time.After(t) })
+}
+
+// find returns newest version of key matching fn
+func (c *Chain) find(k string, fn func(v Version) bool) (Version, error) {
+	versions, err := c.History(k)
+	if err != nil {
+		return Version{}, err
+	}
+
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !fn(versions[i]) {
+			continue
+		}
+		if versions[i].Deleted {
+			break
+		}
+		return versions[i], nil
+	}
+	return Version{}, fmt.Errorf("history %s: %w", k, storage.ErrNotFound)
+}
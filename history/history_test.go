@@ -0,0 +1,139 @@
+package history_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/history"
+	"github.com/rafalb8/go-storage/internal"
+)
+
+func TestHistory(t *testing.T) {
+	conn := internal.Must(memory.New(memory.History(0, 0)))
+	defer conn.Close()
+	h := conn.(history.TimeHistorian)
+
+	for i := 1; i <= 3; i++ {
+		err := conn.Set("key", i)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	versions, err := h.History("key")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(versions) != 3 {
+		t.Fatal("Expected 3 versions, got", len(versions))
+	}
+
+	var val int
+	err = h.GetAt("key", versions[0].Revision, &val)
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value at first revision not 1, got", val)
+	}
+
+	err = h.GetAtTime("key", versions[1].Time, &val)
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 2 {
+		t.Error("Value at time of second version not 2, got", val)
+	}
+
+	err = conn.Delete("key")
+	if err != nil {
+		t.Error(err)
+	}
+
+	versions, err = h.History("key")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(versions) != 4 || !versions[3].Deleted {
+		t.Error("Delete not recorded", versions)
+	}
+
+	err = h.GetAt("key", versions[3].Revision, &val)
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Error("Expected not found, got", err)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	conn := internal.Must(memory.New(memory.History(0, 0)))
+	defer conn.Close()
+
+	err := conn.Set("config", map[string]any{"replicas": 3})
+	if err != nil {
+		t.Error(err)
+	}
+
+	versions, err := conn.(history.Historian).History("config")
+	if err != nil {
+		t.Error(err)
+	}
+	good := versions[len(versions)-1].Revision
+
+	err = conn.Set("config", map[string]any{"replicas": 0})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = history.Rollback(conn, "config", good)
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[map[string]int](conn, "config")
+	if err != nil {
+		t.Error(err)
+	}
+	if val["replicas"] != 3 {
+		t.Error("Config not rolled back", val)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	chain := history.NewChain(2, 0)
+	for i := 0; i < 5; i++ {
+		chain.Set("key", []byte{byte(i)})
+	}
+
+	versions, err := chain.History("key")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(versions) != 2 || versions[1].Value[0] != 4 {
+		t.Error("Expected 2 newest versions, got", versions)
+	}
+
+	chain = history.NewChain(0, 50*time.Millisecond)
+	chain.Set("key", []byte{1})
+	chain.Set("key", []byte{2})
+	time.Sleep(100 * time.Millisecond)
+
+	versions, err = chain.History("key")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(versions) != 1 || versions[0].Value[0] != 2 {
+		t.Error("Expected newest version only, got", versions)
+	}
+
+	chain.Delete("key")
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = chain.History("key")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Error("Expected not found, got", err)
+	}
+}
@@ -3,13 +3,17 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/rafalb8/go-maps/types"
 	"github.com/rafalb8/go-storage/encoding"
 )
 
 var (
-	ErrNotFound = errors.New("obj not found")
+	ErrNotFound         = errors.New("obj not found")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrInvalidValue     = errors.New("invalid value")
 )
 
 type Logger interface {
@@ -46,6 +50,36 @@ type Watcher interface {
 	Watch(ctx context.Context, pfx string) types.Watcher[string, []byte]
 }
 
+// Ranger is implemented by engines iterating keys in range without scanning whole prefix
+type Ranger interface {
+	// Returns Raw unmarshaled bytes of keys in range [from, to) in order of keys, empty to is unbounded
+	IterRange(ctx context.Context, from, to string) types.Iterator[string, []byte]
+}
+
+// Publisher delivers ephemeral messages to subscribers, messages are not stored and
+// are lost when nobody is subscribed. Implemented by memory, jsondb and etcd engines,
+// memory and jsondb close subscription which doesn't keep up with published messages.
+type Publisher interface {
+	Publish(topic string, v any) error
+	// Returns Raw unmarshaled bytes of messages published to topics with prefix. Recomended to use with helpers.Subscribe[T]
+	Subscribe(ctx context.Context, topicPfx string) types.Iterator[string, []byte]
+}
+
+// Incrementer adds delta to number stored in key atomically, missing key is counted as zero.
+// Options like TTL are applied only when key is created.
+type Incrementer interface {
+	Incr(k string, delta int64, op ...Option) (int64, error)
+	IncrFloat(k string, delta float64, op ...Option) (float64, error)
+}
+
+// KeepAliver keeps key alive while process runs, implemented by etcd with single lease
+// instead of granting new lease on every refresh of TTL
+type KeepAliver interface {
+	// KeepAlive sets key with ttl and keeps it alive until ctx is done. Returned channel is
+	// closed when key stops being kept alive, eg. its lease expired during connection outage.
+	KeepAlive(ctx context.Context, k string, v any, ttl time.Duration) (<-chan struct{}, error)
+}
+
 type Transactioner interface {
 	Getter
 	Setter
@@ -58,6 +92,7 @@ type Bucketer interface {
 	Getter
 	Setter
 	Deleter
+	Incrementer
 
 	Watcher
 	Iterator
@@ -80,6 +115,7 @@ type Connection interface {
 	Getter
 	Setter
 	Deleter
+	Incrementer
 
 	Watcher
 	Iterator
@@ -0,0 +1,67 @@
+package hub
+
+import (
+	"context"
+	"sync"
+)
+
+// Buffer is number of messages queued for subscriber before it is disconnected
+const Buffer = 100
+
+// Hub broadcasts messages to subscribers. Publish never blocks, subscriber which
+// doesn't keep up with Buffer of queued messages is disconnected by closing its channel.
+type Hub[T any] struct {
+	mtx  sync.Mutex
+	subs map[*subscriber[T]]struct{}
+}
+
+type subscriber[T any] struct {
+	ch chan T
+}
+
+func New[T any]() *Hub[T] {
+	return &Hub[T]{subs: map[*subscriber[T]]struct{}{}}
+}
+
+// Subscribe returns channel receiving published messages, channel is closed when ctx is done
+// or subscriber was too slow and missed messages
+func (h *Hub[T]) Subscribe(ctx context.Context) <-chan T {
+	s := &subscriber[T]{ch: make(chan T, Buffer)}
+
+	h.mtx.Lock()
+	h.subs[s] = struct{}{}
+	h.mtx.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		h.mtx.Lock()
+		defer h.mtx.Unlock()
+		h.remove(s)
+	}()
+
+	return s.ch
+}
+
+// Publish queues msg for all subscribers, slow subscribers are disconnected
+func (h *Hub[T]) Publish(msg T) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for s := range h.subs {
+		select {
+		case s.ch <- msg:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// remove closes channel of subscriber, must be called with mtx locked
+func (h *Hub[T]) remove(s *subscriber[T]) {
+	if _, exists := h.subs[s]; !exists {
+		return
+	}
+	delete(h.subs, s)
+	close(s.ch)
+}
@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/rafalb8/go-storage/encoding"
+)
+
+// Number types supported by Incr
+type Number interface {
+	int64 | float64
+}
+
+// Incr decodes number from data, adds delta and returns sum with its encoded value.
+// Empty data is counted as zero.
+func Incr[T Number](coder encoding.ValueCoder, data []byte, delta T) (T, []byte, error) {
+	var n T
+	if len(data) > 0 {
+		err := coder.DecodeValue(data, &n)
+		if err != nil {
+			return n, nil, fmt.Errorf("value is not a number: %w", err)
+		}
+	}
+
+	n += delta
+	data, err := coder.EncodeValue(n)
+	if err != nil {
+		return n, nil, err
+	}
+	return n, data, nil
+}
+
+// Stripes locks keys with fixed set of mutexes, so mutexes of used keys don't accumulate
+type Stripes [64]sync.Mutex
+
+// Of returns mutex of key, different keys can share mutex
+func (s *Stripes) Of(k string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(k))
+	return &s[h.Sum32()%uint32(len(s))]
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -27,11 +28,62 @@ func PathExists(path string) bool {
 func FixMap(m map[any]any) map[string]any {
 	out := map[string]any{}
 	for k, v := range m {
-		if v, ok := any(v).(map[any]any); ok {
-			out[fmt.Sprint(k)] = FixMap(v)
-			continue
-		}
-		out[fmt.Sprint(k)] = v
+		out[fmt.Sprint(k)] = FixValue(v)
 	}
 	return out
 }
+
+// Convert nested map key types to string, so value can be marshaled to json
+func FixValue(v any) any {
+	switch v := v.(type) {
+	case map[any]any:
+		return FixMap(v)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			out[k] = FixValue(val)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, val := range v {
+			out[i] = FixValue(val)
+		}
+		return out
+	}
+	return v
+}
+
+// Convert json.Number values to int64 or float64,
+// otherwise binary coders would store numbers as strings
+func FixNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for k, val := range v {
+			v[k] = FixNumbers(val)
+		}
+	case []any:
+		for i, val := range v {
+			v[i] = FixNumbers(val)
+		}
+	}
+	return v
+}
+
+// Parse JSON value, plain strings are returned as is
+func ParseValue(s string) any {
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.UseNumber()
+
+	var val any
+	if err := dec.Decode(&val); err != nil || dec.More() {
+		return s
+	}
+	return FixNumbers(val)
+}
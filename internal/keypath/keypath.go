@@ -0,0 +1,135 @@
+package keypath
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/rafalb8/go-storage/encoding"
+)
+
+// Separator between bucket names and key in a path, eg. "env/123/element/key"
+const Separator = "/"
+
+var escaper = strings.NewReplacer("%", "%25", Separator, "%2F")
+
+// Escape single path segment, so it can contain Separator
+func Escape(segment string) string {
+	return escaper.Replace(segment)
+}
+
+// Unescape single path segment
+func Unescape(segment string) string {
+	out, err := url.PathUnescape(segment)
+	if err != nil {
+		return segment
+	}
+	return out
+}
+
+// Split path into bucket names and key
+func Split(path string) ([]string, string) {
+	segments := Buckets(path)
+	if len(segments) == 0 {
+		return nil, ""
+	}
+	return segments[:len(segments)-1], segments[len(segments)-1]
+}
+
+// Join bucket names and key into path
+func Join(buckets []string, key string) string {
+	segments := make([]string, 0, len(buckets)+1)
+	for _, b := range buckets {
+		segments = append(segments, Escape(b))
+	}
+	return strings.Join(append(segments, Escape(key)), Separator)
+}
+
+// Encode path into raw storage key
+func Encode(c encoding.KeyCoder, path string) string {
+	buckets, key := Split(path)
+	return EncodeKey(c, buckets, key)
+}
+
+// EncodeKey returns raw storage key for key in bucket
+func EncodeKey(c encoding.KeyCoder, buckets []string, key string) string {
+	if len(buckets) == 0 {
+		return key
+	}
+	return c.EncodeKey(c.EncodeBucket(buckets...), key)
+}
+
+// Buckets splits bucket path into bucket names
+func Buckets(path string) []string {
+	path = strings.Trim(path, Separator)
+	if path == "" {
+		return nil
+	}
+
+	segments := strings.Split(path, Separator)
+	for i, s := range segments {
+		segments[i] = Unescape(s)
+	}
+	return segments
+}
+
+// Prefix returns raw prefix matching every key in bucket path and its sub buckets.
+// Prefix can also match sibling buckets sharing name prefix, filter results with HasBucket.
+// Empty path matches everything.
+func Prefix(c encoding.KeyCoder, path string) string {
+	buckets := Buckets(path)
+	if len(buckets) == 0 {
+		return ""
+	}
+	return c.Symbols().BucketKey[0] + strings.Join(buckets, c.Symbols().Delimiter)
+}
+
+// Parse raw storage key into bucket names and key
+func Parse(c encoding.KeyCoder, raw string) ([]string, string) {
+	sym := c.Symbols()
+	if !strings.HasPrefix(raw, sym.BucketKey[0]) {
+		return nil, raw
+	}
+
+	end := strings.Index(raw, sym.BucketKey[1]+sym.Delimiter)
+	if end < 0 {
+		return nil, raw
+	}
+
+	inner := raw[len(sym.BucketKey[0]):end]
+	return strings.Split(inner, sym.Delimiter), raw[end+len(sym.BucketKey[1])+len(sym.Delimiter):]
+}
+
+// Decode raw storage key into path
+func Decode(c encoding.KeyCoder, raw string) string {
+	buckets, key := Parse(c, raw)
+	return Join(buckets, key)
+}
+
+// HasBucket reports whether buckets starts with parent bucket names
+func HasBucket(buckets, parent []string) bool {
+	if len(parent) > len(buckets) {
+		return false
+	}
+	for i := range parent {
+		if buckets[i] != parent[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Wildcard matches any single bucket name in pattern
+const Wildcard = "*"
+
+// Match reports whether buckets start with bucket names matching pattern and returns matched bucket names
+func Match(pattern, buckets []string) ([]string, bool) {
+	if len(pattern) > len(buckets) {
+		return nil, false
+	}
+	for i, p := range pattern {
+		if p != Wildcard && p != buckets[i] {
+			return nil, false
+		}
+	}
+	return buckets[:len(pattern)], true
+}
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/keypath"
+)
+
+var _ Connection = (*namespace)(nil)
+
+// namespace is connection confined to bucket
+type namespace struct {
+	conn    Connection
+	buckets []string
+}
+
+// Namespaced returns connection confined to bucket. Keys, prefixes, iterations and watches are rewritten,
+// so keys outside of bucket are not reachable. Namespaced connection doesn't close conn.
+func Namespaced(conn Connection, bucket ...string) Connection {
+	buckets := conn.Encoding().DecodeBucket(bucket...)
+	if ns, ok := conn.(*namespace); ok {
+		// nested namespace
+		return &namespace{conn: ns.conn, buckets: append(append([]string{}, ns.buckets...), buckets...)}
+	}
+	return &namespace{conn: conn, buckets: buckets}
+}
+
+// outer returns key of underlying connection
+func (n *namespace) outer(k string) string {
+	buckets, key := keypath.Parse(n.conn.Encoding(), k)
+	return keypath.EncodeKey(n.conn.Encoding(), append(append([]string{}, n.buckets...), buckets...), key)
+}
+
+// inner returns key inside namespace, false for keys outside of namespace
+func (n *namespace) inner(k string) (string, bool) {
+	buckets, key := keypath.Parse(n.conn.Encoding(), k)
+	if len(buckets) == 0 || !keypath.HasBucket(buckets, n.buckets) {
+		return "", false
+	}
+	return keypath.EncodeKey(n.conn.Encoding(), buckets[len(n.buckets):], key), true
+}
+
+// outerPrefix returns prefix of underlying connection matching all keys with prefix in namespace.
+// It can match keys of sibling buckets, results have to be filtered with inner.
+func (n *namespace) outerPrefix(pfx string) string {
+	c := n.conn.Encoding()
+	sym := c.Symbols()
+
+	if pfx == "" {
+		return sym.BucketKey[0] + strings.Join(n.buckets, sym.Delimiter)
+	}
+
+	if !strings.HasPrefix(pfx, sym.BucketKey[0]) {
+		return c.EncodeKey(c.EncodeBucket(n.buckets...), pfx)
+	}
+
+	if buckets, key := keypath.Parse(c, pfx); buckets != nil {
+		return n.outer(keypath.EncodeKey(c, buckets, key))
+	}
+
+	inner := pfx[len(sym.BucketKey[0]):]
+	if strings.HasSuffix(inner, sym.BucketKey[1]) {
+		buckets := strings.Split(strings.TrimSuffix(inner, sym.BucketKey[1]), sym.Delimiter)
+		return c.EncodeBucket(append(append([]string{}, n.buckets...), buckets...)...)
+	}
+
+	buckets := strings.Split(inner, sym.Delimiter)
+	return sym.BucketKey[0] + strings.Join(append(append([]string{}, n.buckets...), buckets...), sym.Delimiter)
+}
+
+// Close doesn't close underlying connection
+func (n *namespace) Close() {}
+
+func (n *namespace) Encoding() encoding.Coder {
+	return n.conn.Encoding()
+}
+
+func (n *namespace) Bucket(bucket ...string) *Bucket {
+	return NewBucket(n, n.Encoding().DecodeBucket(bucket...)...)
+}
+
+func (n *namespace) Set(k string, v any, op ...Option) error {
+	return n.conn.Set(n.outer(k), v, op...)
+}
+
+func (n *namespace) Get(k string, v any) error {
+	return n.conn.Get(n.outer(k), v)
+}
+
+func (n *namespace) Exists(k string) bool {
+	return n.conn.Exists(n.outer(k))
+}
+
+func (n *namespace) Delete(k string) error {
+	return n.conn.Delete(n.outer(k))
+}
+
+func (n *namespace) Incr(k string, delta int64, op ...Option) (int64, error) {
+	return n.conn.Incr(n.outer(k), delta, op...)
+}
+
+func (n *namespace) IncrFloat(k string, delta float64, op ...Option) (float64, error) {
+	return n.conn.IncrFloat(n.outer(k), delta, op...)
+}
+
+func (n *namespace) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
+	out := make(chan types.Item[string, []byte])
+	go func() {
+		defer close(out)
+		for item := range n.conn.Iter(ctx, n.outerPrefix(pfx)) {
+			k, ok := n.inner(item.Key)
+			if !ok || !strings.HasPrefix(k, pfx) {
+				continue
+			}
+
+			item.Key = k
+			select {
+			case out <- item:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+func (n *namespace) Watch(ctx context.Context, pfx string) types.Watcher[string, []byte] {
+	out := make(chan types.WatchMsg[string, []byte])
+	msgs := n.conn.Watch(ctx, n.outerPrefix(pfx))
+	go func() {
+		defer close(out)
+		for msg := range msgs {
+			k, ok := n.inner(msg.Key)
+			if !ok || !strings.HasPrefix(k, pfx) {
+				continue
+			}
+
+			msg.Key = k
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+func (n *namespace) Keys(pfx string) ([]string, error) {
+	keys, err := n.conn.Keys(n.outerPrefix(pfx))
+	if err != nil {
+		return nil, err
+	}
+
+	out := []string{}
+	for _, k := range keys {
+		if k, ok := n.inner(k); ok && strings.HasPrefix(k, pfx) {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+func (n *namespace) Len(pfx string) (int, error) {
+	keys, err := n.Keys(pfx)
+	return len(keys), err
+}
+
+func (n *namespace) Values(pfx string) ([][]byte, error) {
+	out := [][]byte{}
+	for item := range n.Iter(context.Background(), pfx) {
+		out = append(out, item.Value)
+	}
+	return out, nil
+}
+
+func (n *namespace) PrintDebug(pfx string) error {
+	out := map[string]any{}
+	for item := range n.Iter(context.Background(), pfx) {
+		var val any
+		err := n.Encoding().DecodeValue(item.Value, &val)
+		if err != nil {
+			return err
+		}
+		out[item.Key] = internal.FixValue(val)
+	}
+	internal.PrintJSON(out)
+	return nil
+}
+
+func (n *namespace) Tx(pfx string, fn func(tx Transactioner) error) error {
+	buckets := n.Encoding().DecodeBucket(pfx)
+	if pfx == "" {
+		buckets = nil
+	}
+	return n.conn.Tx(n.Encoding().EncodeBucket(append(append([]string{}, n.buckets...), buckets...)...), func(inner Transactioner) error {
+		return fn(&namespaceTx{tx: inner})
+	})
+}
+
+// namespaceTx hides transactioner of underlying connection, so fn can't reach keys outside of namespace through it.
+// Keys are passed to transaction of namespace prefix, which prefixes them with namespace.
+type namespaceTx struct {
+	tx Transactioner
+}
+
+func (tx *namespaceTx) Encoding() encoding.Coder {
+	return tx.tx.Encoding()
+}
+
+func (tx *namespaceTx) Set(k string, v any, op ...Option) error {
+	return tx.tx.Set(k, v, op...)
+}
+
+func (tx *namespaceTx) Get(k string, v any) error {
+	return tx.tx.Get(k, v)
+}
+
+func (tx *namespaceTx) Exists(k string) bool {
+	return tx.tx.Exists(k)
+}
+
+func (tx *namespaceTx) Delete(k string) error {
+	return tx.tx.Delete(k)
+}
+
+func (tx *namespaceTx) Iter(ctx context.Context, pfx string) types.Iterator[string, []byte] {
+	return tx.tx.Iter(ctx, pfx)
+}
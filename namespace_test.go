@@ -0,0 +1,183 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+)
+
+func TestNamespaced(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+
+	ns := storage.Namespaced(conn, "tenant", "1")
+
+	err := ns.Set("one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = ns.Bucket("config").Set("two", 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// outside of namespace
+	err = conn.Set("root", 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = conn.Bucket("tenant", "10").Set("one", 10)
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[int](conn.Bucket("tenant", "1"), "one")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Key not rewritten")
+	}
+
+	val, err = helpers.Get[int](conn.Bucket("tenant", "1", "config"), "two")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 2 {
+		t.Error("Bucket not rewritten")
+	}
+
+	if ns.Exists("root") {
+		t.Error("Key outside of namespace reachable")
+	}
+
+	_, err = helpers.Get[int](ns, "root")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Error("Expected not found, got", err)
+	}
+
+	keys, err := ns.Keys("")
+	if err != nil {
+		t.Error(err)
+	}
+	sort.Strings(keys)
+
+	expected := []string{ns.Encoding().EncodeKey(ns.Encoding().EncodeBucket("config"), "two"), "one"}
+	sort.Strings(expected)
+	if len(keys) != 2 || keys[0] != expected[0] || keys[1] != expected[1] {
+		t.Error("Unexpected keys", keys)
+	}
+
+	length, err := ns.Len("")
+	if err != nil {
+		t.Error(err)
+	}
+	if length != 2 {
+		t.Error("Len not 2, got", length)
+	}
+
+	n := 0
+	for item := range helpers.Iter[int](context.Background(), ns.Bucket("config")) {
+		n++
+		if item.Key != "two" || item.Value != 2 {
+			t.Error("Unexpected item", item)
+		}
+	}
+	if n != 1 {
+		t.Error("Expected 1 item, got", n)
+	}
+}
+
+func TestNamespacedWatch(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+
+	ns := storage.Namespaced(conn, "tenant", "1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := helpers.Watch[int](ctx, ns, "")
+
+	// Magic sleep
+	time.Sleep(100 * time.Millisecond)
+
+	err := conn.Bucket("tenant", "10").Set("one", 10)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = ns.Set("one", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	select {
+	case item := <-events:
+		if item.Event != types.PutEvent || item.Key != "one" || item.Value != 1 {
+			t.Error("Unexpected event", item)
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("Change not found")
+	}
+}
+
+func TestNamespacedTx(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+
+	ns := storage.Namespaced(conn, "tenant", "1")
+
+	err := ns.Bucket("tx").Tx(func(tx storage.Transactioner) error {
+		return tx.Set("counter", 1)
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	val, err := helpers.Get[int](conn.Bucket("tenant", "1", "tx"), "counter")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != 1 {
+		t.Error("Value not 1")
+	}
+}
+
+func TestNamespacedTxIsolation(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+
+	err := conn.Bucket("tenant", "2").Set("secret", "value")
+	if err != nil {
+		t.Error(err)
+	}
+
+	ns := storage.Namespaced(conn, "tenant", "1")
+	err = ns.Tx("", func(tx storage.Transactioner) error {
+		if _, ok := tx.(*storage.Bucket); ok {
+			t.Error("Transaction exposes bucket of underlying connection")
+		}
+		if tx.Exists("secret") {
+			t.Error("Key of other namespace reachable")
+		}
+		return tx.Set("key", 1)
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !conn.Bucket("tenant", "1").Exists("key") {
+		t.Error("Key not written to namespace")
+	}
+}
@@ -0,0 +1,205 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Operators of Where
+const (
+	Eq       = "="
+	Ne       = "!="
+	Lt       = "<"
+	Le       = "<="
+	Gt       = ">"
+	Ge       = ">="
+	In       = "in"       // field equals one of values in slice
+	Contains = "contains" // string field contains substring or slice field contains value
+	Prefix   = "prefix"   // string field starts with value
+)
+
+// field returns value at dot separated path, eg. "address.city"
+func field(v any, path string) (any, bool) {
+	if path == "" {
+		return v, true
+	}
+
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		v, ok = m[name]
+		if !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// compare returns -1, 0 or 1 comparing a with b, false when values are not comparable
+func compare(a, b any) (int, bool) {
+	if an, ok := number(a); ok {
+		bn, ok := number(b)
+		if bt, isTime := b.(time.Time); isTime {
+			// timestamps decoded from CBOR are epoch seconds
+			bn, ok = float64(bt.UnixNano())/1e9, true
+		}
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case an < bn:
+			return -1, true
+		case an > bn:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	switch a := a.(type) {
+	case string:
+		if bt, ok := b.(time.Time); ok {
+			// timestamps decoded from JSON are strings
+			at, err := time.Parse(time.RFC3339Nano, a)
+			if err != nil {
+				return 0, false
+			}
+			return compare(at, bt)
+		}
+		b, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a, b), true
+
+	case bool:
+		b, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a == b:
+			return 0, true
+		case !a:
+			return -1, true
+		}
+		return 1, true
+
+	case time.Time:
+		switch b := b.(type) {
+		case time.Time:
+			return a.Compare(b), true
+		case string:
+			bt, err := time.Parse(time.RFC3339Nano, b)
+			if err != nil {
+				return 0, false
+			}
+			return a.Compare(bt), true
+		}
+		if _, ok := number(b); ok {
+			c, ok := compare(b, a)
+			return -c, ok
+		}
+		return 0, false
+
+	case nil:
+		if b == nil {
+			return 0, true
+		}
+		return 0, false
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return 0, true
+	}
+	return 0, false
+}
+
+// match reports whether field value v matches operator and value
+func match(v any, op string, value any) (bool, error) {
+	switch op {
+	case Eq, "==":
+		c, ok := compare(v, value)
+		return ok && c == 0, nil
+	case Ne:
+		c, ok := compare(v, value)
+		return !ok || c != 0, nil
+	case Lt:
+		c, ok := compare(v, value)
+		return ok && c < 0, nil
+	case Le:
+		c, ok := compare(v, value)
+		return ok && c <= 0, nil
+	case Gt:
+		c, ok := compare(v, value)
+		return ok && c > 0, nil
+	case Ge:
+		c, ok := compare(v, value)
+		return ok && c >= 0, nil
+
+	case In:
+		values := reflect.ValueOf(value)
+		if values.Kind() != reflect.Slice && values.Kind() != reflect.Array {
+			return false, fmt.Errorf("query: %s expects slice, got %T", op, value)
+		}
+		for i := 0; i < values.Len(); i++ {
+			if c, ok := compare(v, values.Index(i).Interface()); ok && c == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case Contains:
+		if s, ok := v.(string); ok {
+			sub, ok := value.(string)
+			return ok && strings.Contains(s, sub), nil
+		}
+		if items, ok := v.([]any); ok {
+			for _, item := range items {
+				if c, ok := compare(item, value); ok && c == 0 {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+
+	case Prefix:
+		s, ok := v.(string)
+		pfx, ok2 := value.(string)
+		return ok && ok2 && strings.HasPrefix(s, pfx), nil
+	}
+	return false, fmt.Errorf("query: unknown operator %q", op)
+}
@@ -0,0 +1,300 @@
+// Package query filters, sorts and projects values of bucket by field paths.
+//
+// Values are decoded with coder of connection, fields are addressed with dot separated paths,
+// eg. "address.city". Key prefix and range limits are pushed down to engines implementing storage.Ranger.
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+)
+
+type filter struct {
+	path  string
+	op    string
+	value any
+}
+
+type order struct {
+	path string
+	desc bool
+}
+
+// item of bucket with decoded value
+type item struct {
+	key   string
+	data  []byte
+	value any
+}
+
+// Query of values of type T in bucket
+type Query[T any] struct {
+	bucket storage.Bucketer
+
+	prefix   string
+	from, to string
+	filters  []filter
+	orders   []order
+	offset   int
+	limit    int
+	fields   []string
+}
+
+func New[T any](bucket storage.Bucketer) *Query[T] {
+	return &Query[T]{bucket: bucket}
+}
+
+// Prefix limits query to keys with prefix
+func (q *Query[T]) Prefix(pfx string) *Query[T] {
+	q.prefix = pfx
+	return q
+}
+
+// Range limits query to keys in range [from, to), empty to is unbounded
+func (q *Query[T]) Range(from, to string) *Query[T] {
+	q.from, q.to = from, to
+	return q
+}
+
+// Where filters values by field, see operators
+func (q *Query[T]) Where(path, op string, value any) *Query[T] {
+	q.filters = append(q.filters, filter{path: path, op: op, value: value})
+	return q
+}
+
+// OrderBy sorts values by field ascending, values without field are first. Values are sorted by key by default.
+func (q *Query[T]) OrderBy(path string) *Query[T] {
+	q.orders = append(q.orders, order{path: path})
+	return q
+}
+
+// OrderByDesc sorts values by field descending
+func (q *Query[T]) OrderByDesc(path string) *Query[T] {
+	q.orders = append(q.orders, order{path: path, desc: true})
+	return q
+}
+
+// Offset skips first n results
+func (q *Query[T]) Offset(n int) *Query[T] {
+	q.offset = n
+	return q
+}
+
+// Limit number of results, zero is unlimited
+func (q *Query[T]) Limit(n int) *Query[T] {
+	q.limit = n
+	return q
+}
+
+// Select fields returned by Maps
+func (q *Query[T]) Select(paths ...string) *Query[T] {
+	q.fields = append(q.fields, paths...)
+	return q
+}
+
+// iter returns items of bucket within prefix and range
+func (q *Query[T]) iter(ctx context.Context) types.Iterator[string, []byte] {
+	if q.from == "" && q.to == "" {
+		return q.bucket.Iter(ctx, q.prefix)
+	}
+
+	if r, ok := q.bucket.(storage.Ranger); ok {
+		return r.IterRange(ctx, q.from, q.to)
+	}
+
+	out := make(chan types.Item[string, []byte])
+	go func() {
+		defer close(out)
+		for item := range q.bucket.Iter(ctx, q.prefix) {
+			if item.Key < q.from || (q.to != "" && item.Key >= q.to) {
+				continue
+			}
+
+			select {
+			case out <- item:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+// run returns matching items in order
+func (q *Query[T]) run(ctx context.Context) ([]item, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	items := []item{}
+	for i := range q.iter(ctx) {
+		if !strings.HasPrefix(i.Key, q.prefix) {
+			continue
+		}
+
+		var value any
+		err := q.bucket.Encoding().DecodeValue(i.Value, &value)
+		if err != nil {
+			return nil, fmt.Errorf("query %s: %w", i.Key, err)
+		}
+		value = internal.FixValue(value)
+
+		ok, err := q.match(value)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			items = append(items, item{key: i.Key, data: i.Value, value: value})
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		for _, o := range q.orders {
+			a, _ := field(items[i].value, o.path)
+			b, _ := field(items[j].value, o.path)
+			c := order3(a, b)
+			if o.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return items[i].key < items[j].key
+	})
+
+	if q.offset > 0 {
+		if q.offset >= len(items) {
+			return []item{}, nil
+		}
+		items = items[q.offset:]
+	}
+	if q.limit > 0 && q.limit < len(items) {
+		items = items[:q.limit]
+	}
+	return items, nil
+}
+
+func (q *Query[T]) match(value any) (bool, error) {
+	for _, f := range q.filters {
+		v, exists := field(value, f.path)
+		if !exists {
+			return false, nil
+		}
+
+		ok, err := match(v, f.op, f.value)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// order3 compares values for sorting, missing and incomparable values are first
+func order3(a, b any) int {
+	if c, ok := compare(a, b); ok {
+		return c
+	}
+	switch {
+	case a == nil && b != nil:
+		return -1
+	case a != nil && b == nil:
+		return 1
+	}
+	// order of different types
+	return strings.Compare(fmt.Sprintf("%T", a), fmt.Sprintf("%T", b))
+}
+
+// Items returns matching keys and values
+func (q *Query[T]) Items(ctx context.Context) ([]types.Item[string, T], error) {
+	items, err := q.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]types.Item[string, T], len(items))
+	for i, item := range items {
+		value, err := helpers.Decode[T](q.bucket.Encoding(), item.data)
+		if err != nil {
+			return nil, fmt.Errorf("query %s: %w", item.key, err)
+		}
+		out[i] = types.Item[string, T]{Key: item.key, Value: value}
+	}
+	return out, nil
+}
+
+// All returns matching values
+func (q *Query[T]) All(ctx context.Context) ([]T, error) {
+	items, err := q.Items(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]T, len(items))
+	for i, item := range items {
+		out[i] = item.Value
+	}
+	return out, nil
+}
+
+// First returns first matching value
+func (q *Query[T]) First(ctx context.Context) (T, error) {
+	limit := q.limit
+	q.limit = 1
+	defer func() { q.limit = limit }()
+
+	items, err := q.Items(ctx)
+	if err != nil {
+		return *new(T), err
+	}
+	if len(items) == 0 {
+		return *new(T), fmt.Errorf("query: %w", storage.ErrNotFound)
+	}
+	return items[0].Value, nil
+}
+
+// Count returns number of matching values
+func (q *Query[T]) Count(ctx context.Context) (int, error) {
+	items, err := q.run(ctx)
+	return len(items), err
+}
+
+// Maps returns selected fields of matching values by path, with key under "_key".
+// All fields are returned when no field is selected.
+func (q *Query[T]) Maps(ctx context.Context) ([]map[string]any, error) {
+	items, err := q.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]map[string]any, len(items))
+	for i, item := range items {
+		m := map[string]any{}
+		if len(q.fields) == 0 {
+			fields, ok := item.value.(map[string]any)
+			if !ok {
+				return nil, errors.New("query: value is not object, select fields")
+			}
+			for k, v := range fields {
+				m[k] = v
+			}
+		}
+		for _, path := range q.fields {
+			if v, exists := field(item.value, path); exists {
+				m[path] = v
+			}
+		}
+		m["_key"] = item.key
+		out[i] = m
+	}
+	return out, nil
+}
@@ -0,0 +1,185 @@
+package query_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/query"
+)
+
+type user struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Age       int       `json:"age"`
+	Tags      []string  `json:"tags"`
+	Address   address   `json:"address"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type address struct {
+	City string `json:"city"`
+}
+
+var (
+	db    = internal.Must(memory.New())
+	users = db.Bucket("users")
+	start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func init() {
+	for i, u := range []user{
+		{Name: "alice", Status: "active", Age: 30, Tags: []string{"admin"}, Address: address{City: "Warsaw"}},
+		{Name: "bob", Status: "inactive", Age: 25, Address: address{City: "Berlin"}},
+		{Name: "carol", Status: "active", Age: 35, Tags: []string{"dev"}, Address: address{City: "Warsaw"}},
+		{Name: "dave", Status: "active", Age: 20, Tags: []string{"dev", "admin"}, Address: address{City: "Paris"}},
+	} {
+		u.CreatedAt = start.Add(time.Duration(3-i) * time.Hour)
+		internal.Must(0, users.Set("user-"+u.Name, u))
+	}
+}
+
+func names(users []user) string {
+	out := []string{}
+	for _, u := range users {
+		out = append(out, u.Name)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestWhere(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		query    *query.Query[user]
+		expected string
+	}{
+		{query.New[user](users).Where("status", "=", "active"), "alice,carol,dave"},
+		{query.New[user](users).Where("age", ">=", 30), "alice,carol"},
+		{query.New[user](users).Where("address.city", "!=", "Warsaw"), "bob,dave"},
+		{query.New[user](users).Where("tags", query.Contains, "admin"), "alice,dave"},
+		{query.New[user](users).Where("name", query.In, []string{"bob", "dave"}), "bob,dave"},
+		{query.New[user](users).Where("name", query.Prefix, "ca"), "carol"},
+		{query.New[user](users).Where("createdAt", "<", start.Add(2*time.Hour)), "carol,dave"},
+		{query.New[user](users).Where("status", "=", "active").Where("age", "<", 30), "dave"},
+		{query.New[user](users).Where("missing", "=", 1), ""},
+	}
+
+	for _, test := range tests {
+		result, err := test.query.All(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		if names(result) != test.expected {
+			t.Error("Expected", test.expected, "got", names(result))
+		}
+	}
+
+	_, err := query.New[user](users).Where("age", "~", 1).All(ctx)
+	if err == nil {
+		t.Error("Expected error for unknown operator")
+	}
+}
+
+func TestOrderLimit(t *testing.T) {
+	ctx := context.Background()
+
+	result, err := query.New[user](users).Where("status", "=", "active").OrderBy("createdAt").Limit(2).All(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if names(result) != "dave,carol" {
+		t.Error("Unexpected order", names(result))
+	}
+
+	result, err = query.New[user](users).OrderByDesc("age").Offset(1).Limit(2).All(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if names(result) != "alice,bob" {
+		t.Error("Unexpected order", names(result))
+	}
+
+	count, err := query.New[user](users).Where("address.city", "=", "Warsaw").Count(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if count != 2 {
+		t.Error("Expected 2, got", count)
+	}
+
+	_, err = query.New[user](users).Where("age", ">", 100).First(ctx)
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Error("Expected not found, got", err)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	maps, err := query.New[user](users).Where("name", "=", "alice").Select("name", "address.city").Maps(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+	if len(maps) != 1 {
+		t.Fatal("Expected 1 result, got", len(maps))
+	}
+	if maps[0]["name"] != "alice" || maps[0]["address.city"] != "Warsaw" || maps[0]["_key"] != "user-alice" || len(maps[0]) != 3 {
+		t.Error("Unexpected projection", maps[0])
+	}
+}
+
+// ranger pushes down range to iteration of underlying connection
+type ranger struct {
+	storage.Connection
+	calls int
+}
+
+func (r *ranger) IterRange(ctx context.Context, from, to string) types.Iterator[string, []byte] {
+	r.calls++
+	out := make(chan types.Item[string, []byte])
+	go func() {
+		defer close(out)
+		for item := range r.Connection.Iter(ctx, "") {
+			if item.Key >= from && (to == "" || item.Key < to) {
+				out <- item
+			}
+		}
+	}()
+	return out
+}
+
+func TestRange(t *testing.T) {
+	ctx := context.Background()
+
+	result, err := query.New[user](users).Range("user-b", "user-d").All(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if names(result) != "bob,carol" {
+		t.Error("Unexpected range", names(result))
+	}
+
+	conn := &ranger{Connection: db}
+	bucket := storage.NewBucket(conn, "users")
+	result, err = query.New[user](bucket).Range("user-c", "").All(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if names(result) != "carol,dave" {
+		t.Error("Unexpected range", names(result))
+	}
+	if conn.calls != 1 {
+		t.Error("Range not pushed down")
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	db.Close()
+	os.Exit(code)
+}
@@ -0,0 +1,50 @@
+package queue
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+)
+
+type QueueOpts func(*Queue) error
+
+// Time after which dequeued message without Ack is delivered again, etcd rounds it to seconds
+func Visibility(d time.Duration) QueueOpts {
+	return func(q *Queue) error {
+		if d <= 0 {
+			return errors.New("queue: visibility must be positive")
+		}
+		q.visibility = d
+		return nil
+	}
+}
+
+// Number of deliveries after which message is moved to dead letters, zero retries forever
+func MaxAttempts(n int) QueueOpts {
+	return func(q *Queue) error {
+		if n < 0 {
+			return errors.New("queue: max attempts can't be negative")
+		}
+		q.maxAttempts = n
+		return nil
+	}
+}
+
+// Interval of checking expired messages while Dequeue waits
+func PollInterval(d time.Duration) QueueOpts {
+	return func(q *Queue) error {
+		if d <= 0 {
+			return errors.New("queue: poll interval must be positive")
+		}
+		q.poll = d
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) QueueOpts {
+	return func(q *Queue) error {
+		q.lg = lg
+		return nil
+	}
+}
@@ -0,0 +1,395 @@
+// Package queue implements durable work queue in bucket.
+//
+// Messages are dequeued by priority, then in order of enqueue. Dequeued message is
+// hidden from other consumers until it is acknowledged with Ack, returned with Nack or
+// its visibility timeout expires. Messages delivered MaxAttempts times without Ack are
+// moved to dead letters. Every change of message is done in transaction of bucket,
+// so consumers of multiple processes can share queue on etcd, Redis or SQL.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/options"
+	"github.com/rafalb8/go-storage/sequence"
+)
+
+var (
+	// ErrEmpty is returned by TryDequeue when no message is ready
+	ErrEmpty = errors.New("queue: empty")
+	// ErrNotInFlight is returned when acknowledged message was redelivered or already acknowledged
+	ErrNotInFlight = errors.New("queue: message is not in flight")
+)
+
+// buckets of queue
+const (
+	readyBucket    = "ready"
+	inflightBucket = "inflight"
+	leaseBucket    = "lease"
+	deadBucket     = "dead"
+	sequenceKey    = "seq"
+)
+
+// Message of queue
+type Message struct {
+	ID       string    `json:"id"`
+	Priority uint8     `json:"priority"`
+	Attempts int       `json:"attempts"` // number of deliveries including current one
+	Enqueued time.Time `json:"enqueued"`
+	Body     []byte    `json:"body"` // encoded value
+
+	coder encoding.ValueCoder
+}
+
+// Decode body of message into v
+func (m *Message) Decode(v any) error {
+	return m.coder.DecodeValue(m.Body, v)
+}
+
+type Queue struct {
+	bucket *storage.Bucket
+	seq    *sequence.Sequence
+
+	visibility  time.Duration
+	maxAttempts int
+	poll        time.Duration
+
+	// Logger
+	lg storage.Logger
+}
+
+// New returns queue stored in bucket
+func New(bucket *storage.Bucket, opts ...QueueOpts) (*Queue, error) {
+	q := &Queue{
+		bucket:      bucket,
+		visibility:  30 * time.Second,
+		maxAttempts: 5,
+		poll:        time.Second,
+		lg:          &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(q)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// every ID is reserved separately, so order of IDs follows order of enqueue across processes
+	var err error
+	q.seq, err = sequence.New(bucket, sequenceKey, sequence.Block(1), sequence.Logger(q.lg))
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Enqueue adds value to queue with priority 0, returns ID of message
+func (q *Queue) Enqueue(v any) (string, error) {
+	return q.EnqueuePriority(v, 0)
+}
+
+// EnqueuePriority adds value to queue, messages with higher priority are dequeued first
+func (q *Queue) EnqueuePriority(v any, priority uint8) (string, error) {
+	body, err := q.bucket.Encoding().EncodeValue(v)
+	if err != nil {
+		return "", fmt.Errorf("encoder: %w", err)
+	}
+
+	n, err := q.seq.Next()
+	if err != nil {
+		return "", err
+	}
+
+	// keys sort by priority descending, then by sequence
+	id := fmt.Sprintf("%02x%s", 0xff-priority, sequence.Format(n))
+	q.lg.Debug("ENQUEUE", id)
+
+	msg := Message{ID: id, Priority: priority, Enqueued: time.Now(), Body: body}
+	err = q.bucket.Bucket(readyBucket).Set(id, msg)
+	if err != nil {
+		return "", fmt.Errorf("enqueue: %w", err)
+	}
+	return id, nil
+}
+
+// TryDequeue returns first ready message or ErrEmpty, message has to be acknowledged within visibility timeout.
+// Messages with expired visibility timeout are returned to queue by RequeueExpired.
+func (q *Queue) TryDequeue() (*Message, error) {
+	var out *Message
+	err := q.bucket.Tx(func(tx storage.Transactioner) error {
+		ready := q.sub(tx, readyBucket)
+		msg, err := q.first(ready)
+		if err != nil {
+			return err
+		}
+
+		q.lg.Debug("DEQUEUE", msg.ID)
+		msg.Attempts++
+		err = q.sub(tx, inflightBucket).Set(msg.ID, msg)
+		if err != nil {
+			return err
+		}
+		err = q.sub(tx, leaseBucket).Set(leaseKey(&msg), msg.Attempts, options.TTL(q.visibility))
+		if err != nil {
+			return err
+		}
+		err = ready.Delete(msg.ID)
+		if err != nil {
+			return err
+		}
+
+		msg.coder = q.bucket.Encoding()
+		out = &msg
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dequeue: %w", err)
+	}
+	return out, nil
+}
+
+// Dequeue waits for ready message until ctx is done.
+// Queue is watched for new messages, messages with expired visibility timeout are requeued every PollInterval.
+func (q *Queue) Dequeue(ctx context.Context) (*Message, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// watch before first attempt, so message enqueued meanwhile is not missed
+	events := q.bucket.Bucket(readyBucket).Watch(ctx, "")
+	defer func() {
+		// bucket watcher blocks on unread events
+		go func() {
+			for range events {
+			}
+		}()
+	}()
+
+	ticker := time.NewTicker(q.poll)
+	defer ticker.Stop()
+
+	wake := events
+	for {
+		msg, err := q.TryDequeue()
+		if !errors.Is(err, ErrEmpty) {
+			return msg, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case _, ok := <-wake:
+			if !ok {
+				// watch was closed, fall back to polling
+				wake = nil
+			}
+		case <-ticker.C:
+			err := q.RequeueExpired()
+			if err != nil {
+				q.lg.Error("queue:", err)
+			}
+		}
+	}
+}
+
+// RequeueExpired returns messages with expired visibility timeout to queue
+func (q *Queue) RequeueExpired() error {
+	err := q.bucket.Tx(q.requeueExpired)
+	if err != nil {
+		return fmt.Errorf("requeue: %w", err)
+	}
+	return nil
+}
+
+// Ack removes processed message from queue
+func (q *Queue) Ack(m *Message) error {
+	q.lg.Debug("ACK", m.ID)
+	return q.bucket.Tx(func(tx storage.Transactioner) error {
+		_, err := q.inflight(tx, m)
+		if err != nil {
+			return fmt.Errorf("ack %s: %w", m.ID, err)
+		}
+		return q.release(tx, m)
+	})
+}
+
+// Nack returns message to queue, or moves it to dead letters when it was delivered MaxAttempts times
+func (q *Queue) Nack(m *Message) error {
+	q.lg.Debug("NACK", m.ID)
+	return q.bucket.Tx(func(tx storage.Transactioner) error {
+		msg, err := q.inflight(tx, m)
+		if err != nil {
+			return fmt.Errorf("nack %s: %w", m.ID, err)
+		}
+
+		err = q.requeue(tx, msg)
+		if err != nil {
+			return fmt.Errorf("nack %s: %w", m.ID, err)
+		}
+		return q.release(tx, m)
+	})
+}
+
+// Len returns number of ready messages, messages in flight are not counted
+func (q *Queue) Len() (int, error) {
+	return q.bucket.Bucket(readyBucket).Len()
+}
+
+// Dead returns dead letters
+func (q *Queue) Dead() ([]Message, error) {
+	dead := q.bucket.Bucket(deadBucket)
+	ids, err := dead.Keys()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+
+	out := []Message{}
+	for _, id := range ids {
+		msg := Message{}
+		err := dead.Get(id, &msg)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("dead %s: %w", id, err)
+		}
+		msg.coder = q.bucket.Encoding()
+		out = append(out, msg)
+	}
+	return out, nil
+}
+
+// Retry moves dead letter back to queue with attempts reset
+func (q *Queue) Retry(id string) error {
+	q.lg.Debug("RETRY", id)
+	return q.bucket.Tx(func(tx storage.Transactioner) error {
+		dead := q.sub(tx, deadBucket)
+		msg := Message{}
+		err := dead.Get(id, &msg)
+		if err != nil {
+			return fmt.Errorf("retry %s: %w", id, err)
+		}
+
+		msg.Attempts = 0
+		err = q.sub(tx, readyBucket).Set(id, msg)
+		if err != nil {
+			return fmt.Errorf("retry %s: %w", id, err)
+		}
+		return dead.Delete(id)
+	})
+}
+
+// first returns ready message with lowest key, ready messages are not scanned
+func (q *Queue) first(ready *storage.Bucket) (Message, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msg := Message{}
+	for item := range ready.IterRange(ctx, "", "") {
+		err := q.bucket.Encoding().DecodeValue(item.Value, &msg)
+		if err != nil {
+			return msg, fmt.Errorf("decoder: %w", err)
+		}
+		return msg, nil
+	}
+	return msg, ErrEmpty
+}
+
+// inflight returns stored message in flight, ErrNotInFlight is returned when m is not its current delivery
+func (q *Queue) inflight(tx storage.Transactioner, m *Message) (Message, error) {
+	msg := Message{}
+	err := q.sub(tx, inflightBucket).Get(m.ID, &msg)
+	if errors.Is(err, storage.ErrNotFound) {
+		return msg, ErrNotInFlight
+	}
+	if err != nil {
+		return msg, err
+	}
+	if msg.Attempts != m.Attempts {
+		return msg, ErrNotInFlight
+	}
+	return msg, nil
+}
+
+// release removes message and its lease from messages in flight
+func (q *Queue) release(tx storage.Transactioner, m *Message) error {
+	err := q.sub(tx, leaseBucket).Delete(leaseKey(m))
+	if err != nil {
+		return err
+	}
+	return q.sub(tx, inflightBucket).Delete(m.ID)
+}
+
+// requeue moves message to ready messages or dead letters
+func (q *Queue) requeue(tx storage.Transactioner, msg Message) error {
+	if q.maxAttempts > 0 && msg.Attempts >= q.maxAttempts {
+		q.lg.Warn("queue: message", msg.ID, "moved to dead letters after", msg.Attempts, "attempts")
+		return q.sub(tx, deadBucket).Set(msg.ID, msg)
+	}
+	return q.sub(tx, readyBucket).Set(msg.ID, msg)
+}
+
+// requeueExpired requeues messages in flight with expired lease
+func (q *Queue) requeueExpired(tx storage.Transactioner) error {
+	inflight := q.sub(tx, inflightBucket)
+	ids, err := inflight.Keys()
+	if err != nil {
+		return err
+	}
+
+	lease := q.sub(tx, leaseBucket)
+	for _, id := range ids {
+		msg := Message{}
+		err := inflight.Get(id, &msg)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var raw encoding.Raw
+		err = lease.Get(leaseKey(&msg), &raw)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+
+		q.lg.Debug("EXPIRED", id)
+		err = q.requeue(tx, msg)
+		if err != nil {
+			return err
+		}
+		err = inflight.Delete(id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sub returns bucket of queue, connection of transaction is used when available
+func (q *Queue) sub(tx storage.Transactioner, name string) *storage.Bucket {
+	if b, ok := tx.(*storage.Bucket); ok {
+		return b.Bucket(name)
+	}
+	return q.bucket.Bucket(name)
+}
+
+// leaseKey is unique for every delivery, so TTL of previous delivery can't remove it
+func leaseKey(m *Message) string {
+	return m.ID + "." + strconv.Itoa(m.Attempts)
+}
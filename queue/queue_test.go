@@ -0,0 +1,325 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/queue"
+)
+
+func TestOrder(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+	q := internal.Must(queue.New(conn.Bucket("jobs")))
+
+	for _, v := range []string{"one", "two", "three"} {
+		_, err := q.Enqueue(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := q.EnqueuePriority("urgent", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"urgent", "one", "two", "three"} {
+		msg, err := q.TryDequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got string
+		err = msg.Decode(&got)
+		if err != nil {
+			t.Error(err)
+		}
+		if got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+
+		err = q.Ack(msg)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	_, err = q.TryDequeue()
+	if !errors.Is(err, queue.ErrEmpty) {
+		t.Error("expected ErrEmpty, got", err)
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+	q := internal.Must(queue.New(conn.Bucket("jobs"), queue.Visibility(50*time.Millisecond)))
+
+	id, err := q.Enqueue("job")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := q.TryDequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// hidden until visibility timeout
+	_, err = q.TryDequeue()
+	if !errors.Is(err, queue.ErrEmpty) {
+		t.Error("expected ErrEmpty, got", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	// expired message is requeued by sweep, not by TryDequeue
+	_, err = q.TryDequeue()
+	if !errors.Is(err, queue.ErrEmpty) {
+		t.Error("expected ErrEmpty, got", err)
+	}
+	err = q.RequeueExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := q.TryDequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != id || second.Attempts != 2 {
+		t.Errorf("expected redelivery of %s, got %s attempt %d", id, second.ID, second.Attempts)
+	}
+
+	// first delivery is lost
+	err = q.Ack(first)
+	if !errors.Is(err, queue.ErrNotInFlight) {
+		t.Error("expected ErrNotInFlight, got", err)
+	}
+
+	err = q.Ack(second)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+	q := internal.Must(queue.New(conn.Bucket("jobs"), queue.MaxAttempts(2)))
+
+	id, err := q.Enqueue("job")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		msg, err := q.TryDequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = q.Nack(msg)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	_, err = q.TryDequeue()
+	if !errors.Is(err, queue.ErrEmpty) {
+		t.Error("expected ErrEmpty, got", err)
+	}
+
+	dead, err := q.Dead()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(dead) != 1 || dead[0].ID != id || dead[0].Attempts != 2 {
+		t.Fatalf("expected dead letter %s, got %+v", id, dead)
+	}
+
+	err = q.Retry(id)
+	if err != nil {
+		t.Error(err)
+	}
+	msg, err := q.TryDequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Attempts != 1 {
+		t.Error("expected attempts reset, got", msg.Attempts)
+	}
+}
+
+func TestDequeueWait(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+	q := internal.Must(queue.New(conn.Bucket("jobs"), queue.PollInterval(time.Hour)))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, err := q.Enqueue("job")
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	msg.Decode(&got)
+	if got != "job" {
+		t.Error("expected job, got", got)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = q.Dequeue(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected deadline exceeded, got", err)
+	}
+}
+
+// unwatched closes watches immediately and counts transactions
+type unwatched struct {
+	storage.Connection
+	txs atomic.Int64
+}
+
+func (u *unwatched) Watch(ctx context.Context, pfx string) types.Watcher[string, []byte] {
+	out := make(chan types.WatchMsg[string, []byte])
+	close(out)
+	return out
+}
+
+func (u *unwatched) Tx(pfx string, fn func(tx storage.Transactioner) error) error {
+	u.txs.Add(1)
+	return u.Connection.Tx(pfx, fn)
+}
+
+func TestDequeueClosedWatch(t *testing.T) {
+	conn := &unwatched{Connection: internal.Must(memory.New())}
+	defer conn.Close()
+	q := internal.Must(queue.New(storage.NewBucket(conn, "jobs"), queue.PollInterval(20*time.Millisecond)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// closed watch doesn't wake consumer, queue is polled
+	_, err := q.Dequeue(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected deadline exceeded, got", err)
+	}
+	if txs := conn.txs.Load(); txs > 20 {
+		t.Error("expected polling, got", txs, "transactions")
+	}
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		_, err := q.Enqueue("job")
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err = q.Dequeue(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDequeueExpired(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+	q := internal.Must(queue.New(conn.Bucket("jobs"), queue.Visibility(20*time.Millisecond), queue.PollInterval(10*time.Millisecond)))
+
+	id, err := q.Enqueue("job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = q.TryDequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// expired message is requeued on poll
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	msg, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != id || msg.Attempts != 2 {
+		t.Errorf("expected redelivery of %s, got %s attempt %d", id, msg.ID, msg.Attempts)
+	}
+}
+
+func TestConsumers(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+	q := internal.Must(queue.New(conn.Bucket("jobs")))
+
+	for i := 0; i < 100; i++ {
+		_, err := q.Enqueue(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mtx := sync.Mutex{}
+	seen := map[int]int{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				msg, err := q.TryDequeue()
+				if errors.Is(err, queue.ErrEmpty) {
+					return
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				var v int
+				msg.Decode(&v)
+				mtx.Lock()
+				seen[v]++
+				mtx.Unlock()
+
+				err = q.Ack(msg)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != 100 {
+		t.Error("expected 100 messages, got", len(seen))
+	}
+	for v, n := range seen {
+		if n != 1 {
+			t.Errorf("message %d delivered %d times", v, n)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package registry
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+)
+
+type RegistryOpts func(*Registry) error
+
+// Time after which instance is removed when it is not kept alive, it is refreshed every third of TTL.
+// Etcd rounds it to seconds.
+func TTL(d time.Duration) RegistryOpts {
+	return func(r *Registry) error {
+		if d < time.Millisecond {
+			return errors.New("registry: TTL must be at least 1ms")
+		}
+		r.ttl = d
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) RegistryOpts {
+	return func(r *Registry) error {
+		r.lg = lg
+		return nil
+	}
+}
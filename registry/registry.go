@@ -0,0 +1,234 @@
+// Package registry registers service instances in bucket and discovers them.
+//
+// Instance is stored with TTL, which is kept alive while instance is registered, so
+// instances of crashed processes disappear after TTL. Etcd keeps single lease alive. Clients list live instances
+// with Instances and follow changes with Watch.
+package registry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+)
+
+// Instance of service
+type Instance struct {
+	ID       string            `json:"id"`
+	Address  string            `json:"address"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type Registry struct {
+	bucket *storage.Bucket
+	ttl    time.Duration
+
+	// Logger
+	lg storage.Logger
+}
+
+// New returns registry storing instances of service in bucket/service
+func New(bucket *storage.Bucket, opts ...RegistryOpts) (*Registry, error) {
+	r := &Registry{
+		bucket: bucket,
+		ttl:    10 * time.Second,
+		lg:     &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Registration keeps instance registered
+type Registration struct {
+	Instance Instance
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Register stores instance of service and keeps it alive until ctx is done or Deregister is called,
+// then instance is removed. Random ID is generated when instance has none.
+// Etcd keeps single lease alive, on other engines TTL of instance is refreshed.
+func (r *Registry) Register(ctx context.Context, service string, inst Instance) (*Registration, error) {
+	r.lg.Debug("REGISTER", service, inst.ID)
+	if inst.ID == "" {
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("registry: %w", err)
+		}
+		inst.ID = hex.EncodeToString(buf)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	bucket := r.bucket.Bucket(service)
+	lost, err := bucket.KeepAlive(ctx, inst.ID, inst, r.ttl)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("register %s: %w", inst.ID, err)
+	}
+
+	reg := &Registration{Instance: inst, cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(reg.done)
+
+		for {
+			select {
+			case <-ctx.Done():
+				r.lg.Debug("DEREGISTER", service, inst.ID)
+				reg.err = bucket.Delete(inst.ID)
+				return
+
+			case <-lost:
+				// instance is stored again, eg. after connection outage
+				r.lg.Warn("registry: instance", service, inst.ID, "is not kept alive, registering again")
+				lost = r.keepAlive(ctx, bucket, inst)
+			}
+		}
+	}()
+
+	return reg, nil
+}
+
+// keepAlive stores instance every third of TTL until it succeeds, nil is returned when ctx is done
+func (r *Registry) keepAlive(ctx context.Context, bucket *storage.Bucket, inst Instance) <-chan struct{} {
+	ticker := time.NewTicker(r.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		lost, err := bucket.KeepAlive(ctx, inst.ID, inst, r.ttl)
+		if err == nil {
+			return lost
+		}
+		r.lg.Error("registry: keep alive", inst.ID, err)
+	}
+}
+
+// Deregister stops keeping instance alive and removes it
+func (reg *Registration) Deregister() error {
+	reg.cancel()
+	<-reg.done
+	return reg.err
+}
+
+// Instances returns live instances of service sorted by ID
+func (r *Registry) Instances(service string) ([]Instance, error) {
+	instances, err := helpers.Values[Instance](r.bucket.Bucket(service))
+	if err != nil {
+		return nil, fmt.Errorf("instances %s: %w", service, err)
+	}
+
+	sort.Slice(instances, func(i, j int) bool { return instances[i].ID < instances[j].ID })
+	return instances, nil
+}
+
+// Watch sends live instances of service when watch starts and after every change.
+// Refreshes of TTL are not reported.
+func (r *Registry) Watch(ctx context.Context, service string) <-chan []Instance {
+	r.lg.Debug("WATCH", service)
+	out := make(chan []Instance)
+
+	// watch before listing, so changes made meanwhile are not missed
+	bucket := r.bucket.Bucket(service)
+	events := bucket.Watch(ctx, "")
+
+	go func() {
+		defer close(out)
+		defer func() {
+			// bucket watcher blocks on unread events
+			go func() {
+				for range events {
+				}
+			}()
+		}()
+
+		instances, err := r.Instances(service)
+		if err != nil {
+			r.lg.Error("registry: watch", err)
+			return
+		}
+
+		live := map[string]Instance{}
+		for _, inst := range instances {
+			live[inst.ID] = inst
+		}
+
+		changed := true
+		for {
+			if changed {
+				select {
+				case out <- list(live):
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			var event types.WatchMsg[string, []byte]
+			var ok bool
+			select {
+			case event, ok = <-events:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+
+			changed = r.apply(live, bucket, event)
+		}
+	}()
+
+	return out
+}
+
+// apply event to live instances, reports whether they changed
+func (r *Registry) apply(live map[string]Instance, bucket *storage.Bucket, event types.WatchMsg[string, []byte]) bool {
+	old, exists := live[event.Key]
+
+	if event.Event == types.DeleteEvent {
+		delete(live, event.Key)
+		return exists
+	}
+
+	inst, err := helpers.Decode[Instance](bucket.Encoding(), event.Value)
+	if err != nil {
+		r.lg.Warn("registry: decode", event.Key, err)
+		return false
+	}
+
+	live[event.Key] = inst
+	return !exists || !reflect.DeepEqual(old, inst)
+}
+
+// list returns instances sorted by ID
+func list(live map[string]Instance) []Instance {
+	out := make([]Instance, 0, len(live))
+	for _, inst := range live {
+		out = append(out, inst)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
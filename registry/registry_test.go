@@ -0,0 +1,136 @@
+package registry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/options"
+	"github.com/rafalb8/go-storage/registry"
+)
+
+func TestRegister(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+	r := internal.Must(registry.New(conn.Bucket("services"), registry.TTL(100*time.Millisecond)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, err := r.Register(ctx, "api", registry.Instance{ID: "a", Address: "10.0.0.1:80"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.Register(ctx, "api", registry.Instance{Address: "10.0.0.2:80", Metadata: map[string]string{"zone": "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Instance.ID == "" {
+		t.Error("ID not generated")
+	}
+
+	// kept alive past TTL
+	time.Sleep(250 * time.Millisecond)
+	instances, err := r.Instances("api")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("expected 2 instances, got %+v", instances)
+	}
+
+	err = a.Deregister()
+	if err != nil {
+		t.Error(err)
+	}
+	instances, err = r.Instances("api")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(instances) != 1 || instances[0].ID != b.Instance.ID || instances[0].Metadata["zone"] != "b" {
+		t.Errorf("expected instance %s, got %+v", b.Instance.ID, instances)
+	}
+
+	cancel()
+	b.Deregister()
+	instances, _ = r.Instances("api")
+	if len(instances) != 0 {
+		t.Errorf("expected no instances, got %+v", instances)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+	r := internal.Must(registry.New(conn.Bucket("services"), registry.TTL(100*time.Millisecond)))
+
+	// instance of crashed process is not refreshed
+	err := conn.Bucket("services", "api").Set("crashed", registry.Instance{ID: "crashed"}, options.TTL(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	instances, err := r.Instances("api")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(instances) != 0 {
+		t.Errorf("expected no instances, got %+v", instances)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+	r := internal.Must(registry.New(conn.Bucket("services"), registry.TTL(60*time.Millisecond)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	changes := r.Watch(ctx, "api")
+	next := func() []registry.Instance {
+		select {
+		case instances := <-changes:
+			return instances
+		case <-ctx.Done():
+			t.Fatal("change not received")
+			return nil
+		}
+	}
+
+	if instances := next(); len(instances) != 0 {
+		t.Errorf("expected no instances, got %+v", instances)
+	}
+
+	reg, err := r.Register(ctx, "api", registry.Instance{ID: "a", Address: "10.0.0.1:80"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instances := next(); len(instances) != 1 || instances[0].Address != "10.0.0.1:80" {
+		t.Errorf("expected instance a, got %+v", instances)
+	}
+
+	// refreshes are not reported
+	time.Sleep(100 * time.Millisecond)
+
+	err = reg.Deregister()
+	if err != nil {
+		t.Error(err)
+	}
+	if instances := next(); len(instances) != 0 {
+		t.Errorf("expected no instances, got %+v", instances)
+	}
+}
+
+func TestTTLValidation(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+
+	_, err := registry.New(conn.Bucket("services"), registry.TTL(time.Nanosecond))
+	if err == nil {
+		t.Error("Expected error of too short TTL")
+	}
+}
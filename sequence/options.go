@@ -0,0 +1,27 @@
+package sequence
+
+import (
+	"errors"
+
+	"github.com/rafalb8/go-storage"
+)
+
+type SequenceOpts func(*Sequence) error
+
+// Number of IDs reserved at once, larger blocks make fewer writes but lose more IDs on restart
+func Block(n int64) SequenceOpts {
+	return func(s *Sequence) error {
+		if n <= 0 {
+			return errors.New("sequence: block must be positive")
+		}
+		s.block = n
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) SequenceOpts {
+	return func(s *Sequence) error {
+		s.lg = lg
+		return nil
+	}
+}
@@ -0,0 +1,113 @@
+// Package sequence hands out unique monotonic IDs stored in counter key.
+//
+// Every Sequence reserves block of IDs with single atomic Incr of the key, so most
+// allocations are local. Processes sharing the key get disjoint blocks, IDs are unique
+// across them but ordered only within one Sequence. IDs left in block are lost on restart.
+package sequence
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/internal"
+)
+
+// width of IDs encoded with Format, enough for max int64 in base 36
+const width = 13
+
+type Sequence struct {
+	conn  storage.Incrementer
+	key   string
+	block int64
+
+	mtx  sync.Mutex
+	next int64 // next ID of reserved block
+	end  int64 // last ID of reserved block
+
+	// Logger
+	lg storage.Logger
+}
+
+// New returns sequence of IDs counted in key of conn, first ID is 1
+func New(conn storage.Incrementer, key string, opts ...SequenceOpts) (*Sequence, error) {
+	s := &Sequence{
+		conn:  conn,
+		key:   key,
+		block: 1000,
+		lg:    &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Next returns next ID, new block is reserved when current one is used up
+func (s *Sequence) Next() (int64, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.next == 0 || s.next > s.end {
+		err := s.reserve()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	id := s.next
+	s.next++
+	return id, nil
+}
+
+// NextString returns next ID encoded with Format
+func (s *Sequence) NextString() (string, error) {
+	id, err := s.Next()
+	if err != nil {
+		return "", err
+	}
+	return Format(id), nil
+}
+
+// reserve takes next block from counter
+func (s *Sequence) reserve() error {
+	s.lg.Debug("RESERVE", s.key, s.block)
+	end, err := s.conn.Incr(s.key, s.block)
+	if err != nil {
+		return fmt.Errorf("sequence %s: %w", s.key, err)
+	}
+
+	s.next = end - s.block + 1
+	s.end = end
+	return nil
+}
+
+// Format encodes ID as fixed width base 36 string, strings sort in order of IDs
+func Format(id int64) string {
+	s := strconv.FormatInt(id, 36)
+	if len(s) >= width {
+		return s
+	}
+	return strings.Repeat("0", width-len(s)) + s
+}
+
+// Parse decodes ID encoded with Format
+func Parse(s string) (int64, error) {
+	if len(s) != width {
+		return 0, errors.New("sequence: invalid ID length")
+	}
+	id, err := strconv.ParseInt(s, 36, 64)
+	if err != nil {
+		return 0, fmt.Errorf("sequence: %w", err)
+	}
+	return id, nil
+}
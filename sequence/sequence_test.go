@@ -0,0 +1,123 @@
+package sequence_test
+
+import (
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/sequence"
+)
+
+func TestNext(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+
+	seq := internal.Must(sequence.New(conn.Bucket("seq"), "ids", sequence.Block(10)))
+	for want := int64(1); want <= 25; want++ {
+		id, err := seq.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != want {
+			t.Errorf("expected %d, got %d", want, id)
+		}
+	}
+
+	// three blocks reserved
+	var n int64
+	err := conn.Bucket("seq").Get("ids", &n)
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 30 {
+		t.Errorf("expected counter 30, got %d", n)
+	}
+}
+
+func TestUnique(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+
+	// sequences of two processes sharing counter
+	seqs := []*sequence.Sequence{
+		internal.Must(sequence.New(conn, "ids", sequence.Block(7))),
+		internal.Must(sequence.New(conn, "ids", sequence.Block(7))),
+	}
+
+	mtx := sync.Mutex{}
+	ids := map[int64]bool{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		seq := seqs[i%len(seqs)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			last := int64(0)
+			for j := 0; j < 100; j++ {
+				id, err := seq.Next()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if id <= last {
+					t.Errorf("id %d not greater than %d", id, last)
+				}
+				last = id
+
+				mtx.Lock()
+				if ids[id] {
+					t.Errorf("duplicate id %d", id)
+				}
+				ids[id] = true
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(ids) != 1000 {
+		t.Errorf("expected 1000 ids, got %d", len(ids))
+	}
+}
+
+func TestBlock(t *testing.T) {
+	conn := internal.Must(memory.New())
+	defer conn.Close()
+
+	_, err := sequence.New(conn, "ids", sequence.Block(0))
+	if err == nil {
+		t.Error("expected error for empty block")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	ids := []int64{1, 35, 36, 1000, 1 << 40, 1<<63 - 1}
+
+	strs := []string{}
+	for _, id := range ids {
+		s := sequence.Format(id)
+		if len(s) != 13 {
+			t.Errorf("%d: expected 13 chars, got %q", id, s)
+		}
+
+		parsed, err := sequence.Parse(s)
+		if err != nil {
+			t.Error(err)
+		}
+		if parsed != id {
+			t.Errorf("expected %d, got %d", id, parsed)
+		}
+		strs = append(strs, s)
+	}
+
+	if !sort.StringsAreSorted(strs) {
+		t.Errorf("formatted ids not sorted: %v", strs)
+	}
+
+	_, err := sequence.Parse("abc")
+	if err == nil {
+		t.Error("expected error for short id")
+	}
+}
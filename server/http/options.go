@@ -0,0 +1,61 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+)
+
+type ServerOpts func(*Server) error
+
+// Default and maximum number of items returned by bucket listing
+func PageSize(def, max int) ServerOpts {
+	return func(s *Server) error {
+		s.pageSize = def
+		s.maxPageSize = max
+		return nil
+	}
+}
+
+// Interval of keep-alive comments sent to watch streams
+func KeepAlive(d time.Duration) ServerOpts {
+	return func(s *Server) error {
+		s.keepAlive = d
+		return nil
+	}
+}
+
+// RemoteTx enables raw tx route, any client allowed by Authorize can then hold transaction lock
+// of prefix for up to TxTimeout. Disabled by default.
+func RemoteTx() ServerOpts {
+	return func(s *Server) error {
+		s.remoteTx = true
+		return nil
+	}
+}
+
+// Time after which transaction lock held by remote client is released. Unlock of released lock
+// fails with 409 Conflict, so transaction of remote client has to finish within it.
+func TxTimeout(d time.Duration) ServerOpts {
+	return func(s *Server) error {
+		s.txTimeout = d
+		return nil
+	}
+}
+
+// Authorize returns connection used to serve request, eg. acl connection bound to principal of request.
+// Returned error rejects request.
+func Authorize(fn func(r *http.Request) (storage.Connection, error)) ServerOpts {
+	return func(s *Server) error {
+		s.authorize = fn
+		return nil
+	}
+}
+
+func Logger(lg storage.Logger) ServerOpts {
+	return func(s *Server) error {
+		s.lg = lg
+		return nil
+	}
+}
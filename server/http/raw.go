@@ -0,0 +1,360 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/encoding"
+)
+
+// Raw routes work on encoded keys and values, they are used by engine/remote.
+//
+//	GET    /v1/raw/info                     key coder symbols and value coder probe
+//	GET    /v1/raw/kv?key={key}             encoded value
+//	HEAD   /v1/raw/kv?key={key}             key existence
+//	PUT    /v1/raw/kv?key={key}&ttl=30s     set encoded value
+//	DELETE /v1/raw/kv?key={key}             delete key
+//	POST   /v1/raw/incr?key={key}&delta=1   add delta, returns JSON sum, optional &ttl=30s, &float=true
+//	GET    /v1/raw/keys?prefix={pfx}        JSON list of keys
+//	GET    /v1/raw/len?prefix={pfx}         JSON number of keys
+//	GET    /v1/raw/iter?prefix={pfx}        newline delimited RawItem stream
+//	GET    /v1/raw/watch?prefix={pfx}       newline delimited RawEvent stream
+//	POST   /v1/raw/tx?prefix={pfx}          lock prefix, returns TxLock, enabled with RemoteTx option
+//	DELETE /v1/raw/tx/{id}                  unlock prefix, 409 Conflict when lock was released on tx timeout
+const RawRoute = "/v1/raw/"
+
+// ValueProbe is encoded by value coder of served connection, clients compare it with their encoding
+var ValueProbe = []any{"go-storage", 1.5, true}
+
+// Info about served connection
+type Info struct {
+	Symbols encoding.Constants `json:"symbols"`
+	Probe   []byte             `json:"probe"` // ValueProbe encoded by value coder
+}
+
+// RawItem of iter stream
+type RawItem struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// RawEvent of watch stream
+type RawEvent struct {
+	Event types.EventType `json:"event"`
+	Key   string          `json:"key"`
+	Value []byte          `json:"value,omitempty"`
+}
+
+// TxLock is held until released or until server tx timeout
+type TxLock struct {
+	ID string `json:"id"`
+}
+
+// held transaction locks
+type txLocks struct {
+	sync.Mutex
+	release map[string]chan struct{}
+	// locks released on timeout, kept for another timeout so client learns it on unlock
+	expired map[string]struct{}
+}
+
+func (s *Server) serveRaw(w http.ResponseWriter, r *http.Request, path string) {
+	switch {
+	case path == "info" && r.Method == http.MethodGet:
+		s.rawInfo(w)
+	case path == "kv":
+		s.rawKV(w, r)
+	case path == "incr" && r.Method == http.MethodPost:
+		s.rawIncr(w, r)
+	case path == "keys" && r.Method == http.MethodGet:
+		keys, err := s.conn.Keys(r.URL.Query().Get("prefix"))
+		if err != nil {
+			s.storageError(w, err)
+			return
+		}
+		s.write(w, http.StatusOK, keys)
+	case path == "len" && r.Method == http.MethodGet:
+		length, err := s.conn.Len(r.URL.Query().Get("prefix"))
+		if err != nil {
+			s.storageError(w, err)
+			return
+		}
+		s.write(w, http.StatusOK, length)
+	case path == "iter" && r.Method == http.MethodGet:
+		s.rawIter(w, r)
+	case path == "watch" && r.Method == http.MethodGet:
+		s.rawWatch(w, r)
+	case path == "tx" && r.Method == http.MethodPost:
+		s.rawLock(w, r)
+	case strings.HasPrefix(path, "tx/") && r.Method == http.MethodDelete:
+		s.rawUnlock(w, strings.TrimPrefix(path, "tx/"))
+	default:
+		s.error(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (s *Server) rawInfo(w http.ResponseWriter) {
+	probe, err := s.conn.Encoding().EncodeValue(ValueProbe)
+	if err != nil {
+		s.error(w, http.StatusInternalServerError, fmt.Errorf("encoder: %w", err))
+		return
+	}
+	s.write(w, http.StatusOK, Info{Symbols: s.conn.Encoding().Symbols(), Probe: probe})
+}
+
+func (s *Server) rawKV(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+
+	switch r.Method {
+	case http.MethodGet:
+		var data encoding.Raw
+		err := s.conn.Get(key, &data)
+		if err != nil {
+			s.storageError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+
+	case http.MethodHead:
+		if !s.conn.Exists(key) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodPut:
+		op, err := setOptions(r)
+		if err != nil {
+			s.error(w, http.StatusBadRequest, err)
+			return
+		}
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			s.error(w, http.StatusBadRequest, fmt.Errorf("body: %w", err))
+			return
+		}
+
+		err = s.conn.Set(key, encoding.Raw(data), op...)
+		if err != nil {
+			s.storageError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		err := s.conn.Delete(key)
+		if err != nil {
+			s.storageError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		s.error(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+func (s *Server) rawIncr(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	key := query.Get("key")
+
+	op, err := setOptions(r)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if query.Get("float") == "true" {
+		delta, err := strconv.ParseFloat(query.Get("delta"), 64)
+		if err != nil {
+			s.error(w, http.StatusBadRequest, fmt.Errorf("delta: %w", err))
+			return
+		}
+
+		n, err := s.conn.IncrFloat(key, delta, op...)
+		if err != nil {
+			s.storageError(w, err)
+			return
+		}
+		s.write(w, http.StatusOK, n)
+		return
+	}
+
+	delta, err := strconv.ParseInt(query.Get("delta"), 10, 64)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, fmt.Errorf("delta: %w", err))
+		return
+	}
+
+	n, err := s.conn.Incr(key, delta, op...)
+	if err != nil {
+		s.storageError(w, err)
+		return
+	}
+	s.write(w, http.StatusOK, n)
+}
+
+func (s *Server) rawIter(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	for item := range s.conn.Iter(r.Context(), r.URL.Query().Get("prefix")) {
+		err := enc.Encode(RawItem{Key: item.Key, Value: item.Value})
+		if err != nil {
+			s.lg.Error("iter", err)
+			return
+		}
+	}
+}
+
+func (s *Server) rawWatch(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.error(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx := r.Context()
+	events := s.conn.Watch(ctx, r.URL.Query().Get("prefix"))
+	enc := json.NewEncoder(w)
+
+	ticker := time.NewTicker(s.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			// whitespace between values is skipped by decoders
+			fmt.Fprint(w, "\n")
+			flusher.Flush()
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			err := enc.Encode(RawEvent{Event: event.Event, Key: event.Key, Value: event.Value})
+			if err != nil {
+				s.lg.Error("watch", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *Server) rawLock(w http.ResponseWriter, r *http.Request) {
+	if !s.remoteTx {
+		s.error(w, http.StatusForbidden, errors.New("remote transactions disabled. Use RemoteTx option"))
+		return
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		s.error(w, http.StatusInternalServerError, err)
+		return
+	}
+	id := hex.EncodeToString(buf)
+	pfx := r.URL.Query().Get("prefix")
+
+	acquired := make(chan struct{})
+	release := make(chan struct{})
+	failed := make(chan error, 1)
+
+	s.txs.Lock()
+	s.txs.release[id] = release
+	s.txs.Unlock()
+
+	go func() {
+		err := s.conn.Tx(pfx, func(tx storage.Transactioner) error {
+			close(acquired)
+
+			timer := time.NewTimer(s.txTimeout)
+			defer timer.Stop()
+
+			select {
+			case <-release:
+			case <-timer.C:
+				s.expire(id)
+			}
+			return nil
+		})
+		if err != nil {
+			failed <- err
+		}
+
+		s.txs.Lock()
+		delete(s.txs.release, id)
+		s.txs.Unlock()
+	}()
+
+	select {
+	case <-acquired:
+		s.write(w, http.StatusOK, TxLock{ID: id})
+	case err := <-failed:
+		s.storageError(w, err)
+	case <-r.Context().Done():
+		// client is gone, unlock as soon as lock is acquired
+		s.rawUnlock(w, id)
+	}
+}
+
+// expire releases timed out lock, unless it is being unlocked meanwhile
+func (s *Server) expire(id string) {
+	s.txs.Lock()
+	defer s.txs.Unlock()
+	if _, ok := s.txs.release[id]; !ok {
+		return
+	}
+
+	s.lg.Warn("tx", id, "timed out")
+	delete(s.txs.release, id)
+	s.txs.expired[id] = struct{}{}
+	time.AfterFunc(s.txTimeout, func() {
+		s.txs.Lock()
+		delete(s.txs.expired, id)
+		s.txs.Unlock()
+	})
+}
+
+func (s *Server) rawUnlock(w http.ResponseWriter, id string) {
+	s.txs.Lock()
+	release, ok := s.txs.release[id]
+	delete(s.txs.release, id)
+	_, expired := s.txs.expired[id]
+	delete(s.txs.expired, id)
+	s.txs.Unlock()
+
+	if expired {
+		s.error(w, http.StatusConflict, fmt.Errorf("tx %s timed out, lock was released", id))
+		return
+	}
+	if !ok {
+		s.error(w, http.StatusNotFound, fmt.Errorf("tx %s not found", id))
+		return
+	}
+	close(release)
+	w.WriteHeader(http.StatusNoContent)
+}
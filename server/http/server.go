@@ -0,0 +1,363 @@
+// Package http exposes storage.Connection over HTTP with JSON values.
+//
+//	GET    /v1/b/{bucket...}/{key}      value of key
+//	PUT    /v1/b/{bucket...}/{key}      set key to JSON body, optional ?ttl=30s
+//	DELETE /v1/b/{bucket...}/{key}      delete key
+//	GET    /v1/b/{bucket...}/           list bucket, ?limit=100&after={key}
+//	GET    /v1/watch/{bucket...}        Server-Sent Events with changes in bucket and its sub buckets
+//
+// Routes under /v1/raw/ work on encoded keys and values, see RawRoute.
+//
+// Bucket names and keys are separated by "/", names containing "/" must be escaped as "%2F".
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/keypath"
+	"github.com/rafalb8/go-storage/options"
+)
+
+const (
+	BucketRoute = "/v1/b/"
+	WatchRoute  = "/v1/watch/"
+
+	// max size of PUT body
+	maxBodySize = 4 << 20
+)
+
+var (
+	_ http.Handler = (*Server)(nil)
+)
+
+// Item of bucket listing
+type Item struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+// Page of bucket listing, Next is set when more items are available
+type Page struct {
+	Items []Item `json:"items"`
+	Next  string `json:"next,omitempty"`
+}
+
+// Event sent to watch streams, SSE event name is set to event type
+type Event struct {
+	Key   string `json:"key"`
+	Value any    `json:"value,omitempty"`
+}
+
+type Server struct {
+	conn storage.Connection
+
+	pageSize    int
+	maxPageSize int
+	keepAlive   time.Duration
+	txTimeout   time.Duration
+	remoteTx    bool
+	authorize   func(r *http.Request) (storage.Connection, error)
+
+	// transaction locks held by remote clients
+	txs *txLocks
+
+	// Logger
+	lg storage.Logger
+}
+
+func New(conn storage.Connection, opts ...ServerOpts) (*Server, error) {
+	s := &Server{
+		conn:        conn,
+		pageSize:    100,
+		maxPageSize: 1000,
+		keepAlive:   15 * time.Second,
+		txTimeout:   30 * time.Second,
+		txs:         &txLocks{release: map[string]chan struct{}{}, expired: map[string]struct{}{}},
+		lg:          &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.authorize != nil {
+		conn, err := s.authorize(r)
+		if err != nil {
+			s.storageError(w, err)
+			return
+		}
+
+		// serve request with connection of request
+		scoped := *s
+		scoped.conn = conn
+		s = &scoped
+	}
+
+	path := r.URL.EscapedPath()
+
+	switch {
+	case strings.HasPrefix(path, BucketRoute):
+		s.serveBucket(w, r, strings.TrimPrefix(path, BucketRoute))
+	case strings.HasPrefix(path, WatchRoute):
+		s.serveWatch(w, r, strings.TrimPrefix(path, WatchRoute))
+	case strings.HasPrefix(path, RawRoute):
+		s.serveRaw(w, r, strings.TrimPrefix(path, RawRoute))
+	default:
+		s.error(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (s *Server) serveBucket(w http.ResponseWriter, r *http.Request, path string) {
+	if path == "" || strings.HasSuffix(path, keypath.Separator) {
+		if r.Method != http.MethodGet {
+			s.error(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		s.list(w, r, path)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.get(w, r, path)
+	case http.MethodPut:
+		s.put(w, r, path)
+	case http.MethodDelete:
+		s.delete(w, r, path)
+	default:
+		s.error(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, path string) {
+	var val any
+	err := s.conn.Get(keypath.Encode(s.conn.Encoding(), path), &val)
+	if err != nil {
+		s.storageError(w, err)
+		return
+	}
+	s.write(w, http.StatusOK, val)
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request, path string) {
+	op, err := setOptions(r)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.UseNumber()
+
+	var val any
+	err = dec.Decode(&val)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, fmt.Errorf("body: %w", err))
+		return
+	}
+
+	err = s.conn.Set(keypath.Encode(s.conn.Encoding(), path), internal.FixNumbers(val), op...)
+	if err != nil {
+		s.storageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setOptions parses Set options from query, eg. ?ttl=30s
+func setOptions(r *http.Request) ([]storage.Option, error) {
+	op := []storage.Option{}
+	if ttl := r.URL.Query().Get("ttl"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("ttl: %w", err)
+		}
+		op = append(op, options.TTL(d))
+	}
+	return op, nil
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request, path string) {
+	err := s.conn.Delete(keypath.Encode(s.conn.Encoding(), path))
+	if err != nil {
+		s.storageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request, path string) {
+	query := r.URL.Query()
+
+	limit := s.pageSize
+	if l := query.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			s.error(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", l))
+			return
+		}
+	}
+	if limit > s.maxPageSize {
+		limit = s.maxPageSize
+	}
+
+	parent := keypath.Buckets(path)
+	after := query.Get("after")
+
+	// collect keys directly in bucket
+	values := map[string][]byte{}
+	for item := range s.conn.Iter(r.Context(), keypath.Prefix(s.conn.Encoding(), path)) {
+		buckets, key := keypath.Parse(s.conn.Encoding(), item.Key)
+		if len(buckets) != len(parent) || !keypath.HasBucket(buckets, parent) || key <= after {
+			continue
+		}
+		values[key] = item.Value
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	page := Page{Items: []Item{}}
+	if len(keys) > limit {
+		keys = keys[:limit]
+		page.Next = keys[limit-1]
+	}
+
+	for _, key := range keys {
+		var val any
+		err := s.conn.Encoding().DecodeValue(values[key], &val)
+		if err != nil {
+			s.error(w, http.StatusInternalServerError, fmt.Errorf("decode %s: %w", key, err))
+			return
+		}
+		page.Items = append(page.Items, Item{Key: key, Value: internal.FixValue(val)})
+	}
+
+	s.write(w, http.StatusOK, page)
+}
+
+func (s *Server) serveWatch(w http.ResponseWriter, r *http.Request, path string) {
+	if r.Method != http.MethodGet {
+		s.error(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.error(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx := r.Context()
+	parent := keypath.Buckets(path)
+	events := s.conn.Watch(ctx, keypath.Prefix(s.conn.Encoding(), path))
+
+	ticker := time.NewTicker(s.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			buckets, key := keypath.Parse(s.conn.Encoding(), event.Key)
+			if !keypath.HasBucket(buckets, parent) {
+				continue
+			}
+
+			msg := Event{Key: keypath.Join(buckets, key)}
+			if len(event.Value) > 0 {
+				var val any
+				err := s.conn.Encoding().DecodeValue(event.Value, &val)
+				if err != nil {
+					s.lg.Error("watch decode", msg.Key, err)
+					continue
+				}
+				msg.Value = internal.FixValue(val)
+			}
+
+			data, err := json.Marshal(msg)
+			if err != nil {
+				s.lg.Error("watch encode", msg.Key, err)
+				continue
+			}
+
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Event, data)
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *Server) storageError(w http.ResponseWriter, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		s.error(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, storage.ErrPermissionDenied) {
+		s.error(w, http.StatusForbidden, err)
+		return
+	}
+	if errors.Is(err, storage.ErrQuotaExceeded) {
+		s.error(w, http.StatusInsufficientStorage, err)
+		return
+	}
+	if errors.Is(err, storage.ErrInvalidValue) {
+		s.error(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	s.lg.Error(err)
+	s.error(w, http.StatusInternalServerError, err)
+}
+
+func (s *Server) error(w http.ResponseWriter, status int, err error) {
+	s.write(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *Server) write(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(internal.FixValue(v))
+	if err != nil {
+		s.lg.Error(err)
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
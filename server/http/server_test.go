@@ -0,0 +1,238 @@
+package http_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/engine/acl"
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/engine/schema"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+	storagehttp "github.com/rafalb8/go-storage/server/http"
+)
+
+var (
+	db  = internal.Must(memory.New())
+	srv = httptest.NewServer(internal.Must(storagehttp.New(db)))
+)
+
+func do(method, path, body string) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	return resp, data, err
+}
+
+func TestPutGetDelete(t *testing.T) {
+	resp, _, err := do(http.MethodPut, "/v1/b/env/123/one", `{"name": "one", "count": 1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		t.Error("Unexpected PUT status", resp.StatusCode)
+	}
+
+	val, err := helpers.Get[map[string]any](db.Bucket("env", "123"), "one")
+	if err != nil {
+		t.Error(err)
+	}
+	if val["name"] != "one" {
+		t.Error("Value not one")
+	}
+
+	resp, data, err := do(http.MethodGet, "/v1/b/env/123/one", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Error("Unexpected GET status", resp.StatusCode)
+	}
+	if string(data) != `{"count":1,"name":"one"}` {
+		t.Error("Unexpected GET body", string(data))
+	}
+
+	resp, _, err = do(http.MethodDelete, "/v1/b/env/123/one", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		t.Error("Unexpected DELETE status", resp.StatusCode)
+	}
+
+	resp, _, err = do(http.MethodGet, "/v1/b/env/123/one", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Error("Unexpected GET status after delete", resp.StatusCode)
+	}
+}
+
+func TestList(t *testing.T) {
+	bucket := db.Bucket("list")
+	for i := 0; i < 5; i++ {
+		err := bucket.Set(fmt.Sprint("key", i), i)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	db.Bucket("list", "nested").Set("other", 1)
+
+	keys := []string{}
+	next := ""
+	for pages := 0; pages < 10; pages++ {
+		resp, data, err := do(http.MethodGet, "/v1/b/list/?limit=2&after="+next, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatal("Unexpected list status", resp.StatusCode, string(data))
+		}
+
+		page := storagehttp.Page{}
+		err = json.Unmarshal(data, &page)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, item := range page.Items {
+			keys = append(keys, item.Key)
+		}
+
+		if page.Next == "" {
+			break
+		}
+		next = page.Next
+	}
+
+	if strings.Join(keys, ",") != "key0,key1,key2,key3,key4" {
+		t.Error("Unexpected keys", keys)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/watch/watched", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Error("Unexpected content type", resp.Header.Get("Content-Type"))
+	}
+
+	go func() {
+		// Magic sleep
+		time.Sleep(100 * time.Millisecond)
+		db.Bucket("other").Set("two", 2)
+		db.Bucket("watched", "nested").Set("two", 2)
+	}()
+
+	scanner := bufio.NewScanner(resp.Body)
+	lines := []string{}
+	for scanner.Scan() && len(lines) < 2 {
+		if scanner.Text() != "" {
+			lines = append(lines, scanner.Text())
+		}
+	}
+
+	if len(lines) != 2 {
+		t.Fatal("Change not found")
+	}
+	if lines[0] != "event: PUT" {
+		t.Error("Unexpected event", lines[0])
+	}
+	if lines[1] != `data: {"key":"watched/nested/two","value":2}` {
+		t.Error("Unexpected data", lines[1])
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	policy := internal.Must(acl.New(db, acl.Allow("admin", "", acl.All), acl.Allow(acl.AnyPrincipal, "public", acl.Read)))
+	srv := httptest.NewServer(internal.Must(storagehttp.New(db, storagehttp.Authorize(func(r *http.Request) (storage.Connection, error) {
+		return policy.As(r.Header.Get("X-Principal")), nil
+	}))))
+	defer srv.Close()
+
+	request := func(method, path, principal string) int {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(`"value"`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Principal", principal)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := request(http.MethodPut, "/v1/b/public/key", "admin"); status != http.StatusNoContent {
+		t.Error("Unexpected admin PUT status", status)
+	}
+	if status := request(http.MethodPut, "/v1/b/public/key", "guest"); status != http.StatusForbidden {
+		t.Error("Unexpected guest PUT status", status)
+	}
+	if status := request(http.MethodGet, "/v1/b/public/key", "guest"); status != http.StatusOK {
+		t.Error("Unexpected guest GET status", status)
+	}
+}
+
+func TestInvalidValue(t *testing.T) {
+	positive := internal.Must(schema.JSONSchema([]byte(`{"type": "integer", "minimum": 1}`)))
+	srv := httptest.NewServer(internal.Must(storagehttp.New(internal.Must(schema.New(db, schema.Validate("validated", positive))))))
+	defer srv.Close()
+
+	for body, status := range map[string]int{"1": http.StatusNoContent, "0": http.StatusUnprocessableEntity} {
+		req, err := http.NewRequest(http.MethodPut, srv.URL+"/v1/b/validated/key", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Error("Unexpected status of", body, resp.StatusCode)
+		}
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	srv.Close()
+	db.Close()
+	os.Exit(code)
+}
@@ -0,0 +1,659 @@
+package resp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rafalb8/go-maps/types"
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/keypath"
+	"github.com/rafalb8/go-storage/options"
+)
+
+// client connection state
+type client struct {
+	srv *Server
+	ctx context.Context
+	w   *writer
+
+	// active subscriptions
+	subs  map[string]context.CancelFunc
+	psubs map[string]context.CancelFunc
+}
+
+// exec runs command with writer locked, returns true if connection should be closed
+func (c *client) exec(args []string) bool {
+	cmd := strings.ToUpper(args[0])
+	args = args[1:]
+
+	if len(c.subs)+len(c.psubs) > 0 {
+		switch cmd {
+		case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "PING", "QUIT":
+		default:
+			c.w.error(fmt.Sprintf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(cmd)))
+			return false
+		}
+	}
+
+	switch cmd {
+	case "PING":
+		switch {
+		case len(c.subs)+len(c.psubs) > 0:
+			c.w.strings([]string{"pong", strings.Join(args, " ")})
+		case len(args) > 0:
+			c.w.bulk(args[0])
+		default:
+			c.w.simple("PONG")
+		}
+	case "ECHO":
+		if !c.arity(cmd, args, 1, 1) {
+			return false
+		}
+		c.w.bulk(args[0])
+	case "QUIT":
+		c.w.simple("OK")
+		return true
+	case "SELECT":
+		if !c.arity(cmd, args, 1, 1) {
+			return false
+		}
+		if args[0] != "0" {
+			c.w.error("ERR DB index is out of range")
+			return false
+		}
+		c.w.simple("OK")
+	case "COMMAND":
+		c.w.array(0)
+	case "CLIENT":
+		c.w.simple("OK")
+	case "GET":
+		c.get(args)
+	case "SET":
+		c.set(args)
+	case "DEL":
+		c.del(args)
+	case "EXISTS":
+		c.exists(args)
+	case "INCR", "DECR", "INCRBY", "DECRBY":
+		c.incr(cmd, args)
+	case "INCRBYFLOAT":
+		c.incrFloat(args)
+	case "TYPE":
+		if !c.arity(cmd, args, 1, 1) {
+			return false
+		}
+		if c.srv.conn.Exists(c.key(args[0])) {
+			c.w.simple("string")
+		} else {
+			c.w.simple("none")
+		}
+	case "TTL", "PTTL":
+		if !c.arity(cmd, args, 1, 1) {
+			return false
+		}
+		// TTL is not exposed by connections
+		if c.srv.conn.Exists(c.key(args[0])) {
+			c.w.integer(-1)
+		} else {
+			c.w.integer(-2)
+		}
+	case "DBSIZE":
+		length, err := c.srv.conn.Len("")
+		if err != nil {
+			c.w.error("ERR " + err.Error())
+			return false
+		}
+		c.w.integer(length)
+	case "KEYS":
+		c.keys(args)
+	case "SCAN":
+		c.scan(args)
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		c.subscribe(cmd, args)
+	case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		c.unsubscribe(cmd, args)
+	default:
+		c.w.error(fmt.Sprintf("ERR unknown command '%s'", strings.ToLower(cmd)))
+	}
+	return false
+}
+
+func (c *client) arity(cmd string, args []string, min, max int) bool {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		c.w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+		return false
+	}
+	return true
+}
+
+// key returns raw storage key for path
+func (c *client) key(path string) string {
+	return keypath.Encode(c.srv.conn.Encoding(), path)
+}
+
+func (c *client) get(args []string) {
+	if !c.arity("GET", args, 1, 1) {
+		return
+	}
+
+	var val any
+	err := c.srv.conn.Get(c.key(args[0]), &val)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.w.null()
+			return
+		}
+		c.w.error("ERR " + err.Error())
+		return
+	}
+
+	if s, ok := val.(string); ok {
+		c.w.bulk(s)
+		return
+	}
+
+	out, err := json.Marshal(internal.FixValue(val))
+	if err != nil {
+		c.w.error("ERR " + err.Error())
+		return
+	}
+	c.w.bulk(string(out))
+}
+
+func (c *client) set(args []string) {
+	if !c.arity("SET", args, 2, -1) {
+		return
+	}
+
+	op := []storage.Option{}
+	nx, xx := false, false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				c.w.error("ERR syntax error")
+				return
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				c.w.error("ERR invalid expire time in 'set' command")
+				return
+			}
+
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			op = append(op, options.TTL(time.Duration(n)*unit))
+			i++
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		default:
+			c.w.error("ERR syntax error")
+			return
+		}
+	}
+
+	if nx && xx {
+		c.w.error("ERR syntax error")
+		return
+	}
+
+	if nx || xx {
+		c.setCond(args[0], internal.ParseValue(args[1]), nx, op...)
+		return
+	}
+
+	err := c.srv.conn.Set(c.key(args[0]), internal.ParseValue(args[1]), op...)
+	if err != nil {
+		c.w.error("ERR " + err.Error())
+		return
+	}
+	c.w.simple("OK")
+}
+
+// setCond sets value only if key is missing (nx) or exists (!nx),
+// check and write run in transaction of key's bucket
+func (c *client) setCond(path string, v any, nx bool, op ...storage.Option) {
+	pfx := ""
+	buckets, name := keypath.Split(path)
+	if len(buckets) > 0 {
+		pfx = c.srv.conn.Encoding().EncodeBucket(buckets...)
+	}
+
+	written := false
+	err := c.srv.conn.Tx(pfx, func(tx storage.Transactioner) error {
+		key := name
+		if pfx == "" {
+			// keys outside of buckets aren't reachable through transaction, it only serializes check and write
+			tx, key = c.srv.conn, c.key(path)
+		}
+
+		var val any
+		err := tx.Get(key, &val)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		if exists := err == nil; exists == nx {
+			return nil
+		}
+		written = true
+		return tx.Set(key, v, op...)
+	})
+	if err != nil {
+		c.w.error("ERR " + err.Error())
+		return
+	}
+	if !written {
+		c.w.null()
+		return
+	}
+	c.w.simple("OK")
+}
+
+func (c *client) del(args []string) {
+	if !c.arity("DEL", args, 1, -1) {
+		return
+	}
+
+	n := 0
+	for _, path := range args {
+		key := c.key(path)
+		if !c.srv.conn.Exists(key) {
+			continue
+		}
+
+		err := c.srv.conn.Delete(key)
+		if err != nil {
+			c.w.error("ERR " + err.Error())
+			return
+		}
+		n++
+	}
+	c.w.integer(n)
+}
+
+func (c *client) incr(cmd string, args []string) {
+	delta := int64(1)
+	switch cmd {
+	case "INCR", "DECR":
+		if !c.arity(cmd, args, 1, 1) {
+			return
+		}
+	case "INCRBY", "DECRBY":
+		if !c.arity(cmd, args, 2, 2) {
+			return
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			c.w.error("ERR value is not an integer or out of range")
+			return
+		}
+		delta = n
+	}
+	if cmd == "DECR" || cmd == "DECRBY" {
+		delta = -delta
+	}
+
+	n, err := c.srv.conn.Incr(c.key(args[0]), delta)
+	if err != nil {
+		c.w.error("ERR " + err.Error())
+		return
+	}
+	c.w.integer(int(n))
+}
+
+func (c *client) incrFloat(args []string) {
+	if !c.arity("INCRBYFLOAT", args, 2, 2) {
+		return
+	}
+
+	delta, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		c.w.error("ERR value is not a valid float")
+		return
+	}
+
+	n, err := c.srv.conn.IncrFloat(c.key(args[0]), delta)
+	if err != nil {
+		c.w.error("ERR " + err.Error())
+		return
+	}
+	c.w.bulk(strconv.FormatFloat(n, 'f', -1, 64))
+}
+
+func (c *client) exists(args []string) {
+	if !c.arity("EXISTS", args, 1, -1) {
+		return
+	}
+
+	n := 0
+	for _, path := range args {
+		if c.srv.conn.Exists(c.key(path)) {
+			n++
+		}
+	}
+	c.w.integer(n)
+}
+
+func (c *client) keys(args []string) {
+	if !c.arity("KEYS", args, 1, 1) {
+		return
+	}
+
+	paths, err := c.match(args[0])
+	if err != nil {
+		c.w.error("ERR " + err.Error())
+		return
+	}
+	c.w.strings(paths)
+}
+
+func (c *client) scan(args []string) {
+	if !c.arity("SCAN", args, 1, -1) {
+		return
+	}
+
+	cursor, err := strconv.Atoi(args[0])
+	if err != nil || cursor < 0 {
+		c.w.error("ERR invalid cursor")
+		return
+	}
+
+	pattern, count := "*", 10
+	for i := 1; i < len(args); i++ {
+		if i+1 >= len(args) {
+			c.w.error("ERR syntax error")
+			return
+		}
+
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil || count <= 0 {
+				c.w.error("ERR syntax error")
+				return
+			}
+		case "TYPE":
+			// every key is a string
+		default:
+			c.w.error("ERR syntax error")
+			return
+		}
+		i++
+	}
+
+	paths, err := c.match(pattern)
+	if err != nil {
+		c.w.error("ERR " + err.Error())
+		return
+	}
+
+	// cursor is position in sorted key list
+	if cursor > len(paths) {
+		cursor = len(paths)
+	}
+	end, next := cursor+count, cursor+count
+	if end >= len(paths) {
+		end, next = len(paths), 0
+	}
+
+	c.w.array(2)
+	c.w.bulk(strconv.Itoa(next))
+	c.w.strings(paths[cursor:end])
+}
+
+// match returns sorted paths matching glob pattern
+func (c *client) match(pattern string) ([]string, error) {
+	re, err := glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := c.srv.conn.Keys(keypath.Prefix(c.srv.conn.Encoding(), patternBucket(pattern)))
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for _, key := range keys {
+		path := keypath.Decode(c.srv.conn.Encoding(), key)
+		if re.MatchString(path) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (c *client) subscribe(cmd string, args []string) {
+	if !c.arity(cmd, args, 1, -1) {
+		return
+	}
+
+	pattern := cmd == "PSUBSCRIBE"
+	subs, kind := c.subs, "subscribe"
+	if pattern {
+		subs, kind = c.psubs, "psubscribe"
+	}
+
+	for _, channel := range args {
+		if _, exists := subs[channel]; !exists {
+			match, bucket, err := subscription(channel, pattern)
+			if err != nil {
+				c.w.error("ERR " + err.Error())
+				return
+			}
+
+			ctx, cancel := context.WithCancel(c.ctx)
+			subs[channel] = cancel
+			go c.forward(ctx, channel, pattern, match, c.srv.conn.Watch(ctx, keypath.Prefix(c.srv.conn.Encoding(), bucket)))
+		}
+
+		c.w.array(3)
+		c.w.bulk(kind)
+		c.w.bulk(channel)
+		c.w.integer(len(c.subs) + len(c.psubs))
+	}
+}
+
+func (c *client) unsubscribe(cmd string, args []string) {
+	subs, kind := c.subs, "unsubscribe"
+	if cmd == "PUNSUBSCRIBE" {
+		subs, kind = c.psubs, "punsubscribe"
+	}
+
+	if len(args) == 0 {
+		for channel := range subs {
+			args = append(args, channel)
+		}
+		sort.Strings(args)
+	}
+
+	if len(args) == 0 {
+		c.w.array(3)
+		c.w.bulk(kind)
+		c.w.null()
+		c.w.integer(len(c.subs) + len(c.psubs))
+		return
+	}
+
+	for _, channel := range args {
+		if cancel, exists := subs[channel]; exists {
+			cancel()
+			delete(subs, channel)
+		}
+
+		c.w.array(3)
+		c.w.bulk(kind)
+		c.w.bulk(channel)
+		c.w.integer(len(c.subs) + len(c.psubs))
+	}
+}
+
+// forward pushes watch events to client
+func (c *client) forward(ctx context.Context, channel string, pattern bool, match func(string) bool, events types.Watcher[string, []byte]) {
+	for event := range events {
+		if ctx.Err() != nil {
+			continue
+		}
+
+		path := keypath.Decode(c.srv.conn.Encoding(), event.Key)
+		if !match(path) {
+			continue
+		}
+
+		msg := map[string]any{"event": event.Event, "key": path}
+		if len(event.Value) > 0 {
+			var val any
+			err := c.srv.conn.Encoding().DecodeValue(event.Value, &val)
+			if err != nil {
+				c.srv.lg.Error("subscribe decode", path, err)
+				continue
+			}
+			msg["value"] = internal.FixValue(val)
+		}
+
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			c.srv.lg.Error("subscribe encode", path, err)
+			continue
+		}
+
+		c.w.Lock()
+		if pattern {
+			c.w.strings([]string{"pmessage", channel, path, string(payload)})
+		} else {
+			c.w.strings([]string{"message", channel, string(payload)})
+		}
+		err = c.w.flush()
+		c.w.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// subscription returns path matcher and bucket path used for watch
+func subscription(channel string, pattern bool) (func(string) bool, string, error) {
+	if pattern {
+		re, err := glob(channel)
+		if err != nil {
+			return nil, "", err
+		}
+		return re.MatchString, patternBucket(channel), nil
+	}
+
+	channel = strings.Trim(channel, keypath.Separator)
+	match := func(path string) bool {
+		return channel == "" || path == channel || strings.HasPrefix(path, channel+keypath.Separator)
+	}
+
+	bucket := ""
+	if i := strings.LastIndex(channel, keypath.Separator); i >= 0 {
+		bucket = channel[:i]
+	}
+	return match, bucket, nil
+}
+
+// patternBucket returns longest bucket path without glob characters
+func patternBucket(pattern string) string {
+	literal := pattern
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		literal = pattern[:i]
+	}
+
+	if i := strings.LastIndex(literal, keypath.Separator); i >= 0 {
+		return literal[:i]
+	}
+	return ""
+}
+
+// glob converts Redis glob pattern to regexp
+func glob(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		case '[':
+			class, n, ok := globClass(pattern[i+1:])
+			if !ok {
+				sb.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			sb.WriteString(class)
+			i += n
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// globClass converts Redis character class, eg. "a-c]" or "^xy]", to regexp class,
+// returns class and number of consumed bytes including closing bracket
+func globClass(pattern string) (string, int, bool) {
+	var sb strings.Builder
+	sb.WriteString("[")
+
+	i := 0
+	if i < len(pattern) && pattern[i] == '^' {
+		sb.WriteString("^")
+		i++
+	}
+
+	for ; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case ']':
+			if i == 0 || (i == 1 && pattern[0] == '^') {
+				// empty class never matches
+				return "[^\\x00-\\x{10FFFF}]", i + 1, true
+			}
+			sb.WriteString("]")
+			return sb.String(), i + 1, true
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(classLiteral(pattern[i]))
+			}
+		case '-':
+			sb.WriteString("-")
+		default:
+			sb.WriteString(classLiteral(ch))
+		}
+	}
+	return "", 0, false
+}
+
+// classLiteral escapes byte for use in regexp class
+func classLiteral(ch byte) string {
+	if strings.IndexByte(`\\[]^-`, ch) >= 0 {
+		return "\\" + string(ch)
+	}
+	return regexp.QuoteMeta(string(ch))
+}
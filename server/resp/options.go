@@ -0,0 +1,12 @@
+package resp
+
+import "github.com/rafalb8/go-storage"
+
+type ServerOpts func(*Server) error
+
+func Logger(lg storage.Logger) ServerOpts {
+	return func(s *Server) error {
+		s.lg = lg
+		return nil
+	}
+}
@@ -0,0 +1,120 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// max number of command arguments and bulk string size
+const (
+	maxArgs     = 1024 * 1024
+	maxBulkSize = 512 << 20
+)
+
+// max number of preallocated arguments
+const preallocArgs = 16
+
+var errProtocol = errors.New("protocol error")
+
+// readCommand reads RESP array of bulk strings or inline command
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		// inline command
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n <= 0 || n > maxArgs {
+		return nil, errProtocol
+	}
+
+	// count is sent by client, so it doesn't size allocation
+	args := make([]string, 0, minInt(n, preallocArgs))
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, errProtocol
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkSize {
+			return nil, errProtocol
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// writer serializes replies, pushed messages are written concurrently with replies
+type writer struct {
+	sync.Mutex
+	w *bufio.Writer
+}
+
+func (w *writer) simple(s string) {
+	fmt.Fprintf(w.w, "+%s\r\n", s)
+}
+
+func (w *writer) error(s string) {
+	fmt.Fprintf(w.w, "-%s\r\n", strings.ReplaceAll(s, "\r\n", " "))
+}
+
+func (w *writer) integer(n int) {
+	fmt.Fprintf(w.w, ":%d\r\n", n)
+}
+
+func (w *writer) bulk(s string) {
+	fmt.Fprintf(w.w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func (w *writer) null() {
+	w.w.WriteString("$-1\r\n")
+}
+
+func (w *writer) array(n int) {
+	fmt.Fprintf(w.w, "*%d\r\n", n)
+}
+
+func (w *writer) strings(s []string) {
+	w.array(len(s))
+	for _, v := range s {
+		w.bulk(v)
+	}
+}
+
+func (w *writer) flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,173 @@
+// Package resp serves storage.Connection over subset of Redis protocol (RESP2).
+//
+// Keys are paths of bucket names and key separated by "/", eg. env/123/element/one.
+// Values are returned as JSON, strings are returned as is. SET parses value as JSON,
+// values which are not valid JSON are stored as strings.
+//
+// Supported commands: PING, ECHO, QUIT, SELECT 0, COMMAND, CLIENT, GET, SET [EX|PX] [NX|XX],
+// DEL, EXISTS, INCR, DECR, INCRBY, DECRBY, INCRBYFLOAT, TYPE, TTL, DBSIZE, KEYS, SCAN [MATCH] [COUNT],
+// SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE and PUNSUBSCRIBE.
+//
+// SUBSCRIBE channel receives changes of key with channel path and of all keys in bucket with channel path,
+// PSUBSCRIBE pattern receives changes of keys matching glob pattern. Messages are JSON objects
+// with event, key and value fields.
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/rafalb8/go-storage"
+	"github.com/rafalb8/go-storage/internal"
+)
+
+type Server struct {
+	conn storage.Connection
+
+	// context
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mtx       sync.Mutex
+	listeners map[net.Listener]struct{}
+	clients   map[net.Conn]struct{}
+
+	// Logger
+	lg storage.Logger
+}
+
+func New(conn storage.Connection, opts ...ServerOpts) (*Server, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &Server{
+		conn:      conn,
+		ctx:       ctx,
+		cancel:    cancel,
+		listeners: map[net.Listener]struct{}{},
+		clients:   map[net.Conn]struct{}{},
+		lg:        &internal.SimpleLogger{},
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		err := opt(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// ListenAndServe listens on TCP address and serves clients until Close
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts clients on listener until Close
+func (s *Server) Serve(l net.Listener) error {
+	s.mtx.Lock()
+	if s.ctx.Err() != nil {
+		s.mtx.Unlock()
+		l.Close()
+		return errors.New("resp: server closed")
+	}
+	s.listeners[l] = struct{}{}
+	s.mtx.Unlock()
+
+	defer func() {
+		s.mtx.Lock()
+		delete(s.listeners, l)
+		s.mtx.Unlock()
+		l.Close()
+	}()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(nc)
+	}
+}
+
+// Close stops listeners and disconnects clients
+func (s *Server) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.cancel()
+	for l := range s.listeners {
+		l.Close()
+	}
+	for nc := range s.clients {
+		nc.Close()
+	}
+	return nil
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	s.mtx.Lock()
+	if s.ctx.Err() != nil {
+		s.mtx.Unlock()
+		nc.Close()
+		return
+	}
+	s.clients[nc] = struct{}{}
+	s.mtx.Unlock()
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	c := &client{
+		srv:   s,
+		ctx:   ctx,
+		w:     &writer{w: bufio.NewWriter(nc)},
+		subs:  map[string]context.CancelFunc{},
+		psubs: map[string]context.CancelFunc{},
+	}
+
+	defer func() {
+		cancel()
+		nc.Close()
+
+		s.mtx.Lock()
+		delete(s.clients, nc)
+		s.mtx.Unlock()
+	}()
+
+	r := bufio.NewReader(nc)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.w.Lock()
+				c.w.error("ERR " + err.Error())
+				c.w.flush()
+				c.w.Unlock()
+			}
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		c.w.Lock()
+		quit := c.exec(args)
+		err = c.w.flush()
+		c.w.Unlock()
+
+		if quit || err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package resp_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rafalb8/go-storage/engine/memory"
+	"github.com/rafalb8/go-storage/helpers"
+	"github.com/rafalb8/go-storage/internal"
+	"github.com/rafalb8/go-storage/internal/keypath"
+	"github.com/rafalb8/go-storage/server/resp"
+)
+
+var (
+	db   = internal.Must(memory.New())
+	srv  = internal.Must(resp.New(db))
+	addr = listen()
+)
+
+func listen() string {
+	l := internal.Must(net.Listen("tcp", "127.0.0.1:0"))
+	go srv.Serve(l)
+	return l.Addr().String()
+}
+
+// client sends commands and reads replies as strings
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T) *client {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &client{conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *client) do(args ...string) any {
+	fmt.Fprintf(c.conn, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.conn, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return c.read()
+}
+
+func (c *client) read() any {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	switch line[0] {
+	case '+', '-', ':':
+		return line
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		buf := make([]byte, n+2)
+		_, err := io.ReadFull(c.r, buf)
+		if err != nil {
+			return err
+		}
+		return string(buf[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		out := make([]any, n)
+		for i := range out {
+			out[i] = c.read()
+		}
+		return out
+	}
+	return fmt.Errorf("unknown reply %q", line)
+}
+
+func TestGetSetDel(t *testing.T) {
+	c := dial(t)
+	defer c.conn.Close()
+
+	if reply := c.do("SET", "env/123/one", `{"a": 1}`); reply != "+OK" {
+		t.Error("Unexpected SET reply", reply)
+	}
+
+	val, err := helpers.Get[map[string]int](db.Bucket("env", "123"), "one")
+	if err != nil {
+		t.Error(err)
+	}
+	if val["a"] != 1 {
+		t.Error("Value not 1")
+	}
+
+	if reply := c.do("GET", "env/123/one"); reply != `{"a":1}` {
+		t.Error("Unexpected GET reply", reply)
+	}
+
+	if reply := c.do("SET", "str", "plain text"); reply != "+OK" {
+		t.Error("Unexpected SET reply", reply)
+	}
+	if reply := c.do("GET", "str"); reply != "plain text" {
+		t.Error("Unexpected GET reply", reply)
+	}
+
+	if reply := c.do("SET", "str", "other", "NX"); reply != nil {
+		t.Error("Unexpected SET NX reply", reply)
+	}
+
+	if reply := c.do("EXISTS", "env/123/one", "str", "missing"); reply != ":2" {
+		t.Error("Unexpected EXISTS reply", reply)
+	}
+
+	if reply := c.do("DEL", "env/123/one", "missing"); reply != ":1" {
+		t.Error("Unexpected DEL reply", reply)
+	}
+
+	if reply := c.do("GET", "env/123/one"); reply != nil {
+		t.Error("Unexpected GET reply after DEL", reply)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	c := dial(t)
+	defer c.conn.Close()
+
+	if reply := c.do("INCR", "counters/hits"); reply != ":1" {
+		t.Error("Unexpected INCR reply", reply)
+	}
+	if reply := c.do("INCRBY", "counters/hits", "10"); reply != ":11" {
+		t.Error("Unexpected INCRBY reply", reply)
+	}
+	if reply := c.do("DECR", "counters/hits"); reply != ":10" {
+		t.Error("Unexpected DECR reply", reply)
+	}
+	if reply := c.do("GET", "counters/hits"); reply != "10" {
+		t.Error("Unexpected GET reply", reply)
+	}
+
+	if reply := c.do("SET", "counters/price", "1.5"); reply != "+OK" {
+		t.Error("Unexpected SET reply", reply)
+	}
+	if reply := c.do("INCRBYFLOAT", "counters/price", "0.25"); reply != "1.75" {
+		t.Error("Unexpected INCRBYFLOAT reply", reply)
+	}
+
+	if reply, ok := c.do("INCRBY", "counters/hits", "x").(string); !ok || !strings.HasPrefix(reply, "-ERR") {
+		t.Error("Expected error, got", reply)
+	}
+}
+
+func TestSetTTL(t *testing.T) {
+	c := dial(t)
+	defer c.conn.Close()
+
+	if reply := c.do("SET", "ttl/key", "1", "PX", "100"); reply != "+OK" {
+		t.Error("Unexpected SET reply", reply)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if reply := c.do("EXISTS", "ttl/key"); reply != ":0" {
+		t.Error("Key not expired", reply)
+	}
+}
+
+func TestKeysScan(t *testing.T) {
+	c := dial(t)
+	defer c.conn.Close()
+
+	for i := 0; i < 5; i++ {
+		c.do("SET", fmt.Sprint("scan/key", i), fmt.Sprint(i))
+	}
+	c.do("SET", "scan/nested/key", "1")
+
+	reply, ok := c.do("KEYS", "scan/key*").([]any)
+	if !ok || len(reply) != 5 {
+		t.Error("Unexpected KEYS reply", reply)
+	}
+
+	keys := []any{}
+	cursor := "0"
+	for i := 0; i < 10; i++ {
+		reply := c.do("SCAN", cursor, "MATCH", "scan/*", "COUNT", "2").([]any)
+		cursor = reply[0].(string)
+		keys = append(keys, reply[1].([]any)...)
+		if cursor == "0" {
+			break
+		}
+	}
+
+	if len(keys) != 6 {
+		t.Error("Unexpected SCAN keys", keys)
+	}
+
+	if reply, ok := c.do("KEYS", "scan/key[1-3]").([]any); !ok || len(reply) != 3 {
+		t.Error("Unexpected KEYS reply for class", reply)
+	}
+	if reply, ok := c.do("KEYS", "scan/key[^1-3]").([]any); !ok || len(reply) != 2 {
+		t.Error("Unexpected KEYS reply for negated class", reply)
+	}
+}
+
+func TestSetNX(t *testing.T) {
+	for _, key := range []string{"nx", "nx/bucket/key"} {
+		db.Delete(keypath.Encode(db.Encoding(), key))
+
+		replies := make(chan any, 10)
+		for i := 0; i < cap(replies); i++ {
+			go func(i int) {
+				c := dial(t)
+				defer c.conn.Close()
+				replies <- c.do("SET", key, fmt.Sprint(i), "NX")
+			}(i)
+		}
+
+		ok := 0
+		for i := 0; i < cap(replies); i++ {
+			if <-replies == "+OK" {
+				ok++
+			}
+		}
+		if ok != 1 {
+			t.Error("Expected single SET NX to succeed", key, ok)
+		}
+
+		c := dial(t)
+		if reply := c.do("SET", key, "x", "XX"); reply != "+OK" {
+			t.Error("Unexpected SET XX reply", reply)
+		}
+		if reply := c.do("GET", key); reply != "x" {
+			t.Error("Unexpected GET reply", reply)
+		}
+		c.conn.Close()
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	c := dial(t)
+	defer c.conn.Close()
+
+	reply := c.do("SUBSCRIBE", "watched")
+	if fmt.Sprint(reply) != "[subscribe watched :1]" {
+		t.Error("Unexpected SUBSCRIBE reply", reply)
+	}
+
+	if reply := c.do("GET", "watched"); !strings.HasPrefix(fmt.Sprint(reply), "-ERR") {
+		t.Error("Expected error in subscribe mode", reply)
+	}
+
+	db.Bucket("other").Set("two", 2)
+	db.Bucket("watched", "nested").Set("two", 2)
+
+	c.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	msg := c.read()
+	if fmt.Sprint(msg) != `[message watched {"event":"PUT","key":"watched/nested/two","value":2}]` {
+		t.Error("Unexpected message", msg)
+	}
+}
+
+func TestProtocolError(t *testing.T) {
+	for _, count := range []string{"*-1", "*0", "*x"} {
+		c := dial(t)
+		fmt.Fprintf(c.conn, "%s\r\n", count)
+		if reply := c.read(); reply != "-ERR protocol error" {
+			t.Error("Unexpected reply to", count, reply)
+		}
+		c.conn.Close()
+	}
+
+	// server still serves other clients
+	c := dial(t)
+	defer c.conn.Close()
+	if reply := c.do("PING"); reply != "+PONG" {
+		t.Error("Unexpected reply", reply)
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	srv.Close()
+	db.Close()
+	os.Exit(code)
+}